@@ -0,0 +1,86 @@
+package argocd
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	applicationGVR    = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	applicationSetGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applicationsets"}
+)
+
+// ApplicationsUsing returns the names of the Applications of a project that
+// deploy to the given project destination
+func (c *Client) ApplicationsUsing(ctx context.Context, projectName string, dest Destination) ([]string, error) {
+	return c.usersOf(ctx, applicationGVR, []string{"spec"}, projectName, dest)
+}
+
+// ApplicationSetsUsing returns the names of the ApplicationSets whose template
+// deploys Applications of a project to the given project destination. Template
+// fields that contain {{...}} parameters are treated as matching anything,
+// since their values are only known once the ApplicationSet is rendered.
+func (c *Client) ApplicationSetsUsing(ctx context.Context, projectName string, dest Destination) ([]string, error) {
+	return c.usersOf(ctx, applicationSetGVR, []string{"spec", "template", "spec"}, projectName, dest)
+}
+
+// usersOf lists the resources whose Application spec, found at specPath,
+// belongs to the project and targets the destination
+func (c *Client) usersOf(ctx context.Context, gvr schema.GroupVersionResource, specPath []string, projectName string, dest Destination) ([]string, error) {
+	list, err := c.dynamicClient.Resource(gvr).Namespace(c.Namespace(ctx)).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var names []string
+	for _, item := range list.Items {
+		spec, _, _ := unstructured.NestedMap(item.Object, specPath...)
+		project, _, _ := unstructured.NestedString(spec, "project")
+		server, _, _ := unstructured.NestedString(spec, "destination", "server")
+		namespace, _, _ := unstructured.NestedString(spec, "destination", "namespace")
+		name, _, _ := unstructured.NestedString(spec, "destination", "name")
+
+		if !templateMatch(projectName, project) {
+			continue
+		}
+		if destinationPermits(dest, Destination{Server: server, Namespace: namespace, Name: name}) {
+			names = append(names, item.GetName())
+		}
+	}
+	return names, nil
+}
+
+// destinationPermits reports whether a project destination, whose fields may
+// be glob patterns, permits an Application destination
+func destinationPermits(dest, app Destination) bool {
+	if !globMatch(dest.Namespace, app.Namespace) {
+		return false
+	}
+	if dest.Server != "" && app.Server != "" {
+		return globMatch(dest.Server, app.Server)
+	}
+	if dest.Name != "" && app.Name != "" {
+		return globMatch(dest.Name, app.Name)
+	}
+	return false
+}
+
+// globMatch matches a value against a project destination pattern. Template
+// parameters in the value match any pattern.
+func globMatch(pattern, value string) bool {
+	if strings.Contains(value, "{{") {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// templateMatch compares a value with a field that may be a template parameter
+func templateMatch(want, field string) bool {
+	return field == want || strings.Contains(field, "{{")
+}
@@ -0,0 +1,226 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ArchivedDestinationsAnnotation is the AppProject annotation holding the
+// destinations removed while Options.ArchiveRemovals is set, as a JSON array,
+// so they can be restored until they are purged. ArgoCD only reads
+// spec.destinations, so archived destinations grant no access.
+const ArchivedDestinationsAnnotation = "argocd-destination-api/archived-destinations"
+
+// ArchivedDestination is a removed destination kept for restoring, together
+// with the metadata it had and when it was removed
+type ArchivedDestination struct {
+	Destination
+	Metadata   *DestinationMetadata `json:"metadata,omitempty"`
+	ArchivedAt time.Time            `json:"archivedAt"`
+}
+
+// GetArchivedDestinations retrieves the archived destinations of an AppProject,
+// oldest first, along with the resourceVersion
+func (c *Client) GetArchivedDestinations(ctx context.Context, projectName string) ([]ArchivedDestination, string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+
+	archive := archiveOf(project.GetAnnotations())
+	if archive == nil {
+		archive = []ArchivedDestination{}
+	}
+	return archive, project.GetResourceVersion(), nil
+}
+
+// RestoreDestination adds an archived destination back to an AppProject with
+// the metadata it had, dropping an expiry that has passed, and removes it from
+// the archive in the same patch. It returns ErrDestinationNotArchived if the
+// archive has no such destination. If the project has the destination again,
+// nothing changes and Result.Changed is false. Conflicts are retried like in
+// RemoveDestination.
+func (c *Client) RestoreDestination(ctx context.Context, projectName string, dest Destination) (ArchivedDestination, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return ArchivedDestination{}, Result{}, err
+	}
+	defer unlock()
+
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return ArchivedDestination{}, Result{}, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return ArchivedDestination{}, Result{}, err
+		}
+
+		archive := archiveOf(base.annotations)
+		index := -1
+		for i, archived := range archive {
+			if matches(archived.Destination, dest) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return ArchivedDestination{}, Result{}, fmt.Errorf("%w: %s", ErrDestinationNotArchived, projectName)
+		}
+		restored := archive[index]
+
+		for _, raw := range rawDestinations {
+			if existing, ok := destinationFromRaw(raw); ok && matches(existing, restored.Destination) {
+				return restored, Result{ResourceVersion: base.resourceVersion}, nil
+			}
+		}
+
+		if limit := c.options.MaxDestinations; limit > 0 && len(rawDestinations) >= limit {
+			return ArchivedDestination{}, Result{}, &DestinationLimitError{Project: projectName, Count: len(rawDestinations), Limit: limit}
+		}
+
+		rawDestinations = append(rawDestinations, destinationToRaw(restored.Destination))
+		if restored.Metadata != nil {
+			meta := *restored.Metadata
+			if meta.Expired(time.Now()) {
+				meta.ExpiresAt = nil
+			}
+			if !meta.IsZero() {
+				if metadata == nil {
+					metadata = make(map[string]DestinationMetadata)
+				}
+				metadata[destinationKey(restored.Destination)] = meta
+			}
+			restored.Metadata = &meta
+		}
+
+		remaining := append(append([]ArchivedDestination{}, archive[:index]...), archive[index+1:]...)
+		newVersion, err := c.patchDestinationsWithArchive(ctx, projectName, rawDestinations, metadata, remaining, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return ArchivedDestination{}, Result{}, err
+		}
+		return restored, Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// ProjectsWithArchiveBefore returns the names of the AppProjects that have at
+// least one destination archived before cutoff
+func (c *Client) ProjectsWithArchiveBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	list, err := c.resource(ctx).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var names []string
+	for i := range list.Items {
+		for _, archived := range archiveOf(list.Items[i].GetAnnotations()) {
+			if archived.ArchivedAt.Before(cutoff) {
+				names = append(names, list.Items[i].GetName())
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// PurgeArchivedDestinations permanently drops the destinations of an
+// AppProject archived before cutoff and returns them. Conflicts with
+// concurrent modifications are retried like in RemoveDestination.
+// Result.Changed is false if there was nothing to purge.
+func (c *Client) PurgeArchivedDestinations(ctx context.Context, projectName string, cutoff time.Time) ([]ArchivedDestination, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return nil, Result{}, err
+		}
+
+		kept := []ArchivedDestination{}
+		var purged []ArchivedDestination
+		for _, archived := range archiveOf(base.annotations) {
+			if archived.ArchivedAt.Before(cutoff) {
+				purged = append(purged, archived)
+			} else {
+				kept = append(kept, archived)
+			}
+		}
+		if len(purged) == 0 {
+			return nil, Result{ResourceVersion: base.resourceVersion}, nil
+		}
+
+		newVersion, err := c.patchDestinationsWithArchive(ctx, projectName, rawDestinations, metadata, kept, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return nil, Result{}, err
+		}
+		return purged, Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// archiveRemoved returns the archive with the removed destinations and their
+// metadata appended. An earlier archived copy of a removed destination is
+// replaced, so the archive holds each destination once.
+func archiveRemoved(archive []ArchivedDestination, removed []Destination, metadata map[string]DestinationMetadata, now time.Time) []ArchivedDestination {
+	removedKeys := make(map[string]bool, len(removed))
+	for _, dest := range removed {
+		removedKeys[destinationKey(dest)] = true
+	}
+
+	updated := []ArchivedDestination{}
+	for _, archived := range archive {
+		if !removedKeys[destinationKey(archived.Destination)] {
+			updated = append(updated, archived)
+		}
+	}
+	for _, dest := range removed {
+		archived := ArchivedDestination{Destination: dest, ArchivedAt: now.UTC()}
+		if meta, ok := metadata[destinationKey(dest)]; ok {
+			archived.Metadata = &meta
+		}
+		updated = append(updated, archived)
+	}
+	return updated
+}
+
+// archiveOf returns the archived destinations stored in an AppProject's
+// annotations. An annotation that can't be parsed is treated as empty.
+func archiveOf(annotations map[string]string) []ArchivedDestination {
+	value, ok := annotations[ArchivedDestinationsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var archive []ArchivedDestination
+	if err := json.Unmarshal([]byte(value), &archive); err != nil {
+		return nil
+	}
+	return archive
+}
+
+// archiveAnnotationValue returns the patch value of the archive annotation:
+// the encoded archive, or nil to remove the annotation when empty
+func archiveAnnotationValue(archive []ArchivedDestination) (interface{}, error) {
+	if len(archive) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal archived destinations: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,82 @@
+package argocd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// projectCacheKey identifies a cached project list
+type projectCacheKey struct {
+	namespace     string
+	labelSelector string
+	fieldSelector string
+}
+
+type projectCacheEntry struct {
+	projects []Project
+	expires  time.Time
+}
+
+// projectCache holds ListProjects results for Options.ProjectCacheTTL. Every
+// mutation made through the client invalidates the lists of its ArgoCD
+// namespace, so this server never serves a list older than its own changes.
+type projectCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[projectCacheKey]projectCacheEntry
+	// generations counts the invalidations per namespace. A list is only
+	// stored if no invalidation happened while it was being fetched, since it
+	// may have been read before the mutation.
+	generations map[string]uint64
+}
+
+func newProjectCache(ttl time.Duration) *projectCache {
+	return &projectCache{
+		ttl:         ttl,
+		entries:     make(map[projectCacheKey]projectCacheEntry),
+		generations: make(map[string]uint64),
+	}
+}
+
+// get returns a fresh cached list along with the namespace's generation, which
+// must be passed to put when storing a list fetched after a miss
+func (pc *projectCache) get(key projectCacheKey) ([]Project, uint64, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	entry, ok := pc.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		metrics.ProjectCacheLookups.WithLabelValues("hit").Inc()
+		return entry.projects, pc.generations[key.namespace], true
+	}
+	delete(pc.entries, key)
+	metrics.ProjectCacheLookups.WithLabelValues("miss").Inc()
+	return nil, pc.generations[key.namespace], false
+}
+
+// put stores a list unless the namespace was invalidated since generation
+func (pc *projectCache) put(key projectCacheKey, generation uint64, projects []Project) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.generations[key.namespace] != generation {
+		return
+	}
+	pc.entries[key] = projectCacheEntry{projects: projects, expires: time.Now().Add(pc.ttl)}
+}
+
+// invalidate drops the cached lists of an ArgoCD namespace
+func (pc *projectCache) invalidate(namespace string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.generations[namespace]++
+	for key := range pc.entries {
+		if key.namespace == namespace {
+			delete(pc.entries, key)
+		}
+	}
+}
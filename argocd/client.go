@@ -2,13 +2,15 @@ package argocd
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"golang.org/x/time/rate"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 )
@@ -25,20 +27,124 @@ type Client struct {
 	dynamicClient dynamic.Interface
 	namespace     string
 	gvr           schema.GroupVersionResource
+	options       Options
+	// cache is nil unless Options.ProjectCacheTTL is set
+	cache *projectCache
+	locks *projectLocks
+	// retryBudget is nil unless Options.RetryBudget is set
+	retryBudget *rate.Limiter
 }
 
-// NewClient creates a new ArgoCD client using in-cluster configuration
-func NewClient(namespace string) (*Client, error) {
+// Options configures optional client behavior. The zero value keeps the
+// defaults.
+type Options struct {
+	// MaxDestinations caps the number of destinations a project may have.
+	// Zero means unlimited.
+	MaxDestinations int
+	// QPS and Burst configure client-go's client-side rate limiter.
+	// Zero uses DefaultQPS and DefaultBurst.
+	QPS   float32
+	Burst int
+	// ResolveClusterNames treats a destination naming a cluster and one using
+	// that cluster's server URL as the same destination. Resolving names reads
+	// the ArgoCD cluster secrets on every mutation.
+	ResolveClusterNames bool
+	// ProjectCacheTTL caches ListProjects results for this long. Zero
+	// disables the cache.
+	ProjectCacheTTL time.Duration
+	// PatchStrategy selects how destinations are patched. Empty means
+	// PatchMerge.
+	PatchStrategy PatchStrategy
+	// ArchiveRemovals moves removed destinations into the
+	// ArchivedDestinationsAnnotation instead of dropping them, so they can be
+	// restored until they are purged
+	ArchiveRemovals bool
+	// ScanConcurrency is how many projects or namespaces the cluster-wide
+	// scans (listing, export, destination metrics) process at once. Zero uses
+	// DefaultScanConcurrency.
+	ScanConcurrency int
+	// StrictScans fails a scan when a single project or namespace can't be
+	// read, instead of reporting it alongside the rest of the results
+	StrictScans bool
+	// ProjectLockTimeout serializes the mutations of each project made
+	// through the client, waiting at most this long for the others before
+	// failing with ErrProjectBusy. Zero disables the locking.
+	ProjectLockTimeout time.Duration
+	// ConflictAttempts bounds how often a mutation that retries conflicts
+	// patches the project. Zero uses DefaultConflictAttempts.
+	ConflictAttempts int
+	// RetryBudget caps the conflict retries per second of all mutations
+	// together; once used up, conflicts fail with ErrRetryBudgetExhausted.
+	// Zero means unlimited.
+	RetryBudget float64
+}
+
+// Default client-side rate limits. client-go's own defaults (5 QPS, burst 10)
+// throttle bursts of mutations noticeably, and every mutation is a GET plus a PATCH.
+const (
+	DefaultQPS   = 20
+	DefaultBurst = 40
+)
+
+// DestinationLimitError is returned when adding a destination would exceed
+// Options.MaxDestinations
+type DestinationLimitError struct {
+	Project string
+	Count   int
+	Limit   int
+}
+
+func (e *DestinationLimitError) Error() string {
+	return fmt.Sprintf("project %s already has %d destinations (limit %d)", e.Project, e.Count, e.Limit)
+}
+
+type namespaceKey struct{}
+
+// WithNamespace returns a context that directs client calls to the given
+// ArgoCD namespace instead of the client's default namespace
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NewClient creates a new ArgoCD client using in-cluster configuration.
+// The namespace is used for calls whose context does not carry a namespace.
+func NewClient(namespace string, options Options) (*Client, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
 	}
 
+	config.QPS = DefaultQPS
+	if options.QPS > 0 {
+		config.QPS = options.QPS
+	}
+	config.Burst = DefaultBurst
+	if options.Burst > 0 {
+		config.Burst = options.Burst
+	}
+
 	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	return NewClientWithInterface(dynamicClient, namespace, options), nil
+}
+
+// NewClientWithInterface creates a new ArgoCD client on top of an existing
+// dynamic client, e.g. a fake one from k8s.io/client-go/dynamic/fake. QPS and
+// Burst in options only apply to clients created by NewClient.
+func NewClientWithInterface(dynamicClient dynamic.Interface, namespace string, options Options) *Client {
+	var cache *projectCache
+	if options.ProjectCacheTTL > 0 {
+		cache = newProjectCache(options.ProjectCacheTTL)
+	}
+
+	var locks *projectLocks
+	if options.ProjectLockTimeout > 0 {
+		locks = newProjectLocks(options.ProjectLockTimeout)
+	}
+
 	return &Client{
 		dynamicClient: dynamicClient,
 		namespace:     namespace,
@@ -47,7 +153,36 @@ func NewClient(namespace string) (*Client, error) {
 			Version:  "v1alpha1",
 			Resource: "appprojects",
 		},
-	}, nil
+		options:     options,
+		cache:       cache,
+		locks:       locks,
+		retryBudget: newRetryBudget(options.RetryBudget),
+	}
+}
+
+// NamespaceFromContext returns the ArgoCD namespace set with WithNamespace, or
+// an empty string if ctx doesn't select one
+func NamespaceFromContext(ctx context.Context) string {
+	ns, _ := ctx.Value(namespaceKey{}).(string)
+	return ns
+}
+
+// Namespace returns the ArgoCD namespace that calls with ctx are made against
+func (c *Client) Namespace(ctx context.Context) string {
+	if ns := NamespaceFromContext(ctx); ns != "" {
+		return ns
+	}
+	return c.namespace
+}
+
+// resource returns the AppProject resource interface for the namespace resolved from ctx
+func (c *Client) resource(ctx context.Context) dynamic.ResourceInterface {
+	return c.dynamicClient.Resource(c.gvr).Namespace(c.Namespace(ctx))
+}
+
+// MaxDestinations returns the configured destination limit per project, or zero if unlimited
+func (c *Client) MaxDestinations() int {
+	return c.options.MaxDestinations
 }
 
 // Project represents an ArgoCD AppProject summary
@@ -55,37 +190,122 @@ type Project struct {
 	Name             string        `json:"name"`
 	DestinationCount int           `json:"destinationCount"`
 	Destinations     []Destination `json:"destinations"`
+	// Error is set when the project's destinations couldn't be read
+	Error string `json:"error,omitempty"`
 }
 
-// ListProjects retrieves all AppProjects
-func (c *Client) ListProjects(ctx context.Context) ([]Project, error) {
-	list, err := c.dynamicClient.Resource(c.gvr).Namespace(c.namespace).List(ctx, metav1.ListOptions{})
+// ListProjects retrieves all AppProjects matching the label and field
+// selectors. Empty selectors match every project. AppProjects only support
+// field selectors on metadata.name and metadata.namespace. Results may come
+// from the project cache; the returned slice must not be modified.
+func (c *Client) ListProjects(ctx context.Context, labelSelector, fieldSelector string) ([]Project, error) {
+	if c.cache == nil {
+		return c.listProjects(ctx, labelSelector, fieldSelector)
+	}
+
+	key := projectCacheKey{namespace: c.Namespace(ctx), labelSelector: labelSelector, fieldSelector: fieldSelector}
+	projects, generation, ok := c.cache.get(key)
+	if ok {
+		return projects, nil
+	}
+
+	projects, err := c.listProjects(ctx, labelSelector, fieldSelector)
 	if err != nil {
 		return nil, err
 	}
+	c.cache.put(key, generation, projects)
+	return projects, nil
+}
+
+// listProjects lists the AppProjects from the API server
+func (c *Client) listProjects(ctx context.Context, labelSelector, fieldSelector string) ([]Project, error) {
+	list, err := c.resource(ctx).List(ctx, metav1.ListOptions{LabelSelector: labelSelector, FieldSelector: fieldSelector})
+	if err != nil {
+		return nil, wrapError(err)
+	}
 
-	var projects []Project
-	for _, item := range list.Items {
-		name := item.GetName()
-		destinations, _ := c.extractDestinations(&item)
-		if destinations == nil {
-			destinations = []Destination{}
+	projects, err := c.scanProjects(ctx, list.Items)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if project.Error != "" {
+			log.Printf("Failed to read destinations of project %s: %s", project.Name, project.Error)
 		}
-		projects = append(projects, Project{
-			Name:             name,
-			DestinationCount: len(destinations),
-			Destinations:     destinations,
-		})
 	}
 
 	return projects, nil
 }
 
+// GetProject retrieves the summary of a single AppProject
+func (c *Client) GetProject(ctx context.Context, projectName string) (Project, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return Project{}, wrapError(err)
+	}
+
+	return c.projectFromItem(project), nil
+}
+
+// GetProjectSpec retrieves the spec of an AppProject as stored, including the
+// fields this API doesn't model, along with the resourceVersion. A project
+// without a spec returns an empty one.
+func (c *Client) GetProjectSpec(ctx context.Context, projectName string) (map[string]interface{}, string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+
+	spec, _, err := unstructured.NestedMap(project.Object, "spec")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read spec of project %s: %w", projectName, err)
+	}
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	return spec, project.GetResourceVersion(), nil
+}
+
+// ExportProjects calls fn for every AppProject matching the label selector,
+// listing them pageSize at a time so the full set is never held in memory.
+// Each page is processed concurrently but fn is called in list order. It stops
+// at the first error returned by fn.
+func (c *Client) ExportProjects(ctx context.Context, labelSelector string, pageSize int64, fn func(Project) error) error {
+	opts := metav1.ListOptions{LabelSelector: labelSelector, Limit: pageSize}
+	for {
+		list, err := c.resource(ctx).List(ctx, opts)
+		if err != nil {
+			return wrapError(err)
+		}
+
+		projects, err := c.scanProjects(ctx, list.Items)
+		if err != nil {
+			return err
+		}
+		for _, project := range projects {
+			if err := fn(project); err != nil {
+				return err
+			}
+		}
+
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			return nil
+		}
+	}
+}
+
+// projectFromItem builds the project summary of an AppProject
+func (c *Client) projectFromItem(item *unstructured.Unstructured) Project {
+	project, _ := c.scanProject(item)
+	return project
+}
+
 // GetDestinations retrieves all destinations for an AppProject
 func (c *Client) GetDestinations(ctx context.Context, projectName string) ([]Destination, string, error) {
-	project, err := c.dynamicClient.Resource(c.gvr).Namespace(c.namespace).Get(ctx, projectName, metav1.GetOptions{})
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
 	if err != nil {
-		return nil, "", err
+		return nil, "", wrapError(err)
 	}
 
 	resourceVersion := project.GetResourceVersion()
@@ -97,92 +317,423 @@ func (c *Client) GetDestinations(ctx context.Context, projectName string) ([]Des
 	return destinations, resourceVersion, nil
 }
 
-// AddDestination adds a destination to an AppProject (idempotent)
-func (c *Client) AddDestination(ctx context.Context, projectName string, dest Destination) error {
-	// Get current state
-	destinations, resourceVersion, err := c.GetDestinations(ctx, projectName)
+// GetProjectLabels retrieves the labels of an AppProject
+func (c *Client) GetProjectLabels(ctx context.Context, projectName string) (map[string]string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return nil, wrapError(err)
 	}
 
+	return project.GetLabels(), nil
+}
+
+// Result describes the outcome of a destination mutation
+type Result struct {
+	// Changed is false when the mutation was an idempotent no-op
+	Changed bool
+	// MetadataUpdated is true when an add found the destination already
+	// present and only updated its metadata
+	MetadataUpdated bool
+	// ResourceVersion is the AppProject's resourceVersion after the mutation,
+	// or its current resourceVersion for a no-op
+	ResourceVersion string
+	// Existing is the stored destination an add matched when the project
+	// already had the destination. With Options.ResolveClusterNames it may
+	// refer to the cluster differently than the added destination did.
+	Existing *Destination
+}
+
+// AddDestination adds a destination to an AppProject (idempotent).
+// Result.Changed is false if the destination already existed.
+func (c *Client) AddDestination(ctx context.Context, projectName string, dest Destination) (Result, error) {
+	return c.AddDestinationWithMetadata(ctx, projectName, dest, DestinationMetadata{})
+}
+
+// AddDestinationWithMetadata adds a destination to an AppProject together with
+// its metadata, in the same patch. If the destination already exists, the
+// fields set in meta are merged into its stored metadata instead and
+// Result.MetadataUpdated is true; if that changes nothing, Result.Changed is
+// false. Conflicts are retried like in RemoveDestination.
+func (c *Client) AddDestinationWithMetadata(ctx context.Context, projectName string, dest Destination, meta DestinationMetadata) (Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Get current state
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return Result{}, err
+		}
+
+		result, err := c.addToDestinations(ctx, projectName, dest, meta, matches, rawDestinations, metadata, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return Result{}, err
+		}
+		return result, nil
+	}
+}
+
+// addToDestinations adds a destination to the destinations of an AppProject
+// as read, or updates its metadata if it is already present, and patches the
+// project
+func (c *Client) addToDestinations(ctx context.Context, projectName string, dest Destination, meta DestinationMetadata, matches func(a, b Destination) bool, rawDestinations []interface{}, metadata map[string]DestinationMetadata, base projectBase) (Result, error) {
 	// Check if destination already exists (idempotent)
-	for _, existing := range destinations {
-		if c.destinationsEqual(existing, dest) {
-			return nil // Already exists, nothing to do
+	for _, raw := range rawDestinations {
+		if existing, ok := destinationFromRaw(raw); ok && matches(existing, dest) {
+			return c.updateExistingMetadata(ctx, projectName, existing, meta, rawDestinations, metadata, base)
 		}
 	}
 
+	// Enforce the destination limit
+	if limit := c.options.MaxDestinations; limit > 0 && len(rawDestinations) >= limit {
+		return Result{}, &DestinationLimitError{Project: projectName, Count: len(rawDestinations), Limit: limit}
+	}
+
 	// Add the new destination
-	destinations = append(destinations, dest)
+	rawDestinations = append(rawDestinations, destinationToRaw(dest))
+	if !meta.IsZero() {
+		if metadata == nil {
+			metadata = make(map[string]DestinationMetadata)
+		}
+		metadata[destinationKey(dest)] = meta
+	}
 
 	// Patch the AppProject
-	return c.patchDestinations(ctx, projectName, destinations, resourceVersion)
+	newVersion, err := c.patchDestinations(ctx, projectName, rawDestinations, metadata, base)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Changed: true, ResourceVersion: newVersion}, nil
+}
+
+// updateExistingMetadata merges meta into the stored metadata of a destination
+// an add found already present, patching only if that changes anything
+func (c *Client) updateExistingMetadata(ctx context.Context, projectName string, existing Destination, meta DestinationMetadata, rawDestinations []interface{}, metadata map[string]DestinationMetadata, base projectBase) (Result, error) {
+	key := destinationKey(existing)
+	current := metadata[key]
+	merged := current.Merge(meta)
+	if merged.Equal(current) {
+		return Result{ResourceVersion: base.resourceVersion, Existing: &existing}, nil // Already exists, nothing to do
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]DestinationMetadata)
+	}
+	metadata[key] = merged
+
+	newVersion, err := c.patchDestinations(ctx, projectName, rawDestinations, metadata, base)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Changed: true, MetadataUpdated: true, ResourceVersion: newVersion, Existing: &existing}, nil
 }
 
-// RemoveDestination removes a destination from an AppProject (idempotent)
-func (c *Client) RemoveDestination(ctx context.Context, projectName string, dest Destination) error {
-	// Get current state
-	destinations, resourceVersion, err := c.GetDestinations(ctx, projectName)
+// AddDestinations adds several destinations to an AppProject in a single
+// patch, so either all of them are added or none are. Destinations the project
+// already has are skipped, keeping their metadata; the destinations actually
+// added are returned, with meta stored for each unless it is zero.
+// Result.Changed is false if there was nothing to add. Conflicts are retried
+// like in RemoveDestination.
+func (c *Client) AddDestinations(ctx context.Context, projectName string, dests []Destination, meta DestinationMetadata) ([]Destination, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
 	if err != nil {
-		return err
+		return nil, Result{}, err
 	}
+	defer unlock()
 
-	// Find and remove the destination
-	var newDestinations []Destination
-	found := false
-	for _, existing := range destinations {
-		if c.destinationsEqual(existing, dest) {
-			found = true
-			continue // Skip this one (remove it)
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return nil, Result{}, err
+		}
+
+		var existing []Destination
+		for _, raw := range rawDestinations {
+			if dest, ok := destinationFromRaw(raw); ok {
+				existing = append(existing, dest)
+			}
 		}
-		newDestinations = append(newDestinations, existing)
+
+		var added []Destination
+		for _, dest := range dests {
+			if containsMatch(existing, dest, matches) || containsMatch(added, dest, matches) {
+				continue
+			}
+			added = append(added, dest)
+			rawDestinations = append(rawDestinations, destinationToRaw(dest))
+			if !meta.IsZero() {
+				if metadata == nil {
+					metadata = make(map[string]DestinationMetadata)
+				}
+				metadata[destinationKey(dest)] = meta
+			}
+		}
+		if len(added) == 0 {
+			return nil, Result{ResourceVersion: base.resourceVersion}, nil
+		}
+
+		// Enforce the destination limit for the batch as a whole
+		if limit := c.options.MaxDestinations; limit > 0 && len(rawDestinations) > limit {
+			return nil, Result{}, &DestinationLimitError{Project: projectName, Count: len(rawDestinations) - len(added), Limit: limit}
+		}
+
+		newVersion, err := c.patchDestinations(ctx, projectName, rawDestinations, metadata, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return nil, Result{}, err
+		}
+		return added, Result{Changed: true, ResourceVersion: newVersion}, nil
 	}
+}
 
-	// If not found, nothing to do (idempotent)
-	if !found {
-		return nil
+// RemoveDestination removes a destination from an AppProject (idempotent).
+// Result.Changed is false if the destination didn't exist.
+// If the patch conflicts with a concurrent modification, the project is re-read:
+// a destination that is already gone counts as removed by someone else and is
+// reported like any other absent destination instead of as a conflict.
+func (c *Client) RemoveDestination(ctx context.Context, projectName string, dest Destination) (Result, error) {
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return Result{}, err
 	}
 
-	// Patch the AppProject
-	return c.patchDestinations(ctx, projectName, newDestinations, resourceVersion)
+	_, result, err := c.removeMatching(ctx, projectName, func(existing Destination, _ DestinationMetadata) bool {
+		return matches(existing, dest)
+	})
+	return result, err
 }
 
-// patchDestinations patches the destinations array on an AppProject
-func (c *Client) patchDestinations(ctx context.Context, projectName string, destinations []Destination, resourceVersion string) error {
-	// Build the patch
-	patch := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"resourceVersion": resourceVersion,
-		},
-		"spec": map[string]interface{}{
-			"destinations": destinations,
-		},
+// RemoveDestinationsByServerNamespace removes every destination of an
+// AppProject with the given server and namespace, whatever its name, and
+// returns the removed destinations. Result.Changed is false if none matched.
+// Conflicts are retried like in RemoveDestination.
+func (c *Client) RemoveDestinationsByServerNamespace(ctx context.Context, projectName, server, namespace string) ([]Destination, Result, error) {
+	return c.removeMatching(ctx, projectName, func(existing Destination, _ DestinationMetadata) bool {
+		return existing.Server == server && existing.Namespace == namespace
+	})
+}
+
+// RemoveDestinationsByNamespace removes every destination of an AppProject
+// with the given namespace, on any server, and returns the removed
+// destinations. Result.Changed is false if none matched. Conflicts are
+// retried like in RemoveDestination.
+func (c *Client) RemoveDestinationsByNamespace(ctx context.Context, projectName, namespace string) ([]Destination, Result, error) {
+	return c.removeMatching(ctx, projectName, func(existing Destination, _ DestinationMetadata) bool {
+		return existing.Namespace == namespace
+	})
+}
+
+// RemoveDestinationAt removes the destination at an index of an AppProject's
+// destinations, in stored order and skipping entries this API can't read, and
+// returns it. The removal is based on resourceVersion: it fails with
+// ErrStaleResourceVersion instead of retrying if the project changed, since
+// the index may then point at another destination.
+func (c *Client) RemoveDestinationAt(ctx context.Context, projectName string, index int, resourceVersion string) (Destination, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Destination{}, Result{}, err
 	}
+	defer unlock()
 
-	patchBytes, err := json.Marshal(patch)
+	rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
 	if err != nil {
-		return fmt.Errorf("failed to marshal patch: %w", err)
+		return Destination{}, Result{}, err
+	}
+	if base.resourceVersion != resourceVersion {
+		return Destination{}, Result{}, fmt.Errorf("%w: project %s is at resourceVersion %s", ErrStaleResourceVersion, projectName, base.resourceVersion)
 	}
 
-	_, err = c.dynamicClient.Resource(c.gvr).Namespace(c.namespace).Patch(
+	newDestinations := []interface{}{}
+	var removed []Destination
+	position := 0
+	for _, raw := range rawDestinations {
+		if existing, ok := destinationFromRaw(raw); ok {
+			position++
+			if position-1 == index {
+				removed = append(removed, existing)
+				continue
+			}
+		}
+		newDestinations = append(newDestinations, raw)
+	}
+	if len(removed) == 0 {
+		return Destination{}, Result{}, fmt.Errorf("%w: index %d, project %s has %d destinations", ErrIndexOutOfRange, index, projectName, position)
+	}
+
+	var archive []ArchivedDestination
+	if c.options.ArchiveRemovals {
+		archive = archiveRemoved(archiveOf(base.annotations), removed, metadata, time.Now())
+	}
+	newVersion, err := c.patchDestinationsWithArchive(ctx, projectName, newDestinations, metadata, archive, base)
+	if errors.Is(err, ErrConflict) {
+		return Destination{}, Result{}, fmt.Errorf("%w: %w", ErrStaleResourceVersion, err)
+	}
+	if err != nil {
+		return Destination{}, Result{}, err
+	}
+	return removed[0], Result{Changed: true, ResourceVersion: newVersion}, nil
+}
+
+// removeMatching removes the destinations of an AppProject that match, given
+// their metadata, and returns them, re-reading the project if the patch
+// conflicts. With Options.ArchiveRemovals they are archived in the same patch.
+func (c *Client) removeMatching(ctx context.Context, projectName string, match func(Destination, DestinationMetadata) bool) ([]Destination, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		// Get current state
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return nil, Result{}, err
+		}
+
+		// Find and remove the destinations, keeping the other entries untouched
+		newDestinations := []interface{}{}
+		var removed []Destination
+		for _, raw := range rawDestinations {
+			if existing, ok := destinationFromRaw(raw); ok && match(existing, metadata[destinationKey(existing)]) {
+				removed = append(removed, existing)
+				continue // Skip this one (remove it)
+			}
+			newDestinations = append(newDestinations, raw)
+		}
+
+		// If not found, nothing to do (idempotent)
+		if len(removed) == 0 {
+			return nil, Result{ResourceVersion: base.resourceVersion}, nil
+		}
+
+		// Patch the AppProject, re-reading on conflict. The removed
+		// destinations' metadata is dropped with them, or archived with them
+		// with Options.ArchiveRemovals.
+		var archive []ArchivedDestination
+		if c.options.ArchiveRemovals {
+			archive = archiveRemoved(archiveOf(base.annotations), removed, metadata, time.Now())
+		}
+		newVersion, err := c.patchDestinationsWithArchive(ctx, projectName, newDestinations, metadata, archive, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return nil, Result{}, err
+		}
+		return removed, Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// projectBase is the state of an AppProject a mutation is based on, besides
+// its destinations and their metadata
+type projectBase struct {
+	// resourceVersion makes the patch fail with a conflict if the project
+	// changed since it was read
+	resourceVersion string
+	// annotations tell a JSON patch whether it has to create the
+	// annotations map or remove the metadata annotation
+	annotations map[string]string
+}
+
+// getRawDestinations retrieves the destinations of an AppProject as stored,
+// including fields this API doesn't model, along with their metadata and the
+// state a patch of them is based on
+func (c *Client) getRawDestinations(ctx context.Context, projectName string) ([]interface{}, map[string]DestinationMetadata, projectBase, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, projectBase{}, wrapError(err)
+	}
+
+	rawDestinations, err := rawDestinationsOf(project)
+	if err != nil {
+		return nil, nil, projectBase{}, err
+	}
+
+	base := projectBase{resourceVersion: project.GetResourceVersion(), annotations: project.GetAnnotations()}
+	return rawDestinations, metadataOf(project), base, nil
+}
+
+// patchDestinations patches the destinations array on an AppProject, together
+// with the metadata annotation, and returns the updated resourceVersion. The
+// entries are sent as given so unknown fields on existing entries survive.
+// Metadata of destinations that aren't in the array is dropped. Under
+// WithPatchPreview the patch is recorded instead of sent.
+func (c *Client) patchDestinations(ctx context.Context, projectName string, destinations []interface{}, metadata map[string]DestinationMetadata, base projectBase) (string, error) {
+	return c.patchDestinationsWithArchive(ctx, projectName, destinations, metadata, nil, base)
+}
+
+// patchDestinationsWithArchive patches like patchDestinations and, unless
+// archive is nil, also replaces the archived destinations annotation
+func (c *Client) patchDestinationsWithArchive(ctx context.Context, projectName string, destinations []interface{}, metadata map[string]DestinationMetadata, archive []ArchivedDestination, base projectBase) (string, error) {
+	annotation, err := metadataAnnotationValue(pruneMetadata(metadata, destinations))
+	if err != nil {
+		return "", err
+	}
+	annotations := map[string]interface{}{DestinationMetadataAnnotation: annotation}
+	if archive != nil {
+		if annotations[ArchivedDestinationsAnnotation], err = archiveAnnotationValue(archive); err != nil {
+			return "", err
+		}
+	}
+
+	patchType, patchBytes, err := destinationsPatch(c.options.PatchStrategy, base, destinations, annotations)
+	if err != nil {
+		return "", err
+	}
+
+	if preview, ok := patchPreview(ctx); ok {
+		*preview = PatchPreview{PatchType: patchType, Patch: patchBytes, ResourceVersion: base.resourceVersion}
+		return base.resourceVersion, nil
+	}
+
+	updated, err := c.resource(ctx).Patch(
 		ctx,
 		projectName,
-		types.MergePatchType,
+		patchType,
 		patchBytes,
 		metav1.PatchOptions{},
 	)
+	// A failed patch may still have been applied, e.g. on a timeout
+	c.invalidateCache(ctx)
+	if err != nil {
+		return "", wrapError(err)
+	}
 
-	return err
+	return updated.GetResourceVersion(), nil
 }
 
-// extractDestinations extracts destinations from an unstructured AppProject
-func (c *Client) extractDestinations(project *unstructured.Unstructured) ([]Destination, error) {
+// invalidateCache drops the cached project lists of the ArgoCD namespace of
+// ctx after a mutation
+func (c *Client) invalidateCache(ctx context.Context) {
+	if c.cache != nil {
+		c.cache.invalidate(c.Namespace(ctx))
+	}
+}
+
+// rawDestinationsOf returns spec.destinations of an unstructured AppProject as stored
+func rawDestinationsOf(project *unstructured.Unstructured) ([]interface{}, error) {
 	spec, found, err := unstructured.NestedMap(project.Object, "spec")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get spec: %w", err)
 	}
 	if !found {
-		return []Destination{}, nil
+		return []interface{}{}, nil
 	}
 
 	destinationsRaw, found, err := unstructured.NestedSlice(spec, "destinations")
@@ -190,32 +741,61 @@ func (c *Client) extractDestinations(project *unstructured.Unstructured) ([]Dest
 		return nil, fmt.Errorf("failed to get destinations: %w", err)
 	}
 	if !found {
-		return []Destination{}, nil
+		return []interface{}{}, nil
+	}
+
+	return destinationsRaw, nil
+}
+
+// extractDestinations extracts destinations from an unstructured AppProject
+func (c *Client) extractDestinations(project *unstructured.Unstructured) ([]Destination, error) {
+	destinationsRaw, err := rawDestinationsOf(project)
+	if err != nil {
+		return nil, err
 	}
 
 	var destinations []Destination
 	for _, d := range destinationsRaw {
-		destMap, ok := d.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		dest := Destination{}
-		if server, ok := destMap["server"].(string); ok {
-			dest.Server = server
-		}
-		if namespace, ok := destMap["namespace"].(string); ok {
-			dest.Namespace = namespace
+		if dest, ok := destinationFromRaw(d); ok {
+			destinations = append(destinations, dest)
 		}
-		if name, ok := destMap["name"].(string); ok {
-			dest.Name = name
-		}
-		destinations = append(destinations, dest)
 	}
 
 	return destinations, nil
 }
 
+// destinationFromRaw converts a stored destination entry, ignoring unknown keys
+func destinationFromRaw(raw interface{}) (Destination, bool) {
+	destMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return Destination{}, false
+	}
+
+	dest := Destination{}
+	if server, ok := destMap["server"].(string); ok {
+		dest.Server = server
+	}
+	if namespace, ok := destMap["namespace"].(string); ok {
+		dest.Namespace = namespace
+	}
+	if name, ok := destMap["name"].(string); ok {
+		dest.Name = name
+	}
+	return dest, true
+}
+
+// destinationToRaw converts a destination to the stored entry form
+func destinationToRaw(dest Destination) map[string]interface{} {
+	raw := map[string]interface{}{
+		"server":    dest.Server,
+		"namespace": dest.Namespace,
+	}
+	if dest.Name != "" {
+		raw["name"] = dest.Name
+	}
+	return raw
+}
+
 // destinationsEqual checks if two destinations are equal
 func (c *Client) destinationsEqual(a, b Destination) bool {
 	return a.Server == b.Server && a.Namespace == b.Namespace && a.Name == b.Name
@@ -0,0 +1,307 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "argocd"
+
+var projectGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "appprojects"}
+
+// newTestProject returns an AppProject with the given destinations
+func newTestProject(name string, destinations ...Destination) *unstructured.Unstructured {
+	raw := make([]interface{}, 0, len(destinations))
+	for _, dest := range destinations {
+		raw = append(raw, destinationToRaw(dest))
+	}
+	return newRawTestProject(name, raw)
+}
+
+// newRawTestProject returns an AppProject with destination entries as stored
+func newRawTestProject(name string, destinations []interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "AppProject",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       testNamespace,
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{
+			"destinations": destinations,
+		},
+	}}
+}
+
+// newTestClient returns a client backed by a fake dynamic client holding objects
+func newTestClient(t *testing.T, options Options, objects ...runtime.Object) (*Client, *fake.FakeDynamicClient) {
+	t.Helper()
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		projectGVR: "AppProjectList",
+		secretGVR:  "SecretList",
+	}, objects...)
+	return NewClientWithInterface(dyn, testNamespace, options), dyn
+}
+
+// failPatches makes the first n AppProject patches fail with err, or every
+// patch if n is negative. It returns the number of patches attempted.
+func failPatches(dyn *fake.FakeDynamicClient, n int, err error) *atomic.Int32 {
+	var attempts atomic.Int32
+	dyn.PrependReactor("patch", "appprojects", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if attempt := attempts.Add(1); n < 0 || int(attempt) <= n {
+			return true, nil, err
+		}
+		return false, nil, nil
+	})
+	return &attempts
+}
+
+// conflictError is the error the API server returns for a stale resourceVersion
+func conflictError(project string) error {
+	return apierrors.NewConflict(projectGVR.GroupResource(), project, errors.New("the object has been modified"))
+}
+
+// storedDestinations reads the destinations of a project back from the fake
+func storedDestinations(t *testing.T, client *Client, project string) []Destination {
+	t.Helper()
+	destinations, _, err := client.GetDestinations(context.Background(), project)
+	if err != nil {
+		t.Fatalf("GetDestinations(%s): %v", project, err)
+	}
+	return destinations
+}
+
+var (
+	destProd    = Destination{Server: "https://prod.example.com", Namespace: "app"}
+	destStaging = Destination{Server: "https://staging.example.com", Namespace: "app"}
+)
+
+func TestAddDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		project     string
+		existing    []Destination
+		dest        Destination
+		conflicts   int
+		wantErr     error
+		wantChanged bool
+		want        []Destination
+	}{
+		{
+			name:        "adds a new destination",
+			project:     "team-a",
+			existing:    []Destination{destProd},
+			dest:        destStaging,
+			wantChanged: true,
+			want:        []Destination{destProd, destStaging},
+		},
+		{
+			name:     "existing destination is a no-op",
+			project:  "team-a",
+			existing: []Destination{destProd, destStaging},
+			dest:     destStaging,
+			want:     []Destination{destProd, destStaging},
+		},
+		{
+			name:    "project not found",
+			project: "missing",
+			dest:    destProd,
+			wantErr: ErrProjectNotFound,
+		},
+		{
+			name:      "persistent conflict",
+			project:   "team-a",
+			existing:  []Destination{destProd},
+			dest:      destStaging,
+			conflicts: -1,
+			wantErr:   ErrConflict,
+			want:      []Destination{destProd},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, dyn := newTestClient(t, Options{}, newTestProject("team-a", tt.existing...))
+			if tt.conflicts != 0 {
+				failPatches(dyn, tt.conflicts, conflictError(tt.project))
+			}
+
+			result, err := client.AddDestination(context.Background(), tt.project, tt.dest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddDestination() error = %v, want %v", err, tt.wantErr)
+			}
+			if result.Changed != tt.wantChanged {
+				t.Errorf("AddDestination() Changed = %t, want %t", result.Changed, tt.wantChanged)
+			}
+			if tt.want != nil {
+				if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("stored destinations = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		project     string
+		existing    []Destination
+		dest        Destination
+		conflicts   int
+		wantErr     error
+		wantChanged bool
+		want        []Destination
+	}{
+		{
+			name:        "removes an existing destination",
+			project:     "team-a",
+			existing:    []Destination{destProd, destStaging},
+			dest:        destProd,
+			wantChanged: true,
+			want:        []Destination{destStaging},
+		},
+		{
+			name:     "absent destination is a no-op",
+			project:  "team-a",
+			existing: []Destination{destStaging},
+			dest:     destProd,
+			want:     []Destination{destStaging},
+		},
+		{
+			name:    "project not found",
+			project: "missing",
+			dest:    destProd,
+			wantErr: ErrProjectNotFound,
+		},
+		{
+			name:      "persistent conflict",
+			project:   "team-a",
+			existing:  []Destination{destProd, destStaging},
+			dest:      destProd,
+			conflicts: -1,
+			wantErr:   ErrConflict,
+			want:      []Destination{destProd, destStaging},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, dyn := newTestClient(t, Options{}, newTestProject("team-a", tt.existing...))
+			if tt.conflicts != 0 {
+				failPatches(dyn, tt.conflicts, conflictError(tt.project))
+			}
+
+			result, err := client.RemoveDestination(context.Background(), tt.project, tt.dest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RemoveDestination() error = %v, want %v", err, tt.wantErr)
+			}
+			if result.Changed != tt.wantChanged {
+				t.Errorf("RemoveDestination() Changed = %t, want %t", result.Changed, tt.wantChanged)
+			}
+			if tt.want != nil {
+				if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("stored destinations = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveDestinationConcurrentRemoval(t *testing.T) {
+	client, dyn := newTestClient(t, Options{}, newTestProject("team-a", destProd, destStaging))
+
+	// Another caller removes the destination between our read and our patch,
+	// so the patch conflicts
+	var patches atomic.Int32
+	dyn.PrependReactor("patch", "appprojects", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if patches.Add(1) > 1 {
+			return false, nil, nil
+		}
+		if err := dyn.Tracker().Update(projectGVR, newTestProject("team-a", destStaging), testNamespace); err != nil {
+			t.Errorf("concurrent removal: %v", err)
+		}
+		return true, nil, conflictError("team-a")
+	})
+
+	result, err := client.RemoveDestination(context.Background(), "team-a", destProd)
+	if err != nil {
+		t.Fatalf("RemoveDestination() error = %v, want the concurrent removal to count as success", err)
+	}
+	if result.Changed {
+		t.Errorf("RemoveDestination() Changed = true, want a no-op")
+	}
+	if got := patches.Load(); got != 1 {
+		t.Errorf("patches = %d, want 1", got)
+	}
+	if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, []Destination{destStaging}) {
+		t.Errorf("stored destinations = %v, want [%v]", got, destStaging)
+	}
+}
+
+// storedRawDestinations reads the destination entries of a project back from
+// the fake as stored
+func storedRawDestinations(t *testing.T, dyn *fake.FakeDynamicClient, project string) []interface{} {
+	t.Helper()
+	obj, err := dyn.Tracker().Get(projectGVR, testNamespace, project)
+	if err != nil {
+		t.Fatalf("getting %s: %v", project, err)
+	}
+	raw, _, err := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "spec", "destinations")
+	if err != nil {
+		t.Fatalf("reading destinations of %s: %v", project, err)
+	}
+	return raw
+}
+
+func TestUnknownDestinationFieldsSurvive(t *testing.T) {
+	// Fields a newer ArgoCD may add to destinations, which Destination
+	// doesn't model
+	prod := map[string]interface{}{
+		"server":    destProd.Server,
+		"namespace": destProd.Namespace,
+		"future":    "kept",
+		"options":   map[string]interface{}{"nested": true},
+	}
+	staging := map[string]interface{}{
+		"server":    destStaging.Server,
+		"namespace": destStaging.Namespace,
+		"future":    "also kept",
+	}
+	added := Destination{Server: "https://dev.example.com", Namespace: "app"}
+
+	for _, strategy := range []PatchStrategy{PatchMerge, PatchJSON} {
+		t.Run(string(strategy), func(t *testing.T) {
+			client, dyn := newTestClient(t, Options{PatchStrategy: strategy},
+				newRawTestProject("team-a", []interface{}{prod, staging}))
+			ctx := context.Background()
+
+			if _, err := client.AddDestination(ctx, "team-a", added); err != nil {
+				t.Fatalf("AddDestination() error = %v", err)
+			}
+			want := []interface{}{prod, staging, map[string]interface{}{"server": added.Server, "namespace": added.Namespace}}
+			if got := storedRawDestinations(t, dyn, "team-a"); !reflect.DeepEqual(got, want) {
+				t.Errorf("stored after add = %v, want %v", got, want)
+			}
+
+			if _, err := client.RemoveDestination(ctx, "team-a", destStaging); err != nil {
+				t.Fatalf("RemoveDestination() error = %v", err)
+			}
+			want = []interface{}{prod, want[2]}
+			if got := storedRawDestinations(t, dyn, "team-a"); !reflect.DeepEqual(got, want) {
+				t.Errorf("stored after remove = %v, want %v", got, want)
+			}
+		})
+	}
+}
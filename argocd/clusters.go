@@ -0,0 +1,123 @@
+package argocd
+
+import (
+	"context"
+	"encoding/base64"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterSecretSelector selects the secrets ArgoCD stores registered clusters in
+const clusterSecretSelector = "argocd.argoproj.io/secret-type=cluster"
+
+// ArgoCD always knows the cluster it runs in, even without a cluster secret
+const (
+	InClusterName   = "in-cluster"
+	InClusterServer = "https://kubernetes.default.svc"
+)
+
+var secretGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// Cluster represents a cluster registered with ArgoCD
+type Cluster struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// ListClusters retrieves the clusters registered in the ArgoCD namespace from
+// their cluster secrets
+func (c *Client) ListClusters(ctx context.Context) ([]Cluster, error) {
+	list, err := c.dynamicClient.Resource(secretGVR).Namespace(c.Namespace(ctx)).List(ctx, metav1.ListOptions{
+		LabelSelector: clusterSecretSelector,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	clusters := []Cluster{}
+	for _, item := range list.Items {
+		data, _, _ := unstructured.NestedStringMap(item.Object, "data")
+		cluster := Cluster{
+			Name:   decodeSecretValue(data["name"]),
+			Server: decodeSecretValue(data["server"]),
+		}
+		if cluster.Server != "" {
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters, nil
+}
+
+// clusterServers maps cluster names to server URLs, including the implicit
+// in-cluster cluster unless a cluster secret overrides it
+func (c *Client) clusterServers(ctx context.Context) (map[string]string, error) {
+	clusters, err := c.ListClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := map[string]string{InClusterName: InClusterServer}
+	for _, cluster := range clusters {
+		if cluster.Name != "" {
+			servers[cluster.Name] = cluster.Server
+		}
+	}
+	return servers, nil
+}
+
+// destinationMatcher returns the function deciding whether two destinations
+// target the same place. With Options.ResolveClusterNames, destinations that
+// refer to the same cluster by name and by server are considered equal, as are
+// destinations with the same server of which only one gives a name.
+func (c *Client) destinationMatcher(ctx context.Context) (func(a, b Destination) bool, error) {
+	if !c.options.ResolveClusterNames {
+		return c.destinationsEqual, nil
+	}
+
+	servers, err := c.clusterServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resolve := func(d Destination) string {
+		if d.Server != "" {
+			return d.Server
+		}
+		return servers[d.Name]
+	}
+
+	return func(a, b Destination) bool {
+		if c.destinationsEqual(a, b) {
+			return true
+		}
+		server := resolve(a)
+		return a.Namespace == b.Namespace && server != "" && server == resolve(b)
+	}, nil
+}
+
+// ServerMatcher returns the function deciding whether a destination targets
+// the cluster with the given server URL. With Options.ResolveClusterNames,
+// destinations naming that cluster match too.
+func (c *Client) ServerMatcher(ctx context.Context, server string) (func(Destination) bool, error) {
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(dest Destination) bool {
+		return matches(dest, Destination{Server: server, Namespace: dest.Namespace, Name: dest.Name})
+	}, nil
+}
+
+// decodeSecretValue decodes a base64 secret data value, returning an empty
+// string if it isn't valid base64
+func decodeSecretValue(value string) string {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
@@ -0,0 +1,145 @@
+package argocd
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newClusterSecret returns the secret ArgoCD registers a cluster in
+func newClusterSecret(name, server string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "cluster-" + name,
+			"namespace": testNamespace,
+			"labels":    map[string]interface{}{"argocd.argoproj.io/secret-type": "cluster"},
+		},
+		"data": map[string]interface{}{
+			"name":   base64.StdEncoding.EncodeToString([]byte(name)),
+			"server": base64.StdEncoding.EncodeToString([]byte(server)),
+		},
+	}}
+}
+
+var (
+	byServer     = Destination{Server: "https://prod.example.com", Namespace: "app"}
+	byName       = Destination{Name: "prod", Namespace: "app"}
+	byServerName = Destination{Server: "https://prod.example.com", Name: "prod", Namespace: "app"}
+	inCluster    = Destination{Server: InClusterServer, Namespace: "app"}
+)
+
+func TestDestinationMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		resolve bool
+		a, b    Destination
+		want    bool
+	}{
+		{name: "equal", a: byServer, b: byServer, want: true},
+		{name: "name and server differ without resolving", a: byName, b: byServer},
+		{name: "server only and server with name differ without resolving", a: byServer, b: byServerName},
+		{name: "name resolves to server", resolve: true, a: byName, b: byServer, want: true},
+		{name: "server resolves from name", resolve: true, a: byServer, b: byName, want: true},
+		{name: "server only matches server with name", resolve: true, a: byServer, b: byServerName, want: true},
+		{name: "server with name matches server only", resolve: true, a: byServerName, b: byServer, want: true},
+		{name: "name matches server with name", resolve: true, a: byName, b: byServerName, want: true},
+		{name: "implicit in-cluster name", resolve: true, a: Destination{Name: InClusterName, Namespace: "app"}, b: inCluster, want: true},
+		{name: "different namespace", resolve: true, a: byName, b: Destination{Server: byServer.Server, Namespace: "other"}},
+		{name: "unregistered name", resolve: true, a: Destination{Name: "staging", Namespace: "app"}, b: byServer},
+		{name: "different server", resolve: true, a: byName, b: Destination{Server: "https://staging.example.com", Namespace: "app"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, Options{ResolveClusterNames: tt.resolve}, newClusterSecret("prod", byServer.Server))
+			matches, err := client.destinationMatcher(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matches(tt.a, tt.b); got != tt.want {
+				t.Errorf("matches(%v, %v) = %t, want %t", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveClusterNamesMutations(t *testing.T) {
+	objects := func(stored ...Destination) []runtime.Object {
+		return []runtime.Object{newTestProject("team-a", stored...), newClusterSecret("prod", byServer.Server)}
+	}
+
+	t.Run("remove by server removes the entry by name", func(t *testing.T) {
+		client, _ := newTestClient(t, Options{ResolveClusterNames: true}, objects(byName, destStaging)...)
+		result, err := client.RemoveDestination(context.Background(), "team-a", byServer)
+		if err != nil || !result.Changed {
+			t.Fatalf("RemoveDestination() = %+v, %v, want the named entry removed", result, err)
+		}
+		if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, []Destination{destStaging}) {
+			t.Errorf("stored destinations = %v, want [%v]", got, destStaging)
+		}
+	})
+
+	t.Run("remove by name removes the entry by server", func(t *testing.T) {
+		client, _ := newTestClient(t, Options{ResolveClusterNames: true}, objects(byServer)...)
+		if result, err := client.RemoveDestination(context.Background(), "team-a", byName); err != nil || !result.Changed {
+			t.Fatalf("RemoveDestination() = %+v, %v, want the entry removed", result, err)
+		}
+	})
+
+	t.Run("without resolving, remove by server leaves the entry by name", func(t *testing.T) {
+		client, _ := newTestClient(t, Options{}, objects(byName)...)
+		if result, err := client.RemoveDestination(context.Background(), "team-a", byServer); err != nil || result.Changed {
+			t.Fatalf("RemoveDestination() = %+v, %v, want a no-op", result, err)
+		}
+	})
+}
+
+func TestAddDuplicateInAnotherForm(t *testing.T) {
+	tests := []struct {
+		name        string
+		resolve     bool
+		stored      Destination
+		add         Destination
+		wantChanged bool
+	}{
+		{name: "server only when server with name is stored", resolve: true, stored: byServerName, add: byServer},
+		{name: "server with name when server only is stored", resolve: true, stored: byServer, add: byServerName},
+		{name: "name when server is stored", resolve: true, stored: byServer, add: byName},
+		{name: "server when name is stored", resolve: true, stored: byName, add: byServer},
+		{name: "server only is added without resolving", stored: byServerName, add: byServer, wantChanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, Options{ResolveClusterNames: tt.resolve},
+				newTestProject("team-a", tt.stored), newClusterSecret("prod", byServer.Server))
+
+			result, err := client.AddDestination(context.Background(), "team-a", tt.add)
+			if err != nil {
+				t.Fatalf("AddDestination() error = %v", err)
+			}
+			if result.Changed != tt.wantChanged {
+				t.Errorf("AddDestination() Changed = %t, want %t", result.Changed, tt.wantChanged)
+			}
+
+			want := []Destination{tt.stored}
+			if tt.wantChanged {
+				want = append(want, tt.add)
+				if result.Existing != nil {
+					t.Errorf("Existing = %v, want none", *result.Existing)
+				}
+			} else if result.Existing == nil || *result.Existing != tt.stored {
+				t.Errorf("Existing = %v, want the stored %v", result.Existing, tt.stored)
+			}
+			if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, want) {
+				t.Errorf("stored destinations = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package argocd
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ProjectDetails is an AppProject with every part of its spec this API
+// manages, in addition to the destination summary of Project. Lists the
+// project doesn't set are empty; malformed entries are left out.
+type ProjectDetails struct {
+	Project
+	ProjectSettings
+	Description                string       `json:"description,omitempty"`
+	SourceRepos                []string     `json:"sourceRepos"`
+	Roles                      []Role       `json:"roles"`
+	ClusterResourceWhitelist   []GroupKind  `json:"clusterResourceWhitelist"`
+	NamespaceResourceWhitelist []GroupKind  `json:"namespaceResourceWhitelist"`
+	NamespaceResourceBlacklist []GroupKind  `json:"namespaceResourceBlacklist"`
+	SyncWindows                []SyncWindow `json:"syncWindows"`
+	SignatureKeys              []string     `json:"signatureKeys"`
+	ResourceVersion            string       `json:"resourceVersion"`
+}
+
+// GetProjectDetails retrieves an AppProject with every part of its spec this
+// API manages, read from a single version of the project
+func (c *Client) GetProjectDetails(ctx context.Context, projectName string) (ProjectDetails, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return ProjectDetails{}, wrapError(err)
+	}
+
+	// Fields of the wrong type read as empty, like malformed entries
+	list := func(field string) []interface{} {
+		values, _, _ := unstructured.NestedSlice(project.Object, "spec", field)
+		return values
+	}
+	description, _, _ := unstructured.NestedString(project.Object, "spec", "description")
+
+	return ProjectDetails{
+		Project:                    c.projectFromItem(project),
+		ProjectSettings:            projectSettings(project),
+		Description:                description,
+		SourceRepos:                stringList(list("sourceRepos")),
+		Roles:                      parseRoles(list("roles")),
+		ClusterResourceWhitelist:   parseResources(list(string(ClusterResourceWhitelist))),
+		NamespaceResourceWhitelist: parseResources(list(string(NamespaceResourceWhitelist))),
+		NamespaceResourceBlacklist: parseResources(list(string(NamespaceResourceBlacklist))),
+		SyncWindows:                parseSyncWindows(list("syncWindows")),
+		SignatureKeys:              parseSignatureKeys(list("signatureKeys")),
+		ResourceVersion:            project.GetResourceVersion(),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package argocd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Errors returned by Client methods. They wrap the underlying Kubernetes API
+// error, so callers can check them with errors.Is without depending on the
+// Kubernetes error package.
+var (
+	ErrProjectNotFound = errors.New("project not found")
+	ErrConflict        = errors.New("project was modified concurrently")
+	ErrForbidden       = errors.New("access to project denied")
+	ErrThrottled       = errors.New("kubernetes API server is throttling requests")
+	ErrProjectExists   = errors.New("project already exists")
+)
+
+// ErrProjectBusy is returned when a mutation waited longer than
+// Options.ProjectLockTimeout for other mutations of the same project
+var ErrProjectBusy = errors.New("project is busy with other changes")
+
+// ErrRetryBudgetExhausted is returned when a conflicting mutation would have
+// been retried, but Options.RetryBudget allows no more retries right now
+var ErrRetryBudgetExhausted = errors.New("conflict retry budget exhausted")
+
+// ErrDestinationNotFound is returned when an operation targets a destination
+// the project doesn't have
+var ErrDestinationNotFound = errors.New("destination not found")
+
+// ErrDestinationNotArchived is returned when restoring a destination the
+// project's archive doesn't hold
+var ErrDestinationNotArchived = errors.New("destination not archived")
+
+// ErrStaleResourceVersion is returned when a mutation based on a
+// resourceVersion finds the project changed since
+var ErrStaleResourceVersion = errors.New("project changed since the given resourceVersion")
+
+// ErrIndexOutOfRange is returned when a removal by index targets a position
+// past the end of the project's destinations
+var ErrIndexOutOfRange = errors.New("destination index out of range")
+
+// wrapError maps a Kubernetes API error to the matching sentinel error
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case k8serrors.IsNotFound(err):
+		return fmt.Errorf("%w: %w", ErrProjectNotFound, err)
+	case k8serrors.IsAlreadyExists(err):
+		return fmt.Errorf("%w: %w", ErrProjectExists, err)
+	case k8serrors.IsConflict(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case k8serrors.IsForbidden(err):
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case k8serrors.IsTooManyRequests(err):
+		return fmt.Errorf("%w: %w", ErrThrottled, err)
+	default:
+		return err
+	}
+}
+
+// RetryAfter returns how long the API server asked the client to wait before
+// retrying, if the error carries such a hint
+func RetryAfter(err error) (time.Duration, bool) {
+	seconds, ok := k8serrors.SuggestsClientDelay(err)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,54 @@
+package argocd
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProjectsWithExpiredDestinations returns the names of the AppProjects whose
+// metadata records at least one destination that expired by now
+func (c *Client) ProjectsWithExpiredDestinations(ctx context.Context, now time.Time) ([]string, error) {
+	list, err := c.resource(ctx).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var names []string
+	for i := range list.Items {
+		for _, meta := range metadataOf(&list.Items[i]) {
+			if meta.Expired(now) {
+				names = append(names, list.Items[i].GetName())
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// RemoveExpiredDestinations removes the destinations of an AppProject that
+// expired by now and returns them with their metadata. Conflicts with
+// concurrent modifications are retried like in RemoveDestination, re-checking
+// the expiry against the re-read metadata. Result.Changed is false if none
+// had expired.
+func (c *Client) RemoveExpiredDestinations(ctx context.Context, projectName string, now time.Time) ([]DestinationDetails, Result, error) {
+	expired := make(map[string]DestinationMetadata)
+	removed, result, err := c.removeMatching(ctx, projectName, func(dest Destination, meta DestinationMetadata) bool {
+		if !meta.Expired(now) {
+			return false
+		}
+		expired[destinationKey(dest)] = meta
+		return true
+	})
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	details := make([]DestinationDetails, 0, len(removed))
+	for _, dest := range removed {
+		meta := expired[destinationKey(dest)]
+		details = append(details, DestinationDetails{Destination: dest, Metadata: &meta})
+	}
+	return details, result, nil
+}
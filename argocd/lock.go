@@ -0,0 +1,86 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// projectLocks serializes the mutations this process makes to the same
+// AppProject. Every mutation reads the project, modifies it and patches it
+// conditioned on the resourceVersion it read, so concurrent mutations of one
+// project would mostly conflict and retry. Mutations of different projects
+// proceed in parallel. Other replicas still conflict, and are retried as before.
+type projectLocks struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*projectLock
+}
+
+// projectLock is held by one mutation at a time. refs counts the mutations
+// holding or waiting for it, so it can be dropped once unused.
+type projectLock struct {
+	held chan struct{}
+	refs int
+}
+
+func newProjectLocks(timeout time.Duration) *projectLocks {
+	return &projectLocks{timeout: timeout, locks: make(map[string]*projectLock)}
+}
+
+// acquire waits up to the timeout for the lock of a project and returns the
+// function releasing it. It returns ErrProjectBusy if the lock is held for
+// longer, or the context's error if it ends first.
+func (pl *projectLocks) acquire(ctx context.Context, key string) (func(), error) {
+	pl.mu.Lock()
+	lock, ok := pl.locks[key]
+	if !ok {
+		lock = &projectLock{held: make(chan struct{}, 1)}
+		pl.locks[key] = lock
+	}
+	lock.refs++
+	pl.mu.Unlock()
+
+	timer := time.NewTimer(pl.timeout)
+	defer timer.Stop()
+
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			pl.release(key, lock)
+		}, nil
+	case <-timer.C:
+		pl.release(key, lock)
+		metrics.ProjectLockTimeouts.Inc()
+		return nil, fmt.Errorf("%w: waited %s for other changes to %s", ErrProjectBusy, pl.timeout, key)
+	case <-ctx.Done():
+		pl.release(key, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// release drops a reference to a lock, forgetting the lock once unused
+func (pl *projectLocks) release(key string, lock *projectLock) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(pl.locks, key)
+	}
+}
+
+// lockProject serializes a mutation of a project with the others this client
+// makes, if Options.ProjectLockTimeout is set. The returned function must be
+// called once the mutation is done.
+func (c *Client) lockProject(ctx context.Context, projectName string) (func(), error) {
+	if c.locks == nil {
+		return func() {}, nil
+	}
+	return c.locks.acquire(ctx, c.Namespace(ctx)+"/"+projectName)
+}
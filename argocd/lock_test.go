@@ -0,0 +1,192 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// enforceResourceVersions makes the fake reject merge patches based on a
+// stale resourceVersion with a conflict, and bump the resourceVersion of
+// every patched project, like the API server. It returns the number of
+// conflicts.
+func enforceResourceVersions(dyn *fake.FakeDynamicClient) *atomic.Int32 {
+	var conflicts atomic.Int32
+	dyn.PrependReactor("patch", "appprojects", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		var body struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(patch.GetPatch(), &body); err != nil {
+			return true, nil, err
+		}
+
+		current, err := dyn.Tracker().Get(projectGVR, patch.GetNamespace(), patch.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		version := current.(*unstructured.Unstructured).GetResourceVersion()
+		if body.Metadata.ResourceVersion != "" && body.Metadata.ResourceVersion != version {
+			conflicts.Add(1)
+			return true, nil, conflictError(patch.GetName())
+		}
+
+		_, obj, err := k8stesting.ObjectReaction(dyn.Tracker())(action)
+		if err != nil {
+			return true, nil, err
+		}
+		updated := obj.(*unstructured.Unstructured)
+		n, _ := strconv.Atoi(version)
+		updated.SetResourceVersion(strconv.Itoa(n + 1))
+		return true, updated, dyn.Tracker().Update(projectGVR, updated, patch.GetNamespace())
+	})
+	return &conflicts
+}
+
+// barrierReads wraps a dynamic client so that the first n AppProject reads
+// wait for each other before returning, up to a timeout. Concurrent mutations
+// thus all read the same resourceVersion before any of them patches, unless
+// something serializes them.
+type barrierReads struct {
+	dynamic.Interface
+	reads   atomic.Int32
+	n       int32
+	arrived sync.WaitGroup
+	timeout time.Duration
+}
+
+func newBarrierReads(dyn dynamic.Interface, n int, timeout time.Duration) *barrierReads {
+	b := &barrierReads{Interface: dyn, n: int32(n), timeout: timeout}
+	b.arrived.Add(n)
+	return b
+}
+
+func (b *barrierReads) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return barrierResource{b.Interface.Resource(gvr), b}
+}
+
+type barrierResource struct {
+	dynamic.NamespaceableResourceInterface
+	barrier *barrierReads
+}
+
+func (r barrierResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return barrierNamespace{r.NamespaceableResourceInterface.Namespace(namespace), r.barrier}
+}
+
+type barrierNamespace struct {
+	dynamic.ResourceInterface
+	barrier *barrierReads
+}
+
+func (r barrierNamespace) Get(ctx context.Context, name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj, err := r.ResourceInterface.Get(ctx, name, options, subresources...)
+	if r.barrier.reads.Add(1) <= r.barrier.n {
+		r.barrier.arrived.Done()
+		released := make(chan struct{})
+		go func() {
+			r.barrier.arrived.Wait()
+			close(released)
+		}()
+		select {
+		case <-released:
+		case <-time.After(r.barrier.timeout):
+		}
+	}
+	return obj, err
+}
+
+// addConcurrently adds n destinations to team-a from n goroutines
+func addConcurrently(t *testing.T, client *Client, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dest := Destination{Server: "https://prod.example.com", Namespace: fmt.Sprintf("app-%d", i)}
+			if _, err := client.AddDestination(context.Background(), "team-a", dest); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AddDestination() error = %v", err)
+	}
+	if got := storedDestinations(t, client, "team-a"); len(got) != n {
+		t.Errorf("stored %d destinations, want %d", len(got), n)
+	}
+}
+
+func TestProjectLockPreventsConflicts(t *testing.T) {
+	const writers = 8
+	tests := []struct {
+		name          string
+		options       Options
+		wantConflicts bool
+	}{
+		{"without lock", Options{ConflictAttempts: writers}, true},
+		{"with lock", Options{ProjectLockTimeout: 10 * time.Second}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dyn := newTestClient(t, Options{}, newTestProject("team-a"))
+			conflicts := enforceResourceVersions(dyn)
+			// With the lock, only one read at a time reaches the barrier, which
+			// then waits out the short timeout
+			client := NewClientWithInterface(newBarrierReads(dyn, writers, 20*time.Millisecond), testNamespace, tt.options)
+			retries := testutil.ToFloat64(metrics.ConflictRetries)
+
+			addConcurrently(t, client, writers)
+			gotRetries := testutil.ToFloat64(metrics.ConflictRetries) - retries
+			if tt.wantConflicts {
+				if conflicts.Load() < writers-1 || gotRetries < writers-1 {
+					t.Errorf("conflicts = %d, retries = %g, want at least %d", conflicts.Load(), gotRetries, writers-1)
+				}
+				return
+			}
+			if conflicts.Load() != 0 || gotRetries != 0 {
+				t.Errorf("conflicts = %d, retries = %g, want 0", conflicts.Load(), gotRetries)
+			}
+		})
+	}
+}
+
+func TestProjectLockTimeout(t *testing.T) {
+	client, _ := newTestClient(t, Options{ProjectLockTimeout: 10 * time.Millisecond}, newTestProject("team-a"))
+
+	unlock, err := client.lockProject(context.Background(), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if _, err := client.AddDestination(context.Background(), "team-a", destProd); !errors.Is(err, ErrProjectBusy) {
+		t.Fatalf("AddDestination() error = %v, want ErrProjectBusy", err)
+	}
+	if _, err := client.AddDestination(context.Background(), "team-b", destProd); errors.Is(err, ErrProjectBusy) {
+		t.Fatalf("AddDestination() to another project waited for the lock: %v", err)
+	}
+}
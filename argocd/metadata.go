@@ -0,0 +1,198 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DestinationMetadataAnnotation is the AppProject annotation holding the
+// metadata of its destinations, as a JSON object keyed by destination identity.
+// ArgoCD destinations have no free-form field to store it on.
+const DestinationMetadataAnnotation = "argocd-destination-api/destination-metadata"
+
+// DestinationMetadata records who owns a destination, why it exists and, for
+// temporary destinations, when it expires
+type DestinationMetadata struct {
+	Owner     string     `json:"owner,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// IsZero reports whether the metadata records nothing
+func (m DestinationMetadata) IsZero() bool {
+	return m.Owner == "" && m.Reason == "" && m.ExpiresAt == nil
+}
+
+// Equal reports whether two metadata record the same values
+func (m DestinationMetadata) Equal(other DestinationMetadata) bool {
+	if m.Owner != other.Owner || m.Reason != other.Reason {
+		return false
+	}
+	if m.ExpiresAt == nil || other.ExpiresAt == nil {
+		return m.ExpiresAt == other.ExpiresAt
+	}
+	return m.ExpiresAt.Equal(*other.ExpiresAt)
+}
+
+// Merge returns the metadata with the fields set in other replacing its own
+func (m DestinationMetadata) Merge(other DestinationMetadata) DestinationMetadata {
+	if other.Owner != "" {
+		m.Owner = other.Owner
+	}
+	if other.Reason != "" {
+		m.Reason = other.Reason
+	}
+	if other.ExpiresAt != nil {
+		m.ExpiresAt = other.ExpiresAt
+	}
+	return m
+}
+
+// Expired reports whether the destination has an expiry that is not after now
+func (m DestinationMetadata) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// DestinationDetails is a destination together with its metadata, if any
+type DestinationDetails struct {
+	Destination
+	Metadata *DestinationMetadata `json:"metadata,omitempty"`
+}
+
+// GetDestinationDetails retrieves all destinations of an AppProject with their
+// metadata, along with the resourceVersion
+func (c *Client) GetDestinationDetails(ctx context.Context, projectName string) ([]DestinationDetails, string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+
+	destinations, err := c.extractDestinations(project)
+	if err != nil {
+		return nil, "", err
+	}
+
+	metadata := metadataOf(project)
+	details := make([]DestinationDetails, 0, len(destinations))
+	for _, dest := range destinations {
+		d := DestinationDetails{Destination: dest}
+		if meta, ok := metadata[destinationKey(dest)]; ok {
+			d.Metadata = &meta
+		}
+		details = append(details, d)
+	}
+
+	return details, project.GetResourceVersion(), nil
+}
+
+// SetDestinationMetadata stores the metadata of an existing destination of an
+// AppProject, replacing any metadata it had. Zero metadata removes the entry.
+// It returns ErrDestinationNotFound if the project has no such destination.
+// Conflicts are retried like in RemoveDestination.
+func (c *Client) SetDestinationMetadata(ctx context.Context, projectName string, dest Destination, meta DestinationMetadata) (Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return Result{}, err
+		}
+
+		// Key the metadata by the destination as stored, which may differ from
+		// dest when cluster names are resolved
+		key := ""
+		for _, raw := range rawDestinations {
+			if existing, ok := destinationFromRaw(raw); ok && matches(existing, dest) {
+				key = destinationKey(existing)
+				break
+			}
+		}
+		if key == "" {
+			return Result{}, fmt.Errorf("%w: %s", ErrDestinationNotFound, projectName)
+		}
+
+		// Nothing to do if the stored metadata already matches
+		if current, exists := metadata[key]; (exists && current.Equal(meta)) || (!exists && meta.IsZero()) {
+			return Result{ResourceVersion: base.resourceVersion}, nil
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]DestinationMetadata)
+		}
+		if meta.IsZero() {
+			delete(metadata, key)
+		} else {
+			metadata[key] = meta
+		}
+
+		newVersion, err := c.patchDestinations(ctx, projectName, rawDestinations, metadata, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return Result{}, err
+		}
+		return Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// destinationKey identifies a destination in the metadata annotation
+func destinationKey(dest Destination) string {
+	return dest.Server + "|" + dest.Namespace + "|" + dest.Name
+}
+
+// metadataOf returns the destination metadata stored on an AppProject. An
+// annotation that can't be parsed is treated as empty and is replaced by the
+// next mutation.
+func metadataOf(project *unstructured.Unstructured) map[string]DestinationMetadata {
+	value, ok := project.GetAnnotations()[DestinationMetadataAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var metadata map[string]DestinationMetadata
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
+
+// pruneMetadata returns the metadata of the destinations in rawDestinations
+func pruneMetadata(metadata map[string]DestinationMetadata, rawDestinations []interface{}) map[string]DestinationMetadata {
+	pruned := make(map[string]DestinationMetadata)
+	for _, raw := range rawDestinations {
+		if dest, ok := destinationFromRaw(raw); ok {
+			if meta, ok := metadata[destinationKey(dest)]; ok {
+				pruned[destinationKey(dest)] = meta
+			}
+		}
+	}
+	return pruned
+}
+
+// metadataAnnotationValue returns the merge patch value of the metadata
+// annotation: the encoded metadata, or nil to remove the annotation when empty
+func metadataAnnotationValue(metadata map[string]DestinationMetadata) (interface{}, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal destination metadata: %w", err)
+	}
+	return string(data), nil
+}
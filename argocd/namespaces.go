@@ -0,0 +1,34 @@
+package argocd
+
+import (
+	"context"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// NamespaceExists reports whether a namespace exists in the cluster this
+// service runs in. Remote clusters can't be checked, as that would need their
+// credentials.
+func (c *Client) NamespaceExists(ctx context.Context, name string) (bool, error) {
+	_, err := c.dynamicClient.Resource(namespaceGVR).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return true, nil
+}
+
+// IsInCluster reports whether a destination targets the cluster ArgoCD runs
+// in, by server URL or by cluster name
+func IsInCluster(dest Destination) bool {
+	if dest.Server != "" {
+		return dest.Server == InClusterServer
+	}
+	return dest.Name == InClusterName
+}
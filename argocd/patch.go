@@ -0,0 +1,160 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PatchStrategy selects the patch type used to update AppProject destinations
+type PatchStrategy string
+
+const (
+	// PatchMerge sends a JSON merge patch (RFC 7386) replacing the
+	// destinations array
+	PatchMerge PatchStrategy = "merge"
+	// PatchJSON sends a JSON patch (RFC 6902) whose operations address the
+	// destinations array and the metadata annotation explicitly, for API
+	// servers whose merge patch handling misbehaves
+	PatchJSON PatchStrategy = "json"
+)
+
+// ParsePatchStrategy parses a patch strategy name. Strategic merge patches
+// are not offered: Kubernetes rejects them for custom resources such as
+// AppProjects.
+func ParsePatchStrategy(name string) (PatchStrategy, error) {
+	switch strategy := PatchStrategy(name); strategy {
+	case PatchMerge, PatchJSON:
+		return strategy, nil
+	case "strategic":
+		return "", fmt.Errorf("strategic merge patches are not supported for custom resources such as AppProject; use %q or %q", PatchMerge, PatchJSON)
+	default:
+		return "", fmt.Errorf("unknown patch strategy %q; use %q or %q", name, PatchMerge, PatchJSON)
+	}
+}
+
+// PatchPreview is the patch a mutation would have sent to Kubernetes
+type PatchPreview struct {
+	PatchType       types.PatchType `json:"patchType"`
+	Patch           json.RawMessage `json:"patch"`
+	ResourceVersion string          `json:"resourceVersion"`
+}
+
+type previewKey struct{}
+
+// WithPatchPreview returns a context in which client mutations build their
+// patch and record it in the returned preview instead of sending it. The
+// preview stays empty if the mutation has nothing to change.
+func WithPatchPreview(ctx context.Context) (context.Context, *PatchPreview) {
+	preview := &PatchPreview{}
+	return context.WithValue(ctx, previewKey{}, preview), preview
+}
+
+// patchPreview returns the preview requested by ctx, if any
+func patchPreview(ctx context.Context) (*PatchPreview, bool) {
+	preview, ok := ctx.Value(previewKey{}).(*PatchPreview)
+	return preview, ok
+}
+
+// jsonPatchOp is a single JSON patch operation
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// destinationsPatch builds the patch setting the destinations and the given
+// annotations, removing those whose value is nil. Annotations not given are
+// left untouched. Either way the patch carries the base resourceVersion, so it
+// fails with a conflict if the project changed since it was read.
+func destinationsPatch(strategy PatchStrategy, base projectBase, destinations []interface{}, annotations map[string]interface{}) (types.PatchType, []byte, error) {
+	var patchType types.PatchType
+	var patch interface{}
+
+	switch strategy {
+	case PatchJSON:
+		patchType = types.JSONPatchType
+		patch = destinationsJSONPatch(base, destinations, annotations)
+	case PatchMerge, "":
+		patchType = types.MergePatchType
+		patch = map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"resourceVersion": base.resourceVersion,
+				"annotations":     annotations,
+			},
+			"spec": map[string]interface{}{
+				"destinations": destinations,
+			},
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown patch strategy %q", strategy)
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return patchType, patchBytes, nil
+}
+
+// destinationsJSONPatch returns the JSON patch operations of destinationsPatch.
+// Unlike a merge patch, a JSON patch fails on paths that don't exist, so the
+// annotation operations depend on the annotations the project had.
+func destinationsJSONPatch(base projectBase, destinations []interface{}, annotations map[string]interface{}) []jsonPatchOp {
+	ops := []jsonPatchOp{
+		{Op: "replace", Path: "/metadata/resourceVersion", Value: base.resourceVersion},
+		{Op: "add", Path: "/spec/destinations", Value: destinations},
+	}
+	return append(ops, mapPatchOps("/metadata/annotations", base.annotations, annotations)...)
+}
+
+// mapPatchOps returns the JSON patch operations setting the given keys of the
+// string map at path, removing those whose value is nil. stored is the map as
+// the project had it.
+func mapPatchOps(path string, stored map[string]string, values map[string]interface{}) []jsonPatchOp {
+	// Without a map there is nothing to remove, and the values to set have
+	// to be added as a new map
+	if stored == nil {
+		set := make(map[string]interface{})
+		for key, value := range values {
+			if value != nil {
+				set[key] = value
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		return []jsonPatchOp{{Op: "add", Path: path, Value: set}}
+	}
+
+	// Sort the keys so the same change always produces the same patch
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ops []jsonPatchOp
+	for _, key := range keys {
+		keyPath := path + "/" + escapeJSONPointer(key)
+		_, present := stored[key]
+		switch value := values[key]; {
+		case value == nil && present:
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: keyPath})
+		case value == nil:
+			// Nothing to remove
+		default:
+			ops = append(ops, jsonPatchOp{Op: "add", Path: keyPath, Value: value})
+		}
+	}
+	return ops
+}
+
+// escapeJSONPointer escapes a key for use as a JSON pointer (RFC 6901) token
+func escapeJSONPointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
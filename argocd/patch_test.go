@@ -0,0 +1,145 @@
+package argocd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDestinationsPatch(t *testing.T) {
+	destinations := []interface{}{
+		map[string]interface{}{"server": "https://prod.example.com", "namespace": "app", "extra": "kept"},
+	}
+	metadata := `{"https://prod.example.com/app":{"owner":"team-a"}}`
+
+	tests := []struct {
+		name        string
+		strategy    PatchStrategy
+		stored      map[string]string
+		annotations map[string]interface{}
+		wantType    types.PatchType
+		want        string
+	}{
+		{
+			name:        "merge sets the metadata annotation",
+			strategy:    PatchMerge,
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: metadata},
+			wantType:    types.MergePatchType,
+			want: `{"metadata":{"annotations":{"argocd-destination-api/destination-metadata":"{\"https://prod.example.com/app\":{\"owner\":\"team-a\"}}"},"resourceVersion":"7"},` +
+				`"spec":{"destinations":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]}}`,
+		},
+		{
+			name:        "merge removes the metadata annotation with null",
+			strategy:    PatchMerge,
+			stored:      map[string]string{DestinationMetadataAnnotation: metadata},
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: nil},
+			wantType:    types.MergePatchType,
+			want: `{"metadata":{"annotations":{"argocd-destination-api/destination-metadata":null},"resourceVersion":"7"},` +
+				`"spec":{"destinations":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]}}`,
+		},
+		{
+			name:        "merge is the default",
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: nil},
+			wantType:    types.MergePatchType,
+			want: `{"metadata":{"annotations":{"argocd-destination-api/destination-metadata":null},"resourceVersion":"7"},` +
+				`"spec":{"destinations":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]}}`,
+		},
+		{
+			name:        "json adds the annotations map",
+			strategy:    PatchJSON,
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: metadata},
+			wantType:    types.JSONPatchType,
+			want: `[{"op":"replace","path":"/metadata/resourceVersion","value":"7"},` +
+				`{"op":"add","path":"/spec/destinations","value":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]},` +
+				`{"op":"add","path":"/metadata/annotations","value":{"argocd-destination-api/destination-metadata":"{\"https://prod.example.com/app\":{\"owner\":\"team-a\"}}"}}]`,
+		},
+		{
+			name:        "json adds to existing annotations",
+			strategy:    PatchJSON,
+			stored:      map[string]string{"team": "a"},
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: metadata},
+			wantType:    types.JSONPatchType,
+			want: `[{"op":"replace","path":"/metadata/resourceVersion","value":"7"},` +
+				`{"op":"add","path":"/spec/destinations","value":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]},` +
+				`{"op":"add","path":"/metadata/annotations/argocd-destination-api~1destination-metadata","value":"{\"https://prod.example.com/app\":{\"owner\":\"team-a\"}}"}]`,
+		},
+		{
+			name:        "json removes a null annotation",
+			strategy:    PatchJSON,
+			stored:      map[string]string{DestinationMetadataAnnotation: metadata},
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: nil},
+			wantType:    types.JSONPatchType,
+			want: `[{"op":"replace","path":"/metadata/resourceVersion","value":"7"},` +
+				`{"op":"add","path":"/spec/destinations","value":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]},` +
+				`{"op":"remove","path":"/metadata/annotations/argocd-destination-api~1destination-metadata"}]`,
+		},
+		{
+			name:        "json skips a null annotation that isn't stored",
+			strategy:    PatchJSON,
+			stored:      map[string]string{"team": "a"},
+			annotations: map[string]interface{}{DestinationMetadataAnnotation: nil},
+			wantType:    types.JSONPatchType,
+			want: `[{"op":"replace","path":"/metadata/resourceVersion","value":"7"},` +
+				`{"op":"add","path":"/spec/destinations","value":[{"extra":"kept","namespace":"app","server":"https://prod.example.com"}]}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := projectBase{resourceVersion: "7", annotations: tt.stored}
+			patchType, patch, err := destinationsPatch(tt.strategy, base, destinations, tt.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patchType != tt.wantType {
+				t.Errorf("patch type = %s, want %s", patchType, tt.wantType)
+			}
+			if string(patch) != tt.want {
+				t.Errorf("patch =\n%s\nwant\n%s", patch, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestinationsPatchUnknownStrategy(t *testing.T) {
+	if _, _, err := destinationsPatch("strategic", projectBase{}, nil, nil); err == nil {
+		t.Fatal("destinationsPatch() with a strategic merge patch succeeded")
+	}
+}
+
+func TestParsePatchStrategy(t *testing.T) {
+	for name, want := range map[string]PatchStrategy{"merge": PatchMerge, "json": PatchJSON} {
+		if got, err := ParsePatchStrategy(name); err != nil || got != want {
+			t.Errorf("ParsePatchStrategy(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"strategic", "", "yaml"} {
+		if _, err := ParsePatchStrategy(name); err == nil {
+			t.Errorf("ParsePatchStrategy(%q) succeeded", name)
+		}
+	}
+}
+
+func TestPatchStrategiesApply(t *testing.T) {
+	for _, strategy := range []PatchStrategy{PatchMerge, PatchJSON} {
+		t.Run(string(strategy), func(t *testing.T) {
+			client, _ := newTestClient(t, Options{PatchStrategy: strategy}, newTestProject("team-a", destProd))
+			ctx := context.Background()
+
+			if _, err := client.AddDestinationWithMetadata(ctx, "team-a", destStaging, DestinationMetadata{Owner: "team-a"}); err != nil {
+				t.Fatalf("AddDestinationWithMetadata() error = %v", err)
+			}
+			if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, []Destination{destProd, destStaging}) {
+				t.Errorf("stored destinations after add = %v", got)
+			}
+			if _, err := client.RemoveDestination(ctx, "team-a", destStaging); err != nil {
+				t.Fatalf("RemoveDestination() error = %v", err)
+			}
+			if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, []Destination{destProd}) {
+				t.Errorf("stored destinations after remove = %v", got)
+			}
+		})
+	}
+}
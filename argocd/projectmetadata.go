@@ -0,0 +1,142 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ProjectMetadataUpdate changes an AppProject's description, labels and
+// annotations. Labels and annotations not given are left untouched, and
+// those given a nil value are removed.
+type ProjectMetadataUpdate struct {
+	// Description replaces spec.description unless nil. An empty description
+	// removes it.
+	Description *string
+	Labels      map[string]*string
+	Annotations map[string]*string
+}
+
+// UpdateProjectMetadata applies update to an AppProject, retrying on
+// conflict. Result.Changed is false if the project already matched it.
+func (c *Client) UpdateProjectMetadata(ctx context.Context, projectName string, update ProjectMetadataUpdate) (Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+		if err != nil {
+			return Result{}, wrapError(err)
+		}
+
+		patchType, patchBytes, changed, err := projectMetadataPatch(c.options.PatchStrategy, project, update)
+		if err != nil {
+			return Result{}, err
+		}
+		if !changed {
+			return Result{ResourceVersion: project.GetResourceVersion()}, nil
+		}
+
+		if preview, ok := patchPreview(ctx); ok {
+			*preview = PatchPreview{PatchType: patchType, Patch: patchBytes, ResourceVersion: project.GetResourceVersion()}
+			return Result{Changed: true, ResourceVersion: project.GetResourceVersion()}, nil
+		}
+
+		updated, err := c.resource(ctx).Patch(ctx, projectName, patchType, patchBytes, metav1.PatchOptions{})
+		// A failed patch may still have been applied, e.g. on a timeout
+		c.invalidateCache(ctx)
+		if retry, err := c.retryConflict(wrapError(err), attempt); retry {
+			continue
+		} else if err != nil {
+			return Result{}, err
+		}
+		return Result{Changed: true, ResourceVersion: updated.GetResourceVersion()}, nil
+	}
+}
+
+// projectMetadataPatch builds the patch applying update to project with the
+// patch type of strategy, leaving out what already matches. It reports
+// whether there is anything to change. Like destination patches, the patch
+// carries the project's resourceVersion.
+func projectMetadataPatch(strategy PatchStrategy, project *unstructured.Unstructured, update ProjectMetadataUpdate) (types.PatchType, []byte, bool, error) {
+	labels := changedValues(project.GetLabels(), update.Labels)
+	annotations := changedValues(project.GetAnnotations(), update.Annotations)
+
+	var description interface{}
+	descriptionChanged := false
+	if update.Description != nil {
+		current, found, _ := unstructured.NestedString(project.Object, "spec", "description")
+		switch {
+		case *update.Description == "" && found:
+			descriptionChanged = true
+		case *update.Description != "" && *update.Description != current:
+			description, descriptionChanged = *update.Description, true
+		}
+	}
+
+	if len(labels) == 0 && len(annotations) == 0 && !descriptionChanged {
+		return "", nil, false, nil
+	}
+
+	var patchType types.PatchType
+	var patch interface{}
+	switch strategy {
+	case PatchJSON:
+		patchType = types.JSONPatchType
+		ops := []jsonPatchOp{{Op: "replace", Path: "/metadata/resourceVersion", Value: project.GetResourceVersion()}}
+		ops = append(ops, mapPatchOps("/metadata/labels", project.GetLabels(), labels)...)
+		ops = append(ops, mapPatchOps("/metadata/annotations", project.GetAnnotations(), annotations)...)
+		switch {
+		case descriptionChanged && description == nil:
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: "/spec/description"})
+		case descriptionChanged:
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/spec/description", Value: description})
+		}
+		patch = ops
+	case PatchMerge, "":
+		patchType = types.MergePatchType
+		metadata := map[string]interface{}{"resourceVersion": project.GetResourceVersion()}
+		if len(labels) > 0 {
+			metadata["labels"] = labels
+		}
+		if len(annotations) > 0 {
+			metadata["annotations"] = annotations
+		}
+		merge := map[string]interface{}{"metadata": metadata}
+		if descriptionChanged {
+			merge["spec"] = map[string]interface{}{"description": description}
+		}
+		patch = merge
+	default:
+		return "", nil, false, fmt.Errorf("unknown patch strategy %q", strategy)
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return patchType, patchBytes, true, nil
+}
+
+// changedValues returns the values of update that differ from stored, with
+// nil for keys to remove, in the form mapPatchOps and merge patches take
+func changedValues(stored map[string]string, update map[string]*string) map[string]interface{} {
+	changed := make(map[string]interface{})
+	for key, value := range update {
+		current, present := stored[key]
+		switch {
+		case value == nil && present:
+			changed[key] = nil
+		case value != nil && (!present || current != *value):
+			changed[key] = *value
+		}
+	}
+	return changed
+}
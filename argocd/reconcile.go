@@ -0,0 +1,170 @@
+package argocd
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DestinationDiff lists the destinations a reconciliation adds and removes
+type DestinationDiff struct {
+	Added   []Destination `json:"added,omitempty"`
+	Removed []Destination `json:"removed,omitempty"`
+}
+
+// Empty reports whether the diff changes nothing
+func (d DestinationDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// PlanDestinations computes the changes SetDestinations would make to an
+// AppProject without applying them, and returns the resourceVersion the diff
+// was computed against
+func (c *Client) PlanDestinations(ctx context.Context, projectName string, desired []Destination) (DestinationDiff, string, error) {
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return DestinationDiff{}, "", err
+	}
+
+	rawDestinations, _, base, err := c.getRawDestinations(ctx, projectName)
+	if err != nil {
+		return DestinationDiff{}, "", err
+	}
+
+	_, diff := reconcileDestinations(rawDestinations, desired, matches)
+	return diff, base.resourceVersion, nil
+}
+
+// SetDestinations reconciles the destinations of an AppProject to the desired
+// set, adding missing destinations and removing extra ones. Kept entries keep
+// any fields this API doesn't model. Result.Changed is false if the project
+// already had exactly the desired destinations. Conflicting concurrent
+// modifications are retried against the re-read project.
+func (c *Client) SetDestinations(ctx context.Context, projectName string, desired []Destination) (DestinationDiff, Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return DestinationDiff{}, Result{}, err
+	}
+	defer unlock()
+
+	matches, err := c.destinationMatcher(ctx)
+	if err != nil {
+		return DestinationDiff{}, Result{}, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		rawDestinations, metadata, base, err := c.getRawDestinations(ctx, projectName)
+		if err != nil {
+			return DestinationDiff{}, Result{}, err
+		}
+
+		newDestinations, diff := reconcileDestinations(rawDestinations, desired, matches)
+		if diff.Empty() {
+			return diff, Result{ResourceVersion: base.resourceVersion}, nil
+		}
+
+		// Enforce the destination limit, but never block a reconciliation that shrinks the project
+		if limit := c.options.MaxDestinations; limit > 0 && len(newDestinations) > limit && len(newDestinations) > len(rawDestinations) {
+			return DestinationDiff{}, Result{}, &DestinationLimitError{Project: projectName, Count: len(rawDestinations), Limit: limit}
+		}
+
+		newVersion, err := c.patchDestinations(ctx, projectName, newDestinations, metadata, base)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return DestinationDiff{}, Result{}, err
+		}
+		return diff, Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// CreateProject creates an AppProject with the given labels and destinations
+// and returns its resourceVersion. Only destinations are set, so the project
+// permits no source repositories until they are configured separately.
+func (c *Client) CreateProject(ctx context.Context, projectName string, labels map[string]string, destinations []Destination) (string, error) {
+	rawDestinations := make([]interface{}, 0, len(destinations))
+	for _, dest := range destinations {
+		rawDestinations = append(rawDestinations, destinationToRaw(dest))
+	}
+
+	project := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": c.gvr.GroupVersion().String(),
+		"kind":       "AppProject",
+		"spec": map[string]interface{}{
+			"destinations": rawDestinations,
+		},
+	}}
+	project.SetName(projectName)
+	project.SetLabels(labels)
+
+	created, err := c.resource(ctx).Create(ctx, project, metav1.CreateOptions{})
+	c.invalidateCache(ctx)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return created.GetResourceVersion(), nil
+}
+
+// DeleteProject deletes an AppProject. Its destinations, metadata and archive
+// go with it. Unless resourceVersion is empty, the deletion is conditioned on
+// it and fails with ErrConflict if the project changed since it was read. It
+// waits for other mutations of the project like they wait for each other.
+func (c *Client) DeleteProject(ctx context.Context, projectName, resourceVersion string) error {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var opts metav1.DeleteOptions
+	if resourceVersion != "" {
+		opts.Preconditions = &metav1.Preconditions{ResourceVersion: &resourceVersion}
+	}
+	err = c.resource(ctx).Delete(ctx, projectName, opts)
+	c.invalidateCache(ctx)
+	return wrapError(err)
+}
+
+// reconcileDestinations returns the stored destination entries reconciled to
+// the desired set, and the diff between the two. Stored entries that are
+// still desired are kept as stored; entries that can't be parsed are kept too.
+func reconcileDestinations(rawDestinations []interface{}, desired []Destination, matches func(a, b Destination) bool) ([]interface{}, DestinationDiff) {
+	var diff DestinationDiff
+	newDestinations := []interface{}{}
+	var kept []Destination
+
+	for _, raw := range rawDestinations {
+		existing, ok := destinationFromRaw(raw)
+		if !ok {
+			newDestinations = append(newDestinations, raw)
+			continue
+		}
+		if containsMatch(desired, existing, matches) && !containsMatch(kept, existing, matches) {
+			kept = append(kept, existing)
+			newDestinations = append(newDestinations, raw)
+			continue
+		}
+		diff.Removed = append(diff.Removed, existing)
+	}
+
+	for _, dest := range desired {
+		if containsMatch(kept, dest, matches) || containsMatch(diff.Added, dest, matches) {
+			continue
+		}
+		diff.Added = append(diff.Added, dest)
+		newDestinations = append(newDestinations, destinationToRaw(dest))
+	}
+
+	return newDestinations, diff
+}
+
+// containsMatch reports whether any destination in list matches dest
+func containsMatch(list []Destination, dest Destination, matches func(a, b Destination) bool) bool {
+	for _, d := range list {
+		if matches(d, dest) {
+			return true
+		}
+	}
+	return false
+}
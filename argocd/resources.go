@@ -0,0 +1,107 @@
+package argocd
+
+import "context"
+
+// ResourceList names an AppProject spec list of group/kind pairs
+type ResourceList string
+
+// The resource lists of an AppProject. A namespaced resource may be deployed
+// if the whitelist is empty or has it, and the blacklist doesn't have it.
+const (
+	// ClusterResourceWhitelist lists the cluster-scoped resources a project's
+	// applications may deploy
+	ClusterResourceWhitelist   ResourceList = "clusterResourceWhitelist"
+	NamespaceResourceWhitelist ResourceList = "namespaceResourceWhitelist"
+	NamespaceResourceBlacklist ResourceList = "namespaceResourceBlacklist"
+)
+
+// Blacklist reports whether the list's entries deny resources rather than
+// permit them
+func (l ResourceList) Blacklist() bool {
+	return l == NamespaceResourceBlacklist
+}
+
+// GroupKind is an entry of a ResourceList. Group is empty for the core API
+// group; "*" matches every group or kind.
+type GroupKind struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+}
+
+// String formats the entry like kubectl does, e.g. "Namespace" or
+// "CustomResourceDefinition.apiextensions.k8s.io"
+func (gk GroupKind) String() string {
+	if gk.Group == "" {
+		return gk.Kind
+	}
+	return gk.Kind + "." + gk.Group
+}
+
+// GetResources retrieves the entries of a resource list of an AppProject, in
+// stored order, along with the resourceVersion
+func (c *Client) GetResources(ctx context.Context, projectName string, list ResourceList) ([]GroupKind, string, error) {
+	entries, resourceVersion, err := c.getSpecList(ctx, projectName, string(list))
+	if err != nil {
+		return nil, "", err
+	}
+	return parseResources(entries), resourceVersion, nil
+}
+
+// AddResource adds a group/kind pair to a resource list of an AppProject
+// (idempotent). Result.Changed is false if the list already has it.
+func (c *Client) AddResource(ctx context.Context, projectName string, list ResourceList, gk GroupKind) (Result, error) {
+	return c.updateSpecList(ctx, projectName, string(list), func(entries []interface{}) ([]interface{}, bool, error) {
+		for _, raw := range entries {
+			if stored, ok := parseGroupKind(raw); ok && stored == gk {
+				return entries, false, nil
+			}
+		}
+		return append(entries, map[string]interface{}{"group": gk.Group, "kind": gk.Kind}), true, nil
+	})
+}
+
+// RemoveResource removes a group/kind pair from a resource list of an
+// AppProject (idempotent). Result.Changed is false if the list didn't have it.
+func (c *Client) RemoveResource(ctx context.Context, projectName string, list ResourceList, gk GroupKind) (Result, error) {
+	return c.updateSpecList(ctx, projectName, string(list), func(entries []interface{}) ([]interface{}, bool, error) {
+		kept := []interface{}{}
+		for _, raw := range entries {
+			if stored, ok := parseGroupKind(raw); !ok || stored != gk {
+				kept = append(kept, raw)
+			}
+		}
+		return kept, len(kept) != len(entries), nil
+	})
+}
+
+// parseResources reads the stored entries of a resource list, skipping
+// malformed ones
+func parseResources(entries []interface{}) []GroupKind {
+	resources := []GroupKind{}
+	for _, raw := range entries {
+		if gk, ok := parseGroupKind(raw); ok {
+			resources = append(resources, gk)
+		}
+	}
+	return resources
+}
+
+// parseGroupKind reads a stored resource list entry. ArgoCD omits an empty
+// group, so a missing group is the core group.
+func parseGroupKind(raw interface{}) (GroupKind, bool) {
+	entry, ok := raw.(map[string]interface{})
+	if !ok {
+		return GroupKind{}, false
+	}
+	kind, ok := entry["kind"].(string)
+	if !ok {
+		return GroupKind{}, false
+	}
+	group := ""
+	if value, ok := entry["group"]; ok {
+		if group, ok = value.(string); !ok {
+			return GroupKind{}, false
+		}
+	}
+	return GroupKind{Group: group, Kind: kind}, true
+}
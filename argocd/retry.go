@@ -0,0 +1,52 @@
+package argocd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/example/argocd-destination-api/metrics"
+	"golang.org/x/time/rate"
+)
+
+// DefaultConflictAttempts is how often a mutation that retries conflicts
+// patches the project unless Options.ConflictAttempts is set
+const DefaultConflictAttempts = 3
+
+// newRetryBudget returns a limiter allowing perSecond conflict retries per
+// second across all mutations, with bursts of up to a second's worth. Zero
+// disables the budget.
+func newRetryBudget(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), int(math.Max(1, math.Ceil(perSecond))))
+}
+
+// retryConflict decides whether a mutation whose patch failed with err on the
+// given attempt re-reads the project and tries again. Errors other than
+// conflicts are returned as is. A conflict is returned once the attempts are
+// used up, and ErrRetryBudgetExhausted once the retries of all mutations
+// exceed Options.RetryBudget, so a conflict storm doesn't multiply the load
+// on the API server.
+func (c *Client) retryConflict(err error, attempt int) (bool, error) {
+	if !errors.Is(err, ErrConflict) {
+		return false, err
+	}
+
+	attempts := c.options.ConflictAttempts
+	if attempts <= 0 {
+		attempts = DefaultConflictAttempts
+	}
+	if attempt >= attempts {
+		metrics.ConflictRetriesExhausted.WithLabelValues("attempts").Inc()
+		return false, err
+	}
+	if c.retryBudget != nil && !c.retryBudget.Allow() {
+		metrics.ConflictRetriesExhausted.WithLabelValues("budget").Inc()
+		return false, fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+	}
+
+	metrics.ConflictRetries.Inc()
+	return true, nil
+}
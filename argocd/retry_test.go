@@ -0,0 +1,115 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/example/argocd-destination-api/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// conflictingMutations are the destination mutations that retry conflicts
+var conflictingMutations = []struct {
+	name   string
+	mutate func(*Client) error
+}{
+	{"add", func(c *Client) error {
+		_, err := c.AddDestination(context.Background(), "team-a", destStaging)
+		return err
+	}},
+	{"add batch", func(c *Client) error {
+		_, _, err := c.AddDestinations(context.Background(), "team-a", []Destination{destStaging}, DestinationMetadata{})
+		return err
+	}},
+	{"set metadata", func(c *Client) error {
+		_, err := c.SetDestinationMetadata(context.Background(), "team-a", destProd, DestinationMetadata{Owner: "team-a"})
+		return err
+	}},
+	{"remove", func(c *Client) error {
+		_, err := c.RemoveDestination(context.Background(), "team-a", destProd)
+		return err
+	}},
+}
+
+func TestMutationsRetryConflict(t *testing.T) {
+	for _, tt := range conflictingMutations {
+		t.Run(tt.name, func(t *testing.T) {
+			client, dyn := newTestClient(t, Options{}, newTestProject("team-a", destProd))
+			patches := failPatches(dyn, 1, conflictError("team-a"))
+			retries := testutil.ToFloat64(metrics.ConflictRetries)
+
+			if err := tt.mutate(client); err != nil {
+				t.Fatalf("mutation failed after one conflict: %v", err)
+			}
+			if got := patches.Load(); got != 2 {
+				t.Errorf("patches = %d, want 2", got)
+			}
+			if got := testutil.ToFloat64(metrics.ConflictRetries) - retries; got != 1 {
+				t.Errorf("conflict retries = %g, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSustainedConflictsExhaustAttempts(t *testing.T) {
+	for _, tt := range conflictingMutations {
+		t.Run(tt.name, func(t *testing.T) {
+			client, dyn := newTestClient(t, Options{ConflictAttempts: 4}, newTestProject("team-a", destProd))
+			patches := failPatches(dyn, -1, conflictError("team-a"))
+			retries := testutil.ToFloat64(metrics.ConflictRetries)
+			exhausted := testutil.ToFloat64(metrics.ConflictRetriesExhausted.WithLabelValues("attempts"))
+
+			err := tt.mutate(client)
+			if !errors.Is(err, ErrConflict) || errors.Is(err, ErrRetryBudgetExhausted) {
+				t.Fatalf("error = %v, want a conflict", err)
+			}
+			if got := patches.Load(); got != 4 {
+				t.Errorf("patches = %d, want 4", got)
+			}
+			if got := testutil.ToFloat64(metrics.ConflictRetries) - retries; got != 3 {
+				t.Errorf("conflict retries = %g, want 3", got)
+			}
+			if got := testutil.ToFloat64(metrics.ConflictRetriesExhausted.WithLabelValues("attempts")) - exhausted; got != 1 {
+				t.Errorf("exhausted attempts = %g, want 1", got)
+			}
+			if got := storedDestinations(t, client, "team-a"); !reflect.DeepEqual(got, []Destination{destProd}) {
+				t.Errorf("stored destinations = %v, want unchanged", got)
+			}
+		})
+	}
+}
+
+func TestSustainedConflictsExhaustBudget(t *testing.T) {
+	// A budget of one retry per second allows a single retry across all
+	// mutations before the test could refill it
+	client, dyn := newTestClient(t, Options{ConflictAttempts: 10, RetryBudget: 1}, newTestProject("team-a", destProd))
+	patches := failPatches(dyn, -1, conflictError("team-a"))
+	retries := testutil.ToFloat64(metrics.ConflictRetries)
+	exhausted := testutil.ToFloat64(metrics.ConflictRetriesExhausted.WithLabelValues("budget"))
+
+	_, err := client.AddDestination(context.Background(), "team-a", destStaging)
+	if !errors.Is(err, ErrRetryBudgetExhausted) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("first add error = %v, want the budget to run out", err)
+	}
+	if got := patches.Load(); got != 2 {
+		t.Errorf("patches = %d, want 2", got)
+	}
+
+	// The next mutation finds the budget used up and doesn't retry at all
+	_, err = client.RemoveDestination(context.Background(), "team-a", destProd)
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("remove error = %v, want the budget to be exhausted", err)
+	}
+	if got := patches.Load(); got != 3 {
+		t.Errorf("patches = %d, want 3", got)
+	}
+
+	if got := testutil.ToFloat64(metrics.ConflictRetries) - retries; got != 1 {
+		t.Errorf("conflict retries = %g, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ConflictRetriesExhausted.WithLabelValues("budget")) - exhausted; got != 2 {
+		t.Errorf("exhausted budget = %g, want 2", got)
+	}
+}
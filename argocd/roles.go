@@ -0,0 +1,169 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRoleNotFound is returned when an operation targets a role the project
+// doesn't have
+var ErrRoleNotFound = errors.New("role not found")
+
+// ErrRoleExists is returned when creating a role the project already has
+var ErrRoleExists = errors.New("role already exists")
+
+// Role is a project role: Casbin policies granting access to the project's
+// applications, and the SSO groups bound to it. The role's JWT tokens are
+// left out.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Policies    []string `json:"policies"`
+	Groups      []string `json:"groups"`
+}
+
+// GetRoles retrieves the roles of an AppProject, in stored order, along with
+// the resourceVersion
+func (c *Client) GetRoles(ctx context.Context, projectName string) ([]Role, string, error) {
+	list, resourceVersion, err := c.getSpecList(ctx, projectName, "roles")
+	if err != nil {
+		return nil, "", err
+	}
+	return parseRoles(list), resourceVersion, nil
+}
+
+// parseRoles reads the stored roles, skipping malformed ones
+func parseRoles(list []interface{}) []Role {
+	roles := []Role{}
+	for _, raw := range list {
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := entry["name"].(string)
+		description, _ := entry["description"].(string)
+		roles = append(roles, Role{
+			Name:        name,
+			Description: description,
+			Policies:    stringList(entry["policies"]),
+			Groups:      stringList(entry["groups"]),
+		})
+	}
+	return roles
+}
+
+// CreateRole adds a role to an AppProject. It fails with ErrRoleExists if the
+// project already has a role of the name.
+func (c *Client) CreateRole(ctx context.Context, projectName string, role Role) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "roles", func(list []interface{}) ([]interface{}, bool, error) {
+		if findRole(list, role.Name) >= 0 {
+			return nil, false, fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+		}
+
+		entry := map[string]interface{}{
+			"name":     role.Name,
+			"policies": toInterfaceList(role.Policies),
+			"groups":   toInterfaceList(role.Groups),
+		}
+		if role.Description != "" {
+			entry["description"] = role.Description
+		}
+		return append(list, entry), true, nil
+	})
+}
+
+// DeleteRole removes a role, with its tokens, from an AppProject
+// (idempotent). Result.Changed is false if the project didn't have it.
+func (c *Client) DeleteRole(ctx context.Context, projectName, roleName string) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "roles", func(list []interface{}) ([]interface{}, bool, error) {
+		i := findRole(list, roleName)
+		if i < 0 {
+			return list, false, nil
+		}
+		return append(list[:i:i], list[i+1:]...), true, nil
+	})
+}
+
+// AddRolePolicy adds a Casbin policy line to a role (idempotent)
+func (c *Client) AddRolePolicy(ctx context.Context, projectName, roleName, policy string) (Result, error) {
+	return c.updateRoleList(ctx, projectName, roleName, "policies", policy, true)
+}
+
+// RemoveRolePolicy removes a Casbin policy line from a role (idempotent)
+func (c *Client) RemoveRolePolicy(ctx context.Context, projectName, roleName, policy string) (Result, error) {
+	return c.updateRoleList(ctx, projectName, roleName, "policies", policy, false)
+}
+
+// AddRoleGroup binds an SSO group to a role (idempotent)
+func (c *Client) AddRoleGroup(ctx context.Context, projectName, roleName, group string) (Result, error) {
+	return c.updateRoleList(ctx, projectName, roleName, "groups", group, true)
+}
+
+// RemoveRoleGroup unbinds an SSO group from a role (idempotent)
+func (c *Client) RemoveRoleGroup(ctx context.Context, projectName, roleName, group string) (Result, error) {
+	return c.updateRoleList(ctx, projectName, roleName, "groups", group, false)
+}
+
+// updateRoleList adds value to or removes it from a string list field of a
+// role. It fails with ErrRoleNotFound if the project doesn't have the role.
+// The role's other fields, including its tokens, are kept as stored.
+func (c *Client) updateRoleList(ctx context.Context, projectName, roleName, field, value string, add bool) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "roles", func(list []interface{}) ([]interface{}, bool, error) {
+		i := findRole(list, roleName)
+		if i < 0 {
+			return nil, false, fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+		}
+		role := list[i].(map[string]interface{})
+		values, _ := role[field].([]interface{})
+
+		kept := []interface{}{}
+		for _, raw := range values {
+			if raw != value {
+				kept = append(kept, raw)
+			}
+		}
+		switch {
+		case add && len(kept) == len(values):
+			role[field] = append(values, value)
+		case !add && len(kept) != len(values):
+			role[field] = kept
+		default:
+			return list, false, nil
+		}
+		return list, true, nil
+	})
+}
+
+// findRole returns the index of the role named name in the stored roles, or
+// -1 if there is none
+func findRole(list []interface{}, name string) int {
+	for i, raw := range list {
+		if entry, ok := raw.(map[string]interface{}); ok && entry["name"] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// stringList reads a stored list of strings, skipping other values
+func stringList(raw interface{}) []string {
+	values := []string{}
+	list, _ := raw.([]interface{})
+	for _, value := range list {
+		if s, ok := value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// toInterfaceList converts values to a list that can be stored in an
+// unstructured object. nil becomes an empty list.
+func toInterfaceList(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return list
+}
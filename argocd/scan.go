@@ -0,0 +1,125 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultScanConcurrency is how many projects or namespaces a cluster-wide
+// scan processes at once unless Options.ScanConcurrency is set
+const DefaultScanConcurrency = 4
+
+// ProjectError reports a project a scan couldn't read. Unless
+// Options.StrictScans is set, the project is still part of the scan's result
+// with its Error set and no destinations.
+type ProjectError struct {
+	Project string
+	Err     error
+}
+
+func (e *ProjectError) Error() string {
+	return fmt.Sprintf("project %s: %v", e.Project, e.Err)
+}
+
+func (e *ProjectError) Unwrap() error {
+	return e.Err
+}
+
+// scanConcurrency returns the configured size of the scan worker pools
+func (c *Client) scanConcurrency() int {
+	if c.options.ScanConcurrency > 0 {
+		return c.options.ScanConcurrency
+	}
+	return DefaultScanConcurrency
+}
+
+// scanProjects builds the project summaries of items with a bounded worker
+// pool. The summaries keep the order of items. A project whose destinations
+// can't be read fails the scan with Options.StrictScans, and otherwise comes
+// back with Project.Error set.
+func (c *Client) scanProjects(ctx context.Context, items []unstructured.Unstructured) ([]Project, error) {
+	projects := make([]Project, len(items))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.scanConcurrency())
+	for i := range items {
+		i := i
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			project, err := c.scanProject(&items[i])
+			if err != nil && c.options.StrictScans {
+				return &ProjectError{Project: items[i].GetName(), Err: err}
+			}
+			projects[i] = project
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// scanProject builds the project summary of one AppProject, recording a
+// failure to read its destinations in Project.Error
+func (c *Client) scanProject(item *unstructured.Unstructured) (Project, error) {
+	destinations, err := c.extractDestinations(item)
+	if err != nil {
+		return Project{Name: item.GetName(), Destinations: []Destination{}, Error: err.Error()}, err
+	}
+	if destinations == nil {
+		destinations = []Destination{}
+	}
+	return Project{
+		Name:             item.GetName(),
+		DestinationCount: len(destinations),
+		Destinations:     destinations,
+	}, nil
+}
+
+// DestinationCounts returns the destination count of every AppProject in each
+// of the namespaces, keyed by namespace, for the destination metrics. The
+// namespaces are listed concurrently. A namespace that can't be listed is
+// left out of the counts and reported in the returned error, which only
+// discards the other namespaces' counts with Options.StrictScans.
+func (c *Client) DestinationCounts(ctx context.Context, namespaces []string) (map[string][]int, error) {
+	results := make([][]int, len(namespaces))
+	failures := make([]error, len(namespaces))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.scanConcurrency())
+	for i, namespace := range namespaces {
+		i, namespace := i, namespace
+		g.Go(func() error {
+			projects, err := c.ListProjects(WithNamespace(gctx, namespace), "", "")
+			if err != nil {
+				failures[i] = fmt.Errorf("namespace %s: %w", namespace, err)
+				if c.options.StrictScans {
+					return failures[i]
+				}
+				return nil
+			}
+			perProject := make([]int, 0, len(projects))
+			for _, project := range projects {
+				perProject = append(perProject, project.DestinationCount)
+			}
+			results[i] = perProject
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string][]int, len(namespaces))
+	for i, namespace := range namespaces {
+		if failures[i] == nil {
+			counts[namespace] = results[i]
+		}
+	}
+	return counts, errors.Join(failures...)
+}
@@ -0,0 +1,111 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ProjectSettings are the boolean switches of an AppProject's spec
+type ProjectSettings struct {
+	// PermitOnlyProjectScopedClusters limits the project's destinations to
+	// clusters scoped to the project
+	PermitOnlyProjectScopedClusters bool `json:"permitOnlyProjectScopedClusters"`
+}
+
+// GetProjectSettings retrieves the settings of an AppProject along with the
+// resourceVersion
+func (c *Client) GetProjectSettings(ctx context.Context, projectName string) (ProjectSettings, string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return ProjectSettings{}, "", wrapError(err)
+	}
+	return projectSettings(project), project.GetResourceVersion(), nil
+}
+
+// SetPermitOnlyProjectScopedClusters sets spec.permitOnlyProjectScopedClusters
+// of an AppProject, retrying on conflict. Result.Changed is false if it
+// already had the value.
+func (c *Client) SetPermitOnlyProjectScopedClusters(ctx context.Context, projectName string, permit bool) (Result, error) {
+	return c.setSpecSwitch(ctx, projectName, "permitOnlyProjectScopedClusters", permit)
+}
+
+// projectSettings reads the settings of a project. Like ArgoCD, it reads a
+// missing or malformed switch as off.
+func projectSettings(project *unstructured.Unstructured) ProjectSettings {
+	permit, _, _ := unstructured.NestedBool(project.Object, "spec", "permitOnlyProjectScopedClusters")
+	return ProjectSettings{PermitOnlyProjectScopedClusters: permit}
+}
+
+// setSpecSwitch sets a boolean field of an AppProject's spec. Switching it
+// off removes the field, as ArgoCD omits switches that are off. Like
+// destination patches, the patch carries the resourceVersion it was read at.
+func (c *Client) setSpecSwitch(ctx context.Context, projectName, field string, on bool) (Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+		if err != nil {
+			return Result{}, wrapError(err)
+		}
+		resourceVersion := project.GetResourceVersion()
+
+		current, found, _ := unstructured.NestedFieldNoCopy(project.Object, "spec", field)
+		if current == on || (!on && !found) {
+			return Result{ResourceVersion: resourceVersion}, nil
+		}
+
+		var value interface{}
+		if on {
+			value = true
+		}
+
+		var patchType types.PatchType
+		var patch interface{}
+		switch c.options.PatchStrategy {
+		case PatchJSON:
+			patchType = types.JSONPatchType
+			op := jsonPatchOp{Op: "add", Path: "/spec/" + escapeJSONPointer(field), Value: value}
+			if !on {
+				op = jsonPatchOp{Op: "remove", Path: op.Path}
+			}
+			patch = []jsonPatchOp{{Op: "replace", Path: "/metadata/resourceVersion", Value: resourceVersion}, op}
+		case PatchMerge, "":
+			patchType = types.MergePatchType
+			patch = map[string]interface{}{
+				"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+				"spec":     map[string]interface{}{field: value},
+			}
+		default:
+			return Result{}, fmt.Errorf("unknown patch strategy %q", c.options.PatchStrategy)
+		}
+
+		patchBytes, err := json.Marshal(patch)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to marshal patch: %w", err)
+		}
+
+		if preview, ok := patchPreview(ctx); ok {
+			*preview = PatchPreview{PatchType: patchType, Patch: patchBytes, ResourceVersion: resourceVersion}
+			return Result{Changed: true, ResourceVersion: resourceVersion}, nil
+		}
+
+		updated, err := c.resource(ctx).Patch(ctx, projectName, patchType, patchBytes, metav1.PatchOptions{})
+		// A failed patch may still have been applied, e.g. on a timeout
+		c.invalidateCache(ctx)
+		if retry, err := c.retryConflict(wrapError(err), attempt); retry {
+			continue
+		} else if err != nil {
+			return Result{}, err
+		}
+		return Result{Changed: true, ResourceVersion: updated.GetResourceVersion()}, nil
+	}
+}
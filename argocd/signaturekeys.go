@@ -0,0 +1,54 @@
+package argocd
+
+import "context"
+
+// GetSignatureKeys retrieves the GPG key IDs an AppProject requires commits
+// to be signed with, in stored order, along with the resourceVersion
+func (c *Client) GetSignatureKeys(ctx context.Context, projectName string) ([]string, string, error) {
+	list, resourceVersion, err := c.getSpecList(ctx, projectName, "signatureKeys")
+	if err != nil {
+		return nil, "", err
+	}
+	return parseSignatureKeys(list), resourceVersion, nil
+}
+
+// parseSignatureKeys reads the stored signature key IDs, skipping malformed
+// entries
+func parseSignatureKeys(list []interface{}) []string {
+	keys := []string{}
+	for _, raw := range list {
+		if entry, ok := raw.(map[string]interface{}); ok {
+			if keyID, ok := entry["keyID"].(string); ok {
+				keys = append(keys, keyID)
+			}
+		}
+	}
+	return keys
+}
+
+// AddSignatureKey adds a GPG key ID to an AppProject's signature keys
+// (idempotent). Result.Changed is false if the project already has it.
+func (c *Client) AddSignatureKey(ctx context.Context, projectName, keyID string) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "signatureKeys", func(list []interface{}) ([]interface{}, bool, error) {
+		for _, raw := range list {
+			if entry, ok := raw.(map[string]interface{}); ok && entry["keyID"] == keyID {
+				return list, false, nil
+			}
+		}
+		return append(list, map[string]interface{}{"keyID": keyID}), true, nil
+	})
+}
+
+// RemoveSignatureKey removes a GPG key ID from an AppProject's signature keys
+// (idempotent). Result.Changed is false if the project didn't have it.
+func (c *Client) RemoveSignatureKey(ctx context.Context, projectName, keyID string) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "signatureKeys", func(list []interface{}) ([]interface{}, bool, error) {
+		kept := []interface{}{}
+		for _, raw := range list {
+			if entry, ok := raw.(map[string]interface{}); !ok || entry["keyID"] != keyID {
+				kept = append(kept, raw)
+			}
+		}
+		return kept, len(kept) != len(list), nil
+	})
+}
@@ -0,0 +1,46 @@
+package argocd
+
+import "sort"
+
+// destinationLess orders destinations by server, namespace and name
+func destinationLess(a, b Destination) bool {
+	if a.Server != b.Server {
+		return a.Server < b.Server
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// SortDestinations returns a copy of dests sorted by server, namespace and
+// name with exact duplicates dropped. dests itself is left untouched, so
+// cached and stored lists keep their order.
+func SortDestinations(dests []Destination) []Destination {
+	sorted := append([]Destination{}, dests...)
+	sort.SliceStable(sorted, func(i, j int) bool { return destinationLess(sorted[i], sorted[j]) })
+
+	unique := sorted[:0]
+	for i, dest := range sorted {
+		if i == 0 || dest != sorted[i-1] {
+			unique = append(unique, dest)
+		}
+	}
+	return unique
+}
+
+// SortDestinationDetails sorts and deduplicates destinations with their
+// metadata like SortDestinations. Metadata is stored per destination, so
+// duplicates always carry the same metadata.
+func SortDestinationDetails(dests []DestinationDetails) []DestinationDetails {
+	sorted := append([]DestinationDetails{}, dests...)
+	sort.SliceStable(sorted, func(i, j int) bool { return destinationLess(sorted[i].Destination, sorted[j].Destination) })
+
+	unique := sorted[:0]
+	for i, dest := range sorted {
+		if i == 0 || dest.Destination != sorted[i-1].Destination {
+			unique = append(unique, dest)
+		}
+	}
+	return unique
+}
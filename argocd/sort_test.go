@@ -0,0 +1,60 @@
+package argocd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortDestinations(t *testing.T) {
+	var (
+		a     = Destination{Server: "https://a.example.com", Namespace: "app"}
+		aNs   = Destination{Server: "https://a.example.com", Namespace: "batch"}
+		aName = Destination{Server: "https://a.example.com", Namespace: "batch", Name: "a"}
+		b     = Destination{Server: "https://b.example.com", Namespace: "app"}
+	)
+
+	tests := []struct {
+		name  string
+		input []Destination
+		want  []Destination
+	}{
+		{name: "empty", input: nil, want: []Destination{}},
+		{name: "sorted", input: []Destination{a, aNs, b}, want: []Destination{a, aNs, b}},
+		{name: "unsorted", input: []Destination{b, aName, a, aNs}, want: []Destination{a, aNs, aName, b}},
+		{name: "duplicates", input: []Destination{b, a, b, a, a}, want: []Destination{a, b}},
+		{name: "same server and namespace, different name", input: []Destination{aName, aNs, aName}, want: []Destination{aNs, aName}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]Destination(nil), tt.input...)
+			if got := SortDestinations(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SortDestinations(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.input, input) {
+				t.Errorf("SortDestinations modified its input to %v", tt.input)
+			}
+		})
+	}
+}
+
+func TestSortDestinationDetails(t *testing.T) {
+	owned := &DestinationMetadata{Owner: "team-a"}
+	input := []DestinationDetails{
+		{Destination: destStaging},
+		{Destination: destProd, Metadata: owned},
+		{Destination: destStaging},
+		{Destination: destProd, Metadata: owned},
+	}
+	want := []DestinationDetails{
+		{Destination: destProd, Metadata: owned},
+		{Destination: destStaging},
+	}
+
+	if got := SortDestinationDetails(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("SortDestinationDetails() = %v, want %v", got, want)
+	}
+	if input[0].Destination != destStaging {
+		t.Errorf("SortDestinationDetails modified its input")
+	}
+}
@@ -0,0 +1,40 @@
+package argocd
+
+import "context"
+
+// GetSourceRepos retrieves the source repositories an AppProject permits, in
+// stored order, along with the resourceVersion
+func (c *Client) GetSourceRepos(ctx context.Context, projectName string) ([]string, string, error) {
+	list, resourceVersion, err := c.getSpecList(ctx, projectName, "sourceRepos")
+	if err != nil {
+		return nil, "", err
+	}
+	return stringList(list), resourceVersion, nil
+}
+
+// AddSourceRepo permits a source repository in an AppProject (idempotent).
+// Result.Changed is false if the project already permits it.
+func (c *Client) AddSourceRepo(ctx context.Context, projectName, repo string) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "sourceRepos", func(list []interface{}) ([]interface{}, bool, error) {
+		for _, raw := range list {
+			if raw == repo {
+				return list, false, nil
+			}
+		}
+		return append(list, repo), true, nil
+	})
+}
+
+// RemoveSourceRepo stops permitting a source repository in an AppProject
+// (idempotent). Result.Changed is false if the project didn't permit it.
+func (c *Client) RemoveSourceRepo(ctx context.Context, projectName, repo string) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "sourceRepos", func(list []interface{}) ([]interface{}, bool, error) {
+		kept := []interface{}{}
+		for _, raw := range list {
+			if raw != repo {
+				kept = append(kept, raw)
+			}
+		}
+		return kept, len(kept) != len(list), nil
+	})
+}
@@ -0,0 +1,109 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getSpecList retrieves a list field of an AppProject's spec as stored, along
+// with the resourceVersion. A missing field is an empty list.
+func (c *Client) getSpecList(ctx context.Context, projectName, field string) ([]interface{}, string, error) {
+	project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+
+	list, _, err := unstructured.NestedSlice(project.Object, "spec", field)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read spec.%s of project %s: %w", field, projectName, err)
+	}
+	return list, project.GetResourceVersion(), nil
+}
+
+// updateSpecList changes a list field of an AppProject's spec the way
+// destinations are changed: update gets the stored entries and returns the
+// new ones and whether they differ, and the list is patched conditioned on
+// the resourceVersion it was read at, re-reading the project on conflict.
+// Entries update doesn't touch are kept as stored. Result.Changed is false if
+// update changed nothing.
+func (c *Client) updateSpecList(ctx context.Context, projectName, field string, update func([]interface{}) ([]interface{}, bool, error)) (Result, error) {
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		list, resourceVersion, err := c.getSpecList(ctx, projectName, field)
+		if err != nil {
+			return Result{}, err
+		}
+
+		newList, changed, err := update(list)
+		if err != nil {
+			return Result{}, err
+		}
+		if !changed {
+			return Result{ResourceVersion: resourceVersion}, nil
+		}
+
+		newVersion, err := c.patchSpecList(ctx, projectName, field, newList, resourceVersion)
+		if retry, err := c.retryConflict(err, attempt); retry {
+			continue
+		} else if err != nil {
+			return Result{}, err
+		}
+		return Result{Changed: true, ResourceVersion: newVersion}, nil
+	}
+}
+
+// patchSpecList replaces a list field of an AppProject's spec with the patch
+// type of Options.PatchStrategy. Like destination patches, the patch carries
+// the resourceVersion, so it fails with a conflict if the project changed.
+func (c *Client) patchSpecList(ctx context.Context, projectName, field string, list []interface{}, resourceVersion string) (string, error) {
+	if list == nil {
+		list = []interface{}{}
+	}
+
+	var patchType types.PatchType
+	var patch interface{}
+	switch c.options.PatchStrategy {
+	case PatchJSON:
+		patchType = types.JSONPatchType
+		patch = []jsonPatchOp{
+			{Op: "replace", Path: "/metadata/resourceVersion", Value: resourceVersion},
+			{Op: "add", Path: "/spec/" + escapeJSONPointer(field), Value: list},
+		}
+	case PatchMerge, "":
+		patchType = types.MergePatchType
+		patch = map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+			"spec":     map[string]interface{}{field: list},
+		}
+	default:
+		return "", fmt.Errorf("unknown patch strategy %q", c.options.PatchStrategy)
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal patch: %w", err)
+	}
+
+	if preview, ok := patchPreview(ctx); ok {
+		*preview = PatchPreview{PatchType: patchType, Patch: patchBytes, ResourceVersion: resourceVersion}
+		return resourceVersion, nil
+	}
+
+	updated, err := c.resource(ctx).Patch(ctx, projectName, patchType, patchBytes, metav1.PatchOptions{})
+	// A failed patch may still have been applied, e.g. on a timeout
+	c.invalidateCache(ctx)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return updated.GetResourceVersion(), nil
+}
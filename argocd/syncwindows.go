@@ -0,0 +1,122 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// SyncWindow is an entry of an AppProject's sync windows: a recurring period
+// in which syncs of the matching applications are allowed or denied
+type SyncWindow struct {
+	// Kind is "allow" or "deny"
+	Kind string `json:"kind"`
+	// Schedule is a cron expression for the start of the window
+	Schedule string `json:"schedule"`
+	// Duration is how long the window lasts, e.g. "1h"
+	Duration     string   `json:"duration"`
+	Applications []string `json:"applications,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
+	Clusters     []string `json:"clusters,omitempty"`
+	ManualSync   bool     `json:"manualSync,omitempty"`
+	TimeZone     string   `json:"timeZone,omitempty"`
+}
+
+// String describes the window for logs and audit entries
+func (sw SyncWindow) String() string {
+	return fmt.Sprintf("%s %q for %s", sw.Kind, sw.Schedule, sw.Duration)
+}
+
+// equal reports whether two windows are the same, comparing every field
+func (sw SyncWindow) equal(other SyncWindow) bool {
+	return sw.Kind == other.Kind && sw.Schedule == other.Schedule && sw.Duration == other.Duration &&
+		slices.Equal(sw.Applications, other.Applications) && slices.Equal(sw.Namespaces, other.Namespaces) &&
+		slices.Equal(sw.Clusters, other.Clusters) && sw.ManualSync == other.ManualSync && sw.TimeZone == other.TimeZone
+}
+
+// GetSyncWindows retrieves the sync windows of an AppProject, in stored
+// order, along with the resourceVersion
+func (c *Client) GetSyncWindows(ctx context.Context, projectName string) ([]SyncWindow, string, error) {
+	list, resourceVersion, err := c.getSpecList(ctx, projectName, "syncWindows")
+	if err != nil {
+		return nil, "", err
+	}
+	return parseSyncWindows(list), resourceVersion, nil
+}
+
+// AddSyncWindow adds a sync window to an AppProject (idempotent).
+// Result.Changed is false if the project already has an identical window.
+func (c *Client) AddSyncWindow(ctx context.Context, projectName string, sw SyncWindow) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "syncWindows", func(list []interface{}) ([]interface{}, bool, error) {
+		for _, raw := range list {
+			if stored, ok := parseSyncWindow(raw); ok && stored.equal(sw) {
+				return list, false, nil
+			}
+		}
+
+		entry := map[string]interface{}{
+			"kind":     sw.Kind,
+			"schedule": sw.Schedule,
+			"duration": sw.Duration,
+		}
+		for field, values := range map[string][]string{"applications": sw.Applications, "namespaces": sw.Namespaces, "clusters": sw.Clusters} {
+			if len(values) > 0 {
+				entry[field] = toInterfaceList(values)
+			}
+		}
+		if sw.ManualSync {
+			entry["manualSync"] = true
+		}
+		if sw.TimeZone != "" {
+			entry["timeZone"] = sw.TimeZone
+		}
+		return append(list, entry), true, nil
+	})
+}
+
+// RemoveSyncWindow removes the sync windows identical to sw from an
+// AppProject (idempotent). Result.Changed is false if there were none.
+func (c *Client) RemoveSyncWindow(ctx context.Context, projectName string, sw SyncWindow) (Result, error) {
+	return c.updateSpecList(ctx, projectName, "syncWindows", func(list []interface{}) ([]interface{}, bool, error) {
+		kept := []interface{}{}
+		for _, raw := range list {
+			if stored, ok := parseSyncWindow(raw); !ok || !stored.equal(sw) {
+				kept = append(kept, raw)
+			}
+		}
+		return kept, len(kept) != len(list), nil
+	})
+}
+
+// parseSyncWindows reads the stored sync windows, skipping malformed ones
+func parseSyncWindows(list []interface{}) []SyncWindow {
+	windows := []SyncWindow{}
+	for _, raw := range list {
+		if sw, ok := parseSyncWindow(raw); ok {
+			windows = append(windows, sw)
+		}
+	}
+	return windows
+}
+
+// parseSyncWindow reads a stored sync window. Empty lists are read as nil,
+// so they compare equal to omitted ones.
+func parseSyncWindow(raw interface{}) (SyncWindow, bool) {
+	entry, ok := raw.(map[string]interface{})
+	if !ok {
+		return SyncWindow{}, false
+	}
+
+	sw := SyncWindow{}
+	sw.Kind, _ = entry["kind"].(string)
+	sw.Schedule, _ = entry["schedule"].(string)
+	sw.Duration, _ = entry["duration"].(string)
+	sw.ManualSync, _ = entry["manualSync"].(bool)
+	sw.TimeZone, _ = entry["timeZone"].(string)
+	for field, values := range map[string]*[]string{"applications": &sw.Applications, "namespaces": &sw.Namespaces, "clusters": &sw.Clusters} {
+		if list := stringList(entry[field]); len(list) > 0 {
+			*values = list
+		}
+	}
+	return sw, true
+}
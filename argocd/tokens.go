@@ -0,0 +1,213 @@
+package argocd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ArgoCD signs its tokens with the server secret key stored in argocd-secret
+const (
+	argocdSecretName = "argocd-secret"
+	serverSecretKey  = "server.secretkey"
+)
+
+// ErrSigningKeyUnavailable is returned when ArgoCD's token signing key can't
+// be read from argocd-secret
+var ErrSigningKeyUnavailable = errors.New("ArgoCD token signing key unavailable")
+
+// RoleToken is a JWT issued for a project role. Only its ID and timestamps
+// are stored in the project; the token itself can't be retrieved again.
+type RoleToken struct {
+	ID        string `json:"id"`
+	Token     string `json:"token"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// CreateRoleToken issues a token for a project role like
+// `argocd proj role create-token` does: it records the token in the role's
+// jwtTokens (and in status.jwtTokensByRole, which newer ArgoCD versions
+// check instead, if the project has it), then signs it with ArgoCD's server
+// secret key. A zero expiresIn issues a token that doesn't expire. It fails
+// with ErrRoleNotFound if the project doesn't have the role.
+func (c *Client) CreateRoleToken(ctx context.Context, projectName, roleName string, expiresIn time.Duration) (RoleToken, Result, error) {
+	key, err := c.tokenSigningKey(ctx)
+	if err != nil {
+		return RoleToken{}, Result{}, err
+	}
+
+	unlock, err := c.lockProject(ctx, projectName)
+	if err != nil {
+		return RoleToken{}, Result{}, err
+	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		project, err := c.resource(ctx).Get(ctx, projectName, metav1.GetOptions{})
+		if err != nil {
+			return RoleToken{}, Result{}, wrapError(err)
+		}
+
+		id, err := newTokenID()
+		if err != nil {
+			return RoleToken{}, Result{}, err
+		}
+		token := RoleToken{ID: id, IssuedAt: time.Now().Unix()}
+		if expiresIn > 0 {
+			token.ExpiresAt = token.IssuedAt + int64(expiresIn.Seconds())
+		}
+
+		patchType, patchBytes, err := roleTokenPatch(c.options.PatchStrategy, project, roleName, token)
+		if err != nil {
+			return RoleToken{}, Result{}, err
+		}
+
+		updated, err := c.resource(ctx).Patch(ctx, projectName, patchType, patchBytes, metav1.PatchOptions{})
+		// A failed patch may still have been applied, e.g. on a timeout
+		c.invalidateCache(ctx)
+		if retry, err := c.retryConflict(wrapError(err), attempt); retry {
+			continue
+		} else if err != nil {
+			return RoleToken{}, Result{}, err
+		}
+
+		token.Token, err = signRoleToken(key, projectName, roleName, token)
+		if err != nil {
+			return RoleToken{}, Result{}, err
+		}
+		return token, Result{Changed: true, ResourceVersion: updated.GetResourceVersion()}, nil
+	}
+}
+
+// roleTokenPatch builds the patch recording token for the role, replacing
+// the project's roles and token status as a whole. Like destination patches,
+// it carries the project's resourceVersion.
+func roleTokenPatch(strategy PatchStrategy, project *unstructured.Unstructured, roleName string, token RoleToken) (types.PatchType, []byte, error) {
+	roles, _, err := unstructured.NestedSlice(project.Object, "spec", "roles")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read spec.roles of project %s: %w", project.GetName(), err)
+	}
+	i := findRole(roles, roleName)
+	if i < 0 {
+		return "", nil, fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+
+	entry := map[string]interface{}{"iat": token.IssuedAt, "id": token.ID}
+	if token.ExpiresAt != 0 {
+		entry["exp"] = token.ExpiresAt
+	}
+	role := roles[i].(map[string]interface{})
+	tokens, _ := role["jwtTokens"].([]interface{})
+	role["jwtTokens"] = append(tokens, entry)
+
+	byRole, hasStatus, _ := unstructured.NestedMap(project.Object, "status", "jwtTokensByRole")
+	if hasStatus {
+		status, _ := byRole[roleName].(map[string]interface{})
+		if status == nil {
+			status = map[string]interface{}{}
+		}
+		items, _ := status["items"].([]interface{})
+		status["items"] = append(items, entry)
+		byRole[roleName] = status
+	}
+
+	var patchType types.PatchType
+	var patch interface{}
+	switch strategy {
+	case PatchJSON:
+		patchType = types.JSONPatchType
+		ops := []jsonPatchOp{
+			{Op: "replace", Path: "/metadata/resourceVersion", Value: project.GetResourceVersion()},
+			{Op: "add", Path: "/spec/roles", Value: roles},
+		}
+		if hasStatus {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/status/jwtTokensByRole", Value: byRole})
+		}
+		patch = ops
+	case PatchMerge, "":
+		patchType = types.MergePatchType
+		merge := map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": project.GetResourceVersion()},
+			"spec":     map[string]interface{}{"roles": roles},
+		}
+		if hasStatus {
+			merge["status"] = map[string]interface{}{"jwtTokensByRole": byRole}
+		}
+		patch = merge
+	default:
+		return "", nil, fmt.Errorf("unknown patch strategy %q", strategy)
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return patchType, patchBytes, nil
+}
+
+// tokenSigningKey reads ArgoCD's server secret key from argocd-secret in the
+// ArgoCD namespace
+func (c *Client) tokenSigningKey(ctx context.Context) ([]byte, error) {
+	secret, err := c.dynamicClient.Resource(secretGVR).Namespace(c.Namespace(ctx)).Get(ctx, argocdSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSigningKeyUnavailable, err)
+	}
+
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	key := decodeSecretValue(data[serverSecretKey])
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s has no %s", ErrSigningKeyUnavailable, argocdSecretName, serverSecretKey)
+	}
+	return []byte(key), nil
+}
+
+// signRoleToken signs token with the claims ArgoCD gives project role
+// tokens, as an HS256 JWT
+func signRoleToken(key []byte, projectName, roleName string, token RoleToken) (string, error) {
+	claims := map[string]interface{}{
+		"iss": "argocd",
+		"sub": fmt.Sprintf("proj:%s:%s", projectName, roleName),
+		"jti": token.ID,
+		"iat": token.IssuedAt,
+		"nbf": token.IssuedAt,
+	}
+	if token.ExpiresAt != 0 {
+		claims["exp"] = token.ExpiresAt
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token header: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// newTokenID returns a random UUID, the token ID format ArgoCD uses
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,145 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// Bounds of the exponential backoff between attempts to re-establish a watch
+const (
+	watchInitialBackoff = time.Second
+	watchMaxBackoff     = 30 * time.Second
+)
+
+// ProjectEvent is a change to an AppProject seen by WatchProjects
+type ProjectEvent struct {
+	// Type is watch.Added, watch.Modified or watch.Deleted
+	Type    watch.EventType
+	Project Project
+}
+
+// WatchProjects calls fn for every change to the AppProjects matching the
+// label selector until ctx is cancelled or fn returns an error, which is
+// returned. The watch starts with an Added event for every existing project
+// and survives API server restarts; see watchWithRetry.
+func (c *Client) WatchProjects(ctx context.Context, labelSelector string, fn func(ProjectEvent) error) error {
+	opts := metav1.ListOptions{LabelSelector: labelSelector}
+	return watchWithRetry(ctx, c.resource(ctx), opts, func(event watch.Event) error {
+		item, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			return nil
+		}
+		return fn(ProjectEvent{Type: event.Type, Project: c.projectFromItem(item)})
+	})
+}
+
+// watchWithRetry watches a resource and calls fn for every Added, Modified and
+// Deleted event until ctx is cancelled or fn returns an error. When the watch
+// drops it is re-established from the last resourceVersion seen, including
+// bookmarks, so no events are missed; attempts back off exponentially while
+// the API server is unavailable. If that resourceVersion has expired, the
+// watch restarts from the current state, replaying it as Added events.
+func watchWithRetry(ctx context.Context, resource dynamic.ResourceInterface, opts metav1.ListOptions, fn func(watch.Event) error) error {
+	opts.Watch = true
+	opts.AllowWatchBookmarks = true
+	backoff := watchInitialBackoff
+
+	for {
+		delivered, err := watchOnce(ctx, resource, &opts, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var handlerErr *watchHandlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+
+		if delivered {
+			backoff = watchInitialBackoff
+		}
+		if err != nil {
+			log.Printf("Watch dropped, retrying in %s: %v", backoff, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > watchMaxBackoff {
+			backoff = watchMaxBackoff
+		}
+	}
+}
+
+// watchHandlerError marks an error returned by the event handler, which ends
+// the watch instead of being retried
+type watchHandlerError struct {
+	err error
+}
+
+func (e *watchHandlerError) Error() string {
+	return e.err.Error()
+}
+
+// watchOnce runs a single watch until it ends, advancing opts.ResourceVersion
+// past every event seen. It reports whether any event was delivered, and why
+// the watch ended if not cleanly.
+func watchOnce(ctx context.Context, resource dynamic.ResourceInterface, opts *metav1.ListOptions, fn func(watch.Event) error) (bool, error) {
+	w, err := resource.Watch(ctx, *opts)
+	if err != nil {
+		if k8serrors.IsResourceExpired(err) || k8serrors.IsGone(err) {
+			opts.ResourceVersion = ""
+		}
+		return false, wrapError(err)
+	}
+	defer w.Stop()
+
+	delivered := false
+	for {
+		select {
+		case <-ctx.Done():
+			return delivered, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return delivered, nil
+			}
+
+			switch event.Type {
+			case watch.Error:
+				status := k8serrors.FromObject(event.Object)
+				if statusErr, ok := status.(*k8serrors.StatusError); ok && statusErr.Status().Code == http.StatusGone {
+					opts.ResourceVersion = ""
+				}
+				return delivered, fmt.Errorf("watch error: %w", status)
+			case watch.Bookmark:
+				if obj, ok := event.Object.(metav1.Object); ok {
+					opts.ResourceVersion = obj.GetResourceVersion()
+				}
+				continue
+			}
+
+			if obj, ok := event.Object.(metav1.Object); ok {
+				opts.ResourceVersion = obj.GetResourceVersion()
+			}
+			delivered = true
+			if err := fn(event); err != nil {
+				return delivered, &watchHandlerError{err: err}
+			}
+		}
+	}
+}
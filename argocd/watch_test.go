@@ -0,0 +1,114 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// startedWatch is a watch the fake client handed out, with the
+// resourceVersion it was started from
+type startedWatch struct {
+	*watch.FakeWatcher
+	resourceVersion string
+}
+
+// receive returns the next value of ch, failing the test if none arrives
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+// projectAt returns an AppProject at the given resourceVersion
+func projectAt(name, resourceVersion string) *unstructured.Unstructured {
+	project := newTestProject(name)
+	project.SetResourceVersion(resourceVersion)
+	return project
+}
+
+func TestWatchProjectsResumesAfterDrop(t *testing.T) {
+	client, dyn := newTestClient(t, Options{})
+
+	watches := make(chan startedWatch, 3)
+	dyn.PrependWatchReactor("appprojects", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		watches <- startedWatch{w, action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion}
+		return true, w, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan ProjectEvent)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WatchProjects(ctx, "", func(event ProjectEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	first := receive(t, watches, "the first watch")
+	if first.resourceVersion != "" {
+		t.Errorf("first watch from resourceVersion %q, want the current state", first.resourceVersion)
+	}
+	first.Add(projectAt("team-a", "5"))
+	if event := receive(t, events, "the added event"); event.Type != watch.Added || event.Project.Name != "team-a" {
+		t.Errorf("event = %s %s, want ADDED team-a", event.Type, event.Project.Name)
+	}
+
+	// The API server closes the watch: it resumes after the last event seen
+	first.Stop()
+	second := receive(t, watches, "the watch to resume")
+	if second.resourceVersion != "5" {
+		t.Errorf("resumed watch from resourceVersion %q, want 5", second.resourceVersion)
+	}
+	second.Modify(projectAt("team-a", "6"))
+	if event := receive(t, events, "the modified event"); event.Type != watch.Modified || event.Project.Name != "team-a" {
+		t.Errorf("event = %s %s, want MODIFIED team-a", event.Type, event.Project.Name)
+	}
+
+	// Once that resourceVersion has expired it re-lists from the current state
+	expired := apierrors.NewResourceExpired("too old resource version: 6").ErrStatus
+	second.Error(&expired)
+	third := receive(t, watches, "the watch to restart")
+	if third.resourceVersion != "" {
+		t.Errorf("restarted watch from resourceVersion %q, want the current state", third.resourceVersion)
+	}
+	third.Add(projectAt("team-b", "9"))
+	if event := receive(t, events, "the replayed event"); event.Type != watch.Added || event.Project.Name != "team-b" {
+		t.Errorf("event = %s %s, want ADDED team-b", event.Type, event.Project.Name)
+	}
+
+	cancel()
+	if err := receive(t, done, "the watch to end"); !errors.Is(err, context.Canceled) {
+		t.Errorf("WatchProjects() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWatchProjectsHandlerError(t *testing.T) {
+	client, dyn := newTestClient(t, Options{})
+
+	w := watch.NewFake()
+	dyn.PrependWatchReactor("appprojects", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, w, nil
+	})
+	go w.Add(projectAt("team-a", "5"))
+
+	stop := errors.New("stop")
+	err := client.WatchProjects(context.Background(), "", func(ProjectEvent) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Fatalf("WatchProjects() error = %v, want the handler's error", err)
+	}
+}
@@ -1,46 +1,190 @@
 package audit
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"sync"
 	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
 )
 
 // Entry represents a single audit log entry
 type Entry struct {
-	Timestamp   time.Time `json:"timestamp"`
-	Action      string    `json:"action"` // "add" or "remove"
-	Project     string    `json:"project"`
-	Server      string    `json:"server"`
-	Namespace   string    `json:"namespace"`
-	Name        string    `json:"name,omitempty"`
-	Description string    `json:"description"`
-	UserAgent   string    `json:"user_agent,omitempty"`
-	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	Timestamp       time.Time  `json:"timestamp"`
+	Action          string     `json:"action"` // "add", "remove", "metadata", "update_metadata", "import", "expire", "restore", "purge", "create_project", "delete_project", "add_source_repo", "remove_source_repo", "add_cluster_resource_whitelist", "remove_cluster_resource_whitelist", the same for namespace_resource_whitelist and namespace_resource_blacklist, "create_role", "delete_role", "add_role_policy", "remove_role_policy", "add_role_group", "remove_role_group", "create_role_token", "create_sync_window", "delete_sync_window", "add_signature_key", "remove_signature_key", "update_project_metadata" or "update_project_settings"
+	Actor           string     `json:"actor,omitempty"`
+	APIKey          string     `json:"api_key,omitempty"` // key name, when the actor came from a trusted upstream
+	Project         string     `json:"project"`
+	ArgoCDNamespace string     `json:"argocd_namespace,omitempty"`
+	Server          string     `json:"server"`
+	Namespace       string     `json:"namespace"`
+	Name            string     `json:"name,omitempty"`
+	Item            string     `json:"item,omitempty"` // project spec entry a change other than to a destination targets, e.g. a source repo
+	Description     string     `json:"description"`
+	TicketID        string     `json:"ticket_id,omitempty"`
+	Wildcard        bool       `json:"wildcard,omitempty"`   // server or namespace is "*"
+	MatchedBy       string     `json:"matched_by,omitempty"` // "server_namespace", "namespace" or "index" when a removal didn't match by value
+	Matches         int        `json:"matches,omitempty"`    // destinations such a removal matched
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	InUseBy         []string   `json:"in_use_by,omitempty"` // Applications that blocked a removal
+	Forced          bool       `json:"forced,omitempty"`    // removal skipped the in-use check with force=true
+	Mirror          bool       `json:"mirror,omitempty"`    // replay of a change in the mirror namespace
+	Outcome         string     `json:"outcome"`             // "success", "noop", "denied" or "error"
+	Status          int        `json:"status"`
+	Route           string     `json:"route,omitempty"`
+	RequestID       string     `json:"request_id,omitempty"`
+	UserAgent       string     `json:"user_agent,omitempty"`
+	RemoteAddr      string     `json:"remote_addr,omitempty"`
+	// Labels are the static labels of the logger, such as the cluster and
+	// region, nested so they can't clash with the fields above
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ErrWritePending is returned by LogContext when it stopped waiting for a
+// write that will still complete
+var ErrWritePending = errors.New("audit write still in progress")
+
+// Outcomes recorded on audit entries
+const (
+	OutcomeSuccess = "success"
+	OutcomeNoop    = "noop"
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+)
+
+// MatchServerNamespace marks removals that matched destinations by server and
+// namespace only, so the entry may be one of several removed by one request
+const MatchServerNamespace = "server_namespace"
+
+// MatchNamespace marks removals that matched every destination of a namespace,
+// on any server
+const MatchNamespace = "namespace"
+
+// MatchIndex marks removals that targeted a destination by its index in the
+// project's list
+const MatchIndex = "index"
+
+// OutcomeForStatus maps an HTTP status code to an audit outcome
+func OutcomeForStatus(status int) string {
+	switch {
+	case status < 400:
+		return OutcomeSuccess
+	case status < 500:
+		return OutcomeDenied
+	default:
+		return OutcomeError
+	}
 }
 
 // Logger handles audit logging to a file
 type Logger struct {
+	path string
+	// file is nil when the logger only forwards entries to its sinks
 	file *os.File
 	mu   sync.Mutex
+	// size tracks the file size so metrics don't need a stat per write
+	size int64
+	// failures counts consecutive failed writes; lastErr is the most recent one
+	failures int
+	lastErr  error
+	// sinks receive a copy of every entry
+	sinks []Sink
+	// labels are added to every entry
+	labels map[string]string
 }
 
-// NewLogger creates a new audit logger that writes to the specified file path
+// NewLogger creates a new audit logger that writes to the specified file path.
+// An empty path disables the file, so entries only go to the sinks.
 func NewLogger(filePath string) (*Logger, error) {
-	// Open file in append mode, create if doesn't exist
+	if filePath == "" {
+		return &Logger{}, nil
+	}
+
+	file, size, err := openLogFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AuditLogSize.Set(float64(size))
+
+	return &Logger{path: filePath, file: file, size: size}, nil
+}
+
+// openLogFile opens the audit log file for appending, creating it if it
+// doesn't exist, and returns its current size
+func openLogFile(filePath string) (*os.File, int64, error) {
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+		return nil, 0, fmt.Errorf("failed to open audit log file: %w", err)
 	}
 
-	return &Logger{file: file}, nil
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat audit log file: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+// Reopen reopens the audit log file at its configured path, for external log
+// rotation that renames the file and then signals the process. Writes wait for
+// the reopen, so every entry lands in either the old or the new file. If the
+// path can't be opened, the logger keeps writing to the old file.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	file, size, err := openLogFile(l.path)
+	if err != nil {
+		return err
+	}
+
+	old := l.file
+	l.file = file
+	l.size = size
+	metrics.AuditLogSize.Set(float64(size))
+
+	if err := old.Close(); err != nil {
+		log.Printf("Failed to close rotated audit log file: %v", err)
+	}
+	return nil
 }
 
-// Log writes an audit entry to the log file
+// AddSink forwards every entry logged from now on to sink. It must be called
+// before the logger is used concurrently.
+func (l *Logger) AddSink(sink Sink) {
+	l.sinks = append(l.sinks, sink)
+}
+
+// SetLabels adds labels to every entry logged from now on. Labels the entry
+// already carries take precedence. It must be called before the logger is
+// used concurrently.
+func (l *Logger) SetLabels(labels map[string]string) {
+	l.labels = labels
+}
+
+// Log writes an audit entry to the log file and forwards it to the sinks. Only
+// failures to write the file are returned.
 func (l *Logger) Log(entry Entry) error {
 	entry.Timestamp = time.Now().UTC()
+	if len(l.labels) > 0 {
+		labels := make(map[string]string, len(l.labels)+len(entry.Labels))
+		for key, value := range l.labels {
+			labels[key] = value
+		}
+		for key, value := range entry.Labels {
+			labels[key] = value
+		}
+		entry.Labels = labels
+	}
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -50,15 +194,99 @@ func (l *Logger) Log(entry Entry) error {
 		return fmt.Errorf("failed to marshal audit entry: %w", err)
 	}
 
+	for _, sink := range l.sinks {
+		sink.Send(entry)
+	}
+
+	if l.file == nil {
+		metrics.AuditEntriesWritten.Inc()
+		metrics.AuditLastWrite.Set(float64(entry.Timestamp.Unix()))
+		return nil
+	}
+
 	// Write as newline-delimited JSON
-	if _, err := l.file.Write(append(data, '\n')); err != nil {
+	n, err := l.file.Write(append(data, '\n'))
+	l.recordSize(n)
+	if err != nil {
+		l.recordFailure(err)
 		return fmt.Errorf("failed to write audit entry: %w", err)
 	}
 
+	l.failures = 0
+	l.lastErr = nil
+	metrics.AuditEntriesWritten.Inc()
+	metrics.AuditLastWrite.Set(float64(entry.Timestamp.Unix()))
+	return nil
+}
+
+// LogContext writes an audit entry like Log, but stops waiting for the write
+// when ctx is done, e.g. because the request timed out while another write
+// held up the log file. The entry is still written once the file is free, so
+// a change that was made is never left unaudited because its client went
+// away; ErrWritePending is returned in that case.
+func (l *Logger) LogContext(ctx context.Context, entry Entry) error {
+	if ctx.Done() == nil {
+		return l.Log(entry)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Log(entry)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrWritePending, ctx.Err())
+	}
+}
+
+// Check returns an error if audit entries can't currently be written. After a
+// failed write it probes the log file with an empty line, which readers skip,
+// so a recovered log (e.g. after disk space was freed) is noticed without
+// waiting for the next entry.
+func (l *Logger) Check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failures == 0 {
+		return nil
+	}
+
+	n, err := l.file.Write([]byte{'\n'})
+	l.recordSize(n)
+	if err != nil {
+		l.recordFailure(err)
+		return fmt.Errorf("%d consecutive audit log writes failed: %w", l.failures, l.lastErr)
+	}
+
+	log.Printf("Audit log writes recovered after %d consecutive failures", l.failures)
+	l.failures = 0
+	l.lastErr = nil
 	return nil
 }
 
-// Close closes the audit log file
+// recordSize adds n written bytes to the tracked file size. The caller must
+// hold l.mu.
+func (l *Logger) recordSize(n int) {
+	l.size += int64(n)
+	metrics.AuditLogSize.Set(float64(l.size))
+}
+
+// recordFailure counts a failed write. The caller must hold l.mu.
+func (l *Logger) recordFailure(err error) {
+	l.failures++
+	l.lastErr = err
+}
+
+// Close closes the sinks and the audit log file
 func (l *Logger) Close() error {
+	for _, sink := range l.sinks {
+		sink.Close()
+	}
+	if l.file == nil {
+		return nil
+	}
 	return l.file.Close()
 }
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// maxEntrySize bounds the length of a single audit log line when reading
+const maxEntrySize = 1 << 20
+
+// ErrNoLogFile is returned by Query when the logger doesn't write a file
+var ErrNoLogFile = errors.New("audit log file is disabled")
+
+// Query selects audit entries. Zero values match everything.
+type Query struct {
+	Project         string
+	ArgoCDNamespace string
+	Since           time.Time
+	Until           time.Time
+	// SuccessOnly skips denied and failed attempts
+	SuccessOnly bool
+	Actor       string
+	Outcome     string
+	TicketID    string
+	// Limit keeps only the most recent matching entries
+	Limit int
+}
+
+// Query reads the audit log and returns the entries matching q in
+// chronological order. Lines that can't be parsed are skipped.
+func (l *Logger) Query(q Query) ([]Entry, error) {
+	if l.file == nil {
+		return nil, ErrNoLogFile
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+
+	entries := []Entry{}
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !q.matches(entry) {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if q.Limit > 0 && len(entries) > q.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// matches reports whether an entry is selected by the query
+func (q Query) matches(entry Entry) bool {
+	if q.Project != "" && entry.Project != q.Project {
+		return false
+	}
+	// Entries written before namespaces were recorded match any namespace
+	if q.ArgoCDNamespace != "" && entry.ArgoCDNamespace != "" && entry.ArgoCDNamespace != q.ArgoCDNamespace {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Timestamp.After(q.Until) {
+		return false
+	}
+	// Entries written before outcomes were recorded were all successes
+	if q.SuccessOnly && entry.Outcome != "" && entry.Outcome != OutcomeSuccess {
+		return false
+	}
+	if q.Outcome != "" && entry.Outcome != q.Outcome && (entry.Outcome != "" || q.Outcome != OutcomeSuccess) {
+		return false
+	}
+	if q.Actor != "" && entry.Actor != q.Actor {
+		return false
+	}
+	if q.TicketID != "" && entry.TicketID != q.TicketID {
+		return false
+	}
+	return true
+}
+
+// ErrInvalidCursor is returned by Page when the cursor doesn't point at the
+// start of an entry, e.g. because the log was rotated since it was issued
+var ErrInvalidCursor = errors.New("invalid audit log cursor")
+
+// Page reads the audit log forward from cursor, the byte offset of an entry,
+// and returns up to limit entries matching q in chronological order. Only the
+// part of the log after the cursor is read, so paging through a large log
+// costs the same for every page. It also returns the cursor of the entry after
+// the last one read and whether the log may hold more matches; a page cut
+// short by the end of the log can be polled again from the returned cursor
+// for entries written since. Lines that can't be parsed are skipped.
+func (l *Logger) Page(q Query, cursor int64, limit int) ([]Entry, int64, bool, error) {
+	if l.file == nil {
+		return nil, 0, false, ErrNoLogFile
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	defer file.Close()
+
+	if err := seekEntry(file, cursor); err != nil {
+		return nil, 0, false, err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	entries := []Entry{}
+	for len(entries) < limit {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// An unterminated line is an entry still being written; it is
+			// read again from the same cursor by the next page
+			return entries, cursor, false, nil
+		}
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("failed to read audit log file: %w", err)
+		}
+		cursor += int64(len(line))
+
+		if len(line) > maxEntrySize {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if q.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, cursor, true, nil
+}
+
+// seekEntry moves to the byte offset of an entry, checking that it is within
+// the log and follows a line break
+func seekEntry(file *os.File, cursor int64) error {
+	if cursor == 0 {
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read audit log file: %w", err)
+	}
+	if cursor < 0 || cursor > info.Size() {
+		return fmt.Errorf("%w: offset %d is outside the log", ErrInvalidCursor, cursor)
+	}
+
+	previous := make([]byte, 1)
+	if _, err := file.ReadAt(previous, cursor-1); err != nil {
+		return fmt.Errorf("failed to read audit log file: %w", err)
+	}
+	if previous[0] != '\n' {
+		return fmt.Errorf("%w: offset %d is not the start of an entry", ErrInvalidCursor, cursor)
+	}
+
+	if _, err := file.Seek(cursor, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read audit log file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// WriterSink writes audit entries to a writer in the same newline-delimited
+// JSON format as the log file
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a sink that writes entries to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStdoutSink creates a sink that writes entries to stdout, e.g. for
+// container log collection
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// Send writes the entry as a single line. Writes are serialized so entries
+// never interleave.
+func (s *WriterSink) Send(entry Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal audit entry for stdout: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit entry to stdout: %v", err)
+	}
+}
+
+// Close is a no-op; the writer is owned by the caller
+func (s *WriterSink) Close() error {
+	return nil
+}
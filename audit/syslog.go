@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/syslog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// Default syslog sink settings
+const (
+	DefaultSyslogTag       = "argocd-destination-api"
+	DefaultSyslogQueueSize = 1000
+	// syslogRedialInterval is the minimum time between attempts to connect
+	// to an unreachable syslog daemon
+	syslogRedialInterval = 30 * time.Second
+)
+
+// syslogFacilities maps facility names to their priorities
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+	"cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// SyslogConfig configures a SyslogSink
+type SyslogConfig struct {
+	// Network is "udp" or "tcp", or empty for the local syslog daemon, in
+	// which case Address is ignored
+	Network  string
+	Address  string
+	Facility string
+	Tag      string
+}
+
+// ParseSyslogFacility returns the priority of a facility name such as "auth"
+// or "local0"
+func ParseSyslogFacility(name string) (syslog.Priority, error) {
+	facility, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
+
+// SyslogSink writes audit entries as JSON messages to syslog from a background
+// worker. Successful and no-op changes are logged at notice severity, denied
+// ones at warning and failed ones at error. An unreachable daemon never
+// affects the log file: entries are dropped and the connection is retried at
+// most every 30 seconds.
+type SyslogSink struct {
+	config   SyslogConfig
+	facility syslog.Priority
+	queue    chan Entry
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+
+	// writer and dialed are only used by the worker
+	writer *syslog.Writer
+	dialed time.Time
+}
+
+// NewSyslogSink creates a syslog sink and starts its worker. The daemon is
+// connected to lazily, so an unreachable one doesn't prevent startup.
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	if config.Network != "" && config.Network != "udp" && config.Network != "tcp" {
+		return nil, fmt.Errorf("syslog network must be udp, tcp or empty for the local daemon, got %q", config.Network)
+	}
+	if config.Network != "" && config.Address == "" {
+		return nil, fmt.Errorf("syslog address is required for network %s", config.Network)
+	}
+	if config.Network == "" {
+		config.Address = ""
+	}
+	if config.Tag == "" {
+		config.Tag = DefaultSyslogTag
+	}
+	facility, err := ParseSyslogFacility(config.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SyslogSink{
+		config:   config,
+		facility: facility,
+		queue:    make(chan Entry, DefaultSyslogQueueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Send queues an entry for syslog, dropping it if the queue is full
+func (s *SyslogSink) Send(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		metrics.AuditSyslogDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// Close stops accepting entries, waits for the queued ones to be written or
+// dropped and closes the connection
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	if s.writer != nil {
+		return s.writer.Close()
+	}
+	return nil
+}
+
+// run writes queued entries until the queue is closed
+func (s *SyslogSink) run() {
+	defer close(s.done)
+
+	for entry := range s.queue {
+		if err := s.write(entry); err != nil {
+			metrics.AuditSyslogDropped.WithLabelValues("failed").Inc()
+		}
+	}
+}
+
+// write sends one entry, connecting first if needed
+func (s *SyslogSink) write(entry Entry) error {
+	if s.writer == nil {
+		if !s.dialed.IsZero() && time.Since(s.dialed) < syslogRedialInterval {
+			return fmt.Errorf("syslog unreachable")
+		}
+		s.dialed = time.Now()
+
+		writer, err := syslog.Dial(s.config.Network, s.config.Address, s.facility|syslog.LOG_NOTICE, s.config.Tag)
+		if err != nil {
+			log.Printf("Failed to connect to syslog, dropping audit entries for %s: %v", syslogRedialInterval, err)
+			return err
+		}
+		s.writer = writer
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// The writer reconnects once by itself if the connection was lost
+	switch entry.Outcome {
+	case OutcomeDenied:
+		err = s.writer.Warning(string(data))
+	case OutcomeError:
+		err = s.writer.Err(string(data))
+	default:
+		err = s.writer.Notice(string(data))
+	}
+	if err != nil {
+		log.Printf("Failed to write audit entry to syslog: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,236 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// Sink receives a copy of every audit entry in addition to the log file.
+// Send must not block, so that a slow sink never holds up a mutation.
+type Sink interface {
+	Send(entry Entry)
+	Close() error
+}
+
+// Default webhook sink settings
+const (
+	DefaultWebhookTimeout          = 5 * time.Second
+	DefaultWebhookQueueSize        = 1000
+	DefaultWebhookMaxRetries       = 2
+	DefaultWebhookFailureThreshold = 5
+	DefaultWebhookCooldown         = 30 * time.Second
+)
+
+// webhookRetryBackoff is the delay before the first retry of a failed
+// delivery; it doubles with every further retry
+const webhookRetryBackoff = 100 * time.Millisecond
+
+// WebhookConfig configures a WebhookSink. Zero timeouts, sizes and thresholds
+// use the defaults above.
+type WebhookConfig struct {
+	URL     string
+	Timeout time.Duration
+	// QueueSize bounds the entries waiting for delivery. Entries sent while
+	// the queue is full are dropped.
+	QueueSize int
+	// MaxRetries is how often a failed delivery is retried before it counts
+	// as a failure
+	MaxRetries int
+	// FailureThreshold is the number of consecutive failed deliveries that
+	// opens the circuit
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a single entry is
+	// sent to probe whether the endpoint has recovered
+	Cooldown time.Duration
+}
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// WebhookSink POSTs audit entries as JSON to a URL from a background worker.
+// A circuit breaker stops deliveries to an endpoint that keeps failing: after
+// FailureThreshold consecutive failures entries are dropped for Cooldown,
+// then one entry probes the endpoint and closes the circuit if it succeeds.
+type WebhookSink struct {
+	config WebhookConfig
+	client *http.Client
+	queue  chan Entry
+	done   chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewWebhookSink creates a webhook sink and starts its delivery worker
+func NewWebhookSink(config WebhookConfig) (*WebhookSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultWebhookQueueSize
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultWebhookFailureThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultWebhookCooldown
+	}
+
+	s := &WebhookSink{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan Entry, config.QueueSize),
+		done:   make(chan struct{}),
+		state:  circuitClosed,
+	}
+	go s.run()
+	return s, nil
+}
+
+// Send queues an entry for delivery, dropping it if the queue is full
+func (s *WebhookSink) Send(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		metrics.AuditWebhookDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// Close stops accepting entries and waits for the queued ones to be
+// delivered or dropped
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+// run delivers queued entries until the queue is closed
+func (s *WebhookSink) run() {
+	defer close(s.done)
+
+	for entry := range s.queue {
+		probe, ok := s.allow()
+		if !ok {
+			metrics.AuditWebhookDropped.WithLabelValues("circuit_open").Inc()
+			continue
+		}
+
+		// A probe is sent once so a dead endpoint doesn't hold the worker
+		retries := s.config.MaxRetries
+		if probe {
+			retries = 0
+		}
+
+		err := s.deliver(entry, retries)
+		s.record(err)
+		if err != nil {
+			metrics.AuditWebhookDropped.WithLabelValues("failed").Inc()
+		}
+	}
+}
+
+// allow reports whether an entry may be delivered and whether it is the probe
+// of a half-open circuit
+func (s *WebhookSink) allow() (probe bool, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case circuitOpen:
+		if time.Since(s.openedAt) < s.config.Cooldown {
+			return false, false
+		}
+		s.state = circuitHalfOpen
+		return true, true
+	case circuitHalfOpen:
+		return true, true
+	}
+	return false, true
+}
+
+// record updates the circuit with the result of a delivery
+func (s *WebhookSink) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if s.state != circuitClosed {
+			log.Printf("Audit webhook recovered, closing circuit")
+		}
+		s.state = circuitClosed
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if s.state == circuitHalfOpen || (s.state == circuitClosed && s.failures >= s.config.FailureThreshold) {
+		log.Printf("Audit webhook failed %d times in a row, dropping entries for %s: %v",
+			s.failures, s.config.Cooldown, err)
+		s.state = circuitOpen
+		s.openedAt = time.Now()
+	}
+}
+
+// deliver POSTs an entry, retrying failed attempts with exponential backoff
+func (s *WebhookSink) deliver(entry Entry, retries int) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	backoff := webhookRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(data)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends one delivery attempt
+func (s *WebhookSink) post(data []byte) error {
+	resp, err := s.client.Post(s.config.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/argocd-destination-api/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// webhookServer is an endpoint that fails until it is told to recover,
+// recording the projects of the entries it accepted
+type webhookServer struct {
+	*httptest.Server
+	healthy atomic.Bool
+	hits    atomic.Int32
+
+	mu       sync.Mutex
+	accepted []string
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	t.Helper()
+	ws := &webhookServer{}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.hits.Add(1)
+		if !ws.healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var entry Entry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			t.Errorf("decoding webhook entry: %v", err)
+		}
+		ws.mu.Lock()
+		ws.accepted = append(ws.accepted, entry.Project)
+		ws.mu.Unlock()
+	}))
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+func (ws *webhookServer) Accepted() []string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return append([]string(nil), ws.accepted...)
+}
+
+// circuit returns the breaker state and consecutive failures of a sink
+func (s *WebhookSink) circuit() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, s.failures
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitForCircuit waits until the sink's breaker has the given state and
+// failure count
+func waitForCircuit(t *testing.T, sink *WebhookSink, state string, failures int) {
+	t.Helper()
+	waitFor(t, "circuit "+state, func() bool {
+		gotState, gotFailures := sink.circuit()
+		return gotState == state && gotFailures == failures
+	})
+}
+
+func TestWebhookCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	server := newWebhookServer(t)
+	sink, err := NewWebhookSink(WebhookConfig{URL: server.URL, MaxRetries: 1, FailureThreshold: 2, Cooldown: cooldown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	droppedOpen := metrics.AuditWebhookDropped.WithLabelValues("circuit_open")
+	droppedFailed := metrics.AuditWebhookDropped.WithLabelValues("failed")
+	open, failed := testutil.ToFloat64(droppedOpen), testutil.ToFloat64(droppedFailed)
+
+	// Failed deliveries are retried, and the threshold of consecutive
+	// failures opens the circuit
+	sink.Send(Entry{Project: "failing-1"})
+	waitForCircuit(t, sink, circuitClosed, 1)
+	if got := server.hits.Load(); got != 2 {
+		t.Errorf("hits = %d, want 2 attempts of the first entry", got)
+	}
+	sink.Send(Entry{Project: "failing-2"})
+	waitForCircuit(t, sink, circuitOpen, 2)
+	hits := server.hits.Load()
+
+	// While open, entries are dropped without a request
+	sink.Send(Entry{Project: "dropped"})
+	waitFor(t, "entry dropped by the open circuit", func() bool { return testutil.ToFloat64(droppedOpen)-open == 1 })
+	if got := server.hits.Load(); got != hits {
+		t.Errorf("hits = %d while open, want %d", got, hits)
+	}
+
+	// After the cooldown a single attempt probes the endpoint, and a failed
+	// probe reopens the circuit
+	time.Sleep(cooldown)
+	sink.Send(Entry{Project: "failed-probe"})
+	waitForCircuit(t, sink, circuitOpen, 3)
+	if got := server.hits.Load(); got != hits+1 {
+		t.Errorf("hits = %d after a failed probe, want %d", got, hits+1)
+	}
+
+	// A successful probe closes the circuit again
+	server.healthy.Store(true)
+	time.Sleep(cooldown)
+	sink.Send(Entry{Project: "probe"})
+	waitForCircuit(t, sink, circuitClosed, 0)
+	sink.Send(Entry{Project: "recovered"})
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Accepted(); len(got) != 2 || got[0] != "probe" || got[1] != "recovered" {
+		t.Errorf("accepted entries = %v, want [probe recovered]", got)
+	}
+	if got := testutil.ToFloat64(droppedFailed) - failed; got != 3 {
+		t.Errorf("failed entries = %g, want 3", got)
+	}
+}
+
+func TestWebhookCircuitStaysOpenDuringCooldown(t *testing.T) {
+	server := newWebhookServer(t)
+	sink, err := NewWebhookSink(WebhookConfig{URL: server.URL, FailureThreshold: 1, Cooldown: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.Send(Entry{Project: "failing"})
+	waitForCircuit(t, sink, circuitOpen, 1)
+	server.healthy.Store(true)
+	sink.Send(Entry{Project: "dropped"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.Accepted(); len(got) != 0 {
+		t.Errorf("accepted entries = %v, want none before the cooldown ends", got)
+	}
+	if state, _ := sink.circuit(); state != circuitOpen {
+		t.Errorf("circuit = %s, want open", state)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/config"
+	"github.com/example/argocd-destination-api/handlers"
+)
+
+const cliUsage = `Usage: argocd-destination-api <add|remove> [flags]
+
+Adds or removes a single destination and exits. Without a subcommand the HTTP
+server is started. Configuration is read from the same environment variables
+as the server.
+
+Flags:`
+
+// cliActor is the actor recorded for changes made by the add and remove
+// commands
+const cliActor = "cli"
+
+// runCLI performs a single add or remove operation using the same validation,
+// client, and audit logging as the server. It returns the process exit code.
+func runCLI(args []string) int {
+	action := args[0]
+	if action != "add" && action != "remove" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", action)
+		printCLIUsage(flag.NewFlagSet(action, flag.ContinueOnError))
+		return 2
+	}
+
+	cfg, err := config.LoadCLI()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	namespaces := cfg.Namespaces
+
+	fs := flag.NewFlagSet(action, flag.ContinueOnError)
+	fs.Usage = func() { printCLIUsage(fs) }
+	project := fs.String("project", "", "ArgoCD AppProject name (required)")
+	server := fs.String("server", "", "Kubernetes API server URL of the destination (required)")
+	namespace := fs.String("namespace", "", "destination namespace (required)")
+	name := fs.String("name", "", "optional destination name")
+	reason := fs.String("reason", "", "why this change is being made, recorded in the audit log (required unless ALLOW_DEFAULT_DESCRIPTION is set)")
+	ticket := fs.String("ticket", "", "change ticket reference, recorded in the audit log")
+	argocdNamespace := fs.String("argocd-namespace", namespaces[0], "ArgoCD namespace containing the project")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if !contains(namespaces, *argocdNamespace) {
+		fmt.Fprintf(os.Stderr, "namespace not allowed: %s\n", *argocdNamespace)
+		return 1
+	}
+
+	auditLogger, err := newAuditLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer auditLogger.Close()
+
+	client, err := argocd.NewClient(namespaces[0], cfg.Client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create ArgoCD client: %v\n", err)
+		return 1
+	}
+
+	handler := handlers.NewDestinationHandler(client, auditLogger, cfg.Handler)
+	req := handlers.DestinationRequest{
+		Project:     *project,
+		Server:      *server,
+		Namespace:   *namespace,
+		Name:        *name,
+		Description: handler.DefaultDescription(cliActor, *reason),
+		TicketID:    *ticket,
+	}
+
+	entry := audit.Entry{
+		Action:          action,
+		Actor:           cliActor,
+		Project:         req.Project,
+		ArgoCDNamespace: *argocdNamespace,
+		Server:          req.Server,
+		Namespace:       req.Namespace,
+		Name:            req.Name,
+		Description:     req.Description,
+		TicketID:        req.TicketID,
+		Wildcard:        req.Server == "*" || req.Namespace == "*",
+		Route:           "cli " + action,
+	}
+
+	ctx := argocd.WithNamespace(context.Background(), *argocdNamespace)
+
+	if fields := handler.Validate(ctx, action, req); len(fields) > 0 {
+		printValidationErrors(fields)
+		entry.Outcome = audit.OutcomeDenied
+		logCLIAudit(auditLogger, entry)
+		return 1
+	}
+
+	dest := argocd.Destination{Server: req.Server, Namespace: req.Namespace, Name: req.Name}
+
+	if action == "add" {
+		warning, fields := handler.CheckNamespace(ctx, dest)
+		if len(fields) > 0 {
+			printValidationErrors(fields)
+			entry.Outcome = audit.OutcomeDenied
+			logCLIAudit(auditLogger, entry)
+			return 1
+		}
+		if warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+	}
+
+	var result argocd.Result
+	if action == "add" {
+		result, err = client.AddDestinationWithMetadata(ctx, req.Project, dest, argocd.DestinationMetadata{Reason: req.Description})
+	} else {
+		result, err = client.RemoveDestination(ctx, req.Project, dest)
+	}
+
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to %s destination: %v\n", action, err)
+		entry.Outcome = cliErrorOutcome(err)
+	case !result.Changed:
+		fmt.Printf("Nothing to %s: project %s is already up to date\n", action, req.Project)
+		entry.Outcome = audit.OutcomeNoop
+	case result.MetadataUpdated:
+		fmt.Printf("Destination already in project %s, updated its reason: server=%s namespace=%s name=%s\n",
+			req.Project, dest.Server, dest.Namespace, dest.Name)
+		entry.Action = "update_metadata"
+		entry.Outcome = audit.OutcomeSuccess
+	case action == "add":
+		fmt.Printf("Added destination to project %s: server=%s namespace=%s name=%s\n",
+			req.Project, dest.Server, dest.Namespace, dest.Name)
+		entry.Outcome = audit.OutcomeSuccess
+	default:
+		fmt.Printf("Removed destination from project %s: server=%s namespace=%s name=%s\n",
+			req.Project, dest.Server, dest.Namespace, dest.Name)
+		entry.Outcome = audit.OutcomeSuccess
+	}
+
+	logCLIAudit(auditLogger, entry)
+	if err != nil {
+		return 1
+	}
+	if result.Changed {
+		handler.Mirror(ctx, action, req, entry)
+	}
+	return 0
+}
+
+// cliErrorOutcome classifies a client error the same way the HTTP handlers do
+func cliErrorOutcome(err error) string {
+	var limitErr *argocd.DestinationLimitError
+	if errors.Is(err, argocd.ErrProjectNotFound) || errors.Is(err, argocd.ErrForbidden) ||
+		errors.Is(err, argocd.ErrConflict) || errors.As(err, &limitErr) {
+		return audit.OutcomeDenied
+	}
+	return audit.OutcomeError
+}
+
+func logCLIAudit(auditLogger *audit.Logger, entry audit.Entry) {
+	if err := auditLogger.Log(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", err)
+	}
+}
+
+func printValidationErrors(fields map[string]string) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Invalid request:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", name, fields[name])
+	}
+}
+
+func printCLIUsage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, cliUsage)
+	fs.SetOutput(os.Stderr)
+	fs.PrintDefaults()
+}
+
+// contains reports whether items contains value
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
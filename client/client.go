@@ -0,0 +1,187 @@
+// Package client is a Go client for the ArgoCD destination API. It talks to a
+// running instance of the service over HTTP; use package argocd to work with
+// AppProjects in Kubernetes directly.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/handlers"
+	"github.com/example/argocd-destination-api/middleware"
+)
+
+// Client calls the destination API
+type Client struct {
+	baseURL    string
+	apiKey     string
+	namespace  string
+	httpClient *http.Client
+}
+
+// New creates a client for the API served at baseURL, including any
+// BASE_PATH, that authenticates with apiKey. A nil httpClient uses
+// http.DefaultClient.
+func New(baseURL, apiKey string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: httpClient,
+	}
+}
+
+// WithNamespace returns a copy of the client whose requests target the given
+// ArgoCD namespace instead of the server's default one
+func (c *Client) WithNamespace(namespace string) *Client {
+	clone := *c
+	clone.namespace = namespace
+	return &clone
+}
+
+// ListProjects returns the projects the API key may access
+func (c *Client) ListProjects(ctx context.Context) ([]argocd.Project, error) {
+	var resp handlers.ProjectsResponse
+	if _, _, err := c.do(ctx, http.MethodGet, "/projects", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Projects, nil
+}
+
+// GetProject returns the summary of a single project
+func (c *Client) GetProject(ctx context.Context, project string) (argocd.Project, error) {
+	var resp argocd.Project
+	if _, _, err := c.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(project), nil, &resp); err != nil {
+		return argocd.Project{}, err
+	}
+	return resp, nil
+}
+
+// GetProjectDetails returns a single project with every part of its spec the
+// API manages
+func (c *Client) GetProjectDetails(ctx context.Context, project string) (argocd.ProjectDetails, error) {
+	var resp argocd.ProjectDetails
+	if _, _, err := c.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(project), nil, &resp); err != nil {
+		return argocd.ProjectDetails{}, err
+	}
+	return resp, nil
+}
+
+// ListDestinations returns the destinations of a project with their metadata
+func (c *Client) ListDestinations(ctx context.Context, project string) ([]argocd.DestinationDetails, error) {
+	var resp handlers.DestinationsResponse
+	body := handlers.ListDestinationsRequest{Project: project}
+	if _, _, err := c.do(ctx, http.MethodPost, "/destinations/list", body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Destinations, nil
+}
+
+// AddDestination adds a destination to a project. Result.Changed is false if
+// the project already had it.
+func (c *Client) AddDestination(ctx context.Context, req handlers.DestinationRequest) (argocd.Result, error) {
+	var resp handlers.DestinationResponse
+	status, _, err := c.do(ctx, http.MethodPost, "/destinations", req, &resp)
+	if err != nil {
+		return argocd.Result{}, err
+	}
+	return argocd.Result{Changed: status == http.StatusCreated, ResourceVersion: resp.ResourceVersion}, nil
+}
+
+// RemoveDestination removes a destination from a project. Result.Changed is
+// false if the project didn't have it.
+func (c *Client) RemoveDestination(ctx context.Context, req handlers.DestinationRequest) (argocd.Result, error) {
+	return c.removeDestination(ctx, "/destinations", req)
+}
+
+// ForceRemoveDestination removes a destination like RemoveDestination, even
+// if Applications deploy to it while the server blocks such removals
+func (c *Client) ForceRemoveDestination(ctx context.Context, req handlers.DestinationRequest) (argocd.Result, error) {
+	return c.removeDestination(ctx, "/destinations?force=true", req)
+}
+
+func (c *Client) removeDestination(ctx context.Context, path string, req handlers.DestinationRequest) (argocd.Result, error) {
+	var resp handlers.NoopResponse
+	status, header, err := c.do(ctx, http.MethodDelete, path, req, &resp)
+	if err != nil {
+		return argocd.Result{}, err
+	}
+	if status == http.StatusNoContent {
+		return argocd.Result{Changed: true, ResourceVersion: strings.Trim(header.Get("ETag"), `"`)}, nil
+	}
+	return argocd.Result{ResourceVersion: resp.ResourceVersion}, nil
+}
+
+// do sends a request with a JSON body, if any, and decodes a JSON response
+// into out. It returns the response status and headers, or an *Error for
+// non-2xx responses.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) (int, http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.namespace != "" {
+		req.Header.Set(middleware.NamespaceHeader, c.namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, resp.Header, newError(resp)
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, resp.Header, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, resp.Header, nil
+}
+
+// newError builds the *Error for a non-2xx response
+func newError(resp *http.Response) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	var body handlers.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		apiErr.Message = body.Message
+		apiErr.Fields = body.Fields
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
@@ -0,0 +1,723 @@
+// Package config loads the service configuration from environment variables
+// and the files they reference. Load reports every problem at once so a
+// misconfigured deployment can be fixed in one go.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/handlers"
+	"github.com/example/argocd-destination-api/middleware"
+)
+
+// Default HTTP server timeouts. Without them a client can hold a connection
+// open indefinitely by sending its request slowly (slowloris).
+const (
+	// DefaultReadHeaderTimeout bounds reading the request headers
+	DefaultReadHeaderTimeout = 10 * time.Second
+	// DefaultReadTimeout bounds reading the whole request, including the body
+	DefaultReadTimeout = 30 * time.Second
+	// DefaultWriteTimeout bounds writing the response. Streaming endpoints
+	// such as the project export lift it for their own responses.
+	DefaultWriteTimeout = 60 * time.Second
+	// DefaultIdleTimeout bounds how long a keep-alive connection waits for
+	// the next request
+	DefaultIdleTimeout = 120 * time.Second
+	// DefaultShutdownTimeout bounds draining on shutdown, below the 30s
+	// Kubernetes waits before killing a terminating pod
+	DefaultShutdownTimeout = 25 * time.Second
+)
+
+// Config is the complete service configuration
+type Config struct {
+	Port     int
+	BasePath string
+	// InstanceID, if set, is sent in the X-Instance-ID header of every response
+	InstanceID string
+	// Namespaces are the ArgoCD namespaces requests may target. The first is
+	// the default.
+	Namespaces []string
+	// AuditLogPath is empty when AUDIT_SINK leaves out the file sink.
+	// AuditStdout also writes audit entries to stdout.
+	AuditLogPath string
+	AuditStdout  bool
+	// Syslog is nil unless AUDIT_SINK includes syslog
+	Syslog *audit.SyslogConfig
+	// AuditLabels are added to every audit entry, e.g. the cluster and region
+	AuditLabels map[string]string
+
+	// APIKeys always holds at least one key when loaded by Load.
+	// APIKeySource describes where the admin key was read from, if any.
+	APIKeys      []middleware.APIKey
+	APIKeySource string
+	// AdminAPIKey guards POST /admin/reload, which is disabled when empty
+	AdminAPIKey string
+
+	Client  argocd.Options
+	Handler handlers.Options
+	// Webhook is nil unless AUDIT_WEBHOOK_URL is set
+	Webhook *audit.WebhookConfig
+
+	MaxInFlightMutations int
+	FailClosedOnAudit    bool
+	TrustActorHeader     bool
+	ActorHeader          string
+	IdempotencyTTL       time.Duration
+	IdempotencyMaxKeys   int
+
+	// ExpirySweep enables removing destinations whose expiresAt has passed,
+	// checking every ExpirySweepInterval
+	ExpirySweep         bool
+	ExpirySweepInterval time.Duration
+
+	// ArchiveRetention is how long destinations archived with
+	// ARCHIVE_REMOVED_DESTINATIONS are kept; the purger checks every
+	// ArchivePurgeInterval
+	ArchiveRetention     time.Duration
+	ArchivePurgeInterval time.Duration
+
+	// DestinationMetrics reports destination counts per project on /metrics,
+	// looking them up at most once per DestinationMetricsInterval
+	DestinationMetrics         bool
+	DestinationMetricsInterval time.Duration
+
+	// DebugHTTP logs the bodies of mutation requests and responses, cut to
+	// DebugHTTPMaxBody bytes
+	DebugHTTP        bool
+	DebugHTTPMaxBody int
+	// DebugPatchPreview serves POST /debug/patch-preview
+	DebugPatchPreview bool
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TLSCertFile and TLSKeyFile serve the API over TLS, which also enables
+	// HTTP/2. Both or neither must be set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// EnableH2C accepts HTTP/2 without TLS
+	EnableH2C bool
+	// ShutdownTimeout bounds how long requests in progress may take to
+	// finish once the server is told to stop
+	ShutdownTimeout time.Duration
+}
+
+// Load reads and validates the server configuration
+func Load() (*Config, error) {
+	return load(true)
+}
+
+// LoadCLI reads and validates the configuration for the add and remove
+// subcommands, which don't authenticate requests and so need no API key
+func LoadCLI() (*Config, error) {
+	return load(false)
+}
+
+func load(requireAPIKeys bool) (*Config, error) {
+	l := &loader{}
+	cfg := &Config{
+		Namespaces:                 namespaces(),
+		BasePath:                   normalizeBasePath(os.Getenv("BASE_PATH")),
+		AuditLogPath:               l.str("AUDIT_LOG_PATH", "/var/log/audit/audit.log"),
+		AdminAPIKey:                os.Getenv("ADMIN_API_KEY"),
+		InstanceID:                 os.Getenv("INSTANCE_ID"),
+		Port:                       l.int("PORT", 8080, 1),
+		MaxInFlightMutations:       l.int("MAX_INFLIGHT_MUTATIONS", 10, 1),
+		FailClosedOnAudit:          l.bool("FAIL_CLOSED_ON_AUDIT"),
+		TrustActorHeader:           l.bool("TRUST_ACTOR_HEADER"),
+		ActorHeader:                l.str("ACTOR_HEADER", middleware.DefaultActorHeader),
+		IdempotencyTTL:             l.duration("IDEMPOTENCY_TTL", 5*time.Minute),
+		IdempotencyMaxKeys:         l.int("IDEMPOTENCY_MAX_KEYS", 10000, 1),
+		ExpirySweep:                l.bool("EXPIRY_SWEEP_ENABLED"),
+		ExpirySweepInterval:        l.duration("EXPIRY_SWEEP_INTERVAL", time.Minute),
+		ArchiveRetention:           l.duration("ARCHIVE_RETENTION", 30*24*time.Hour),
+		ArchivePurgeInterval:       l.duration("ARCHIVE_PURGE_INTERVAL", time.Hour),
+		DestinationMetrics:         l.bool("DESTINATION_METRICS_ENABLED"),
+		DestinationMetricsInterval: l.duration("DESTINATION_METRICS_INTERVAL", 5*time.Minute),
+		DebugHTTP:                  l.bool("DEBUG_HTTP"),
+		DebugHTTPMaxBody:           l.int("DEBUG_HTTP_MAX_BODY", 2048, 1),
+		DebugPatchPreview:          l.bool("DEBUG_PATCH_PREVIEW"),
+		ReadHeaderTimeout:          l.duration("HTTP_READ_HEADER_TIMEOUT", DefaultReadHeaderTimeout),
+		ReadTimeout:                l.duration("HTTP_READ_TIMEOUT", DefaultReadTimeout),
+		WriteTimeout:               l.duration("HTTP_WRITE_TIMEOUT", DefaultWriteTimeout),
+		IdleTimeout:                l.duration("HTTP_IDLE_TIMEOUT", DefaultIdleTimeout),
+		TLSCertFile:                os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:                 os.Getenv("TLS_KEY_FILE"),
+		EnableH2C:                  l.bool("ENABLE_H2C"),
+		ShutdownTimeout:            l.duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		l.fail(fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if cfg.Port > 65535 {
+		l.fail(fmt.Errorf("PORT must be at most 65535, got %d", cfg.Port))
+	}
+
+	var syslogSink bool
+	cfg.AuditLogPath, cfg.AuditStdout, syslogSink = l.auditSinks(cfg.AuditLogPath)
+	if syslogSink {
+		cfg.Syslog = l.syslog()
+	}
+	if cfg.AuditLogPath != "" {
+		l.check(checkWritable(cfg.AuditLogPath))
+	}
+	cfg.AuditLabels = l.auditLabels()
+	cfg.Client = l.clientOptions()
+	cfg.Handler = l.handlerOptions()
+	if cfg.Handler.MirrorNamespace != "" && cfg.Handler.MirrorNamespace == cfg.Namespaces[0] {
+		l.fail(fmt.Errorf("MIRROR_NAMESPACE %s must not be the primary ArgoCD namespace", cfg.Handler.MirrorNamespace))
+	}
+	cfg.Webhook = l.webhook()
+
+	adminKey, source, keyErr := loadAPIKey()
+	l.check(keyErr)
+	cfg.APIKeySource = source
+	keys, keysErr := loadAPIKeys(adminKey)
+	l.check(keysErr)
+	cfg.APIKeys = keys
+	if requireAPIKeys && keyErr == nil && keysErr == nil && len(keys) == 0 {
+		l.fail(errors.New("API_KEY, API_KEY_HASH, API_KEY_FILE or API_KEYS_FILE environment variable is required"))
+	}
+
+	if len(l.errs) > 0 {
+		return nil, &Error{Errs: l.errs}
+	}
+	return cfg, nil
+}
+
+// Error lists every problem found while loading the configuration
+type Error struct {
+	Errs []error
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, "  - "+err.Error())
+	}
+	return fmt.Sprintf("%d configuration errors:\n%s", len(e.Errs), strings.Join(msgs, "\n"))
+}
+
+func (e *Error) Unwrap() []error {
+	return e.Errs
+}
+
+// String summarizes the configuration for the startup log. Keys and webhook
+// credentials are redacted.
+func (c *Config) String() string {
+	keyNames := make([]string, 0, len(c.APIKeys))
+	for _, key := range c.APIKeys {
+		keyNames = append(keyNames, key.Name)
+	}
+	sort.Strings(keyNames)
+
+	lines := []string{
+		fmt.Sprintf("port=%d basePath=%s instanceID=%s", c.Port, c.BasePath, c.InstanceID),
+		fmt.Sprintf("argocdNamespaces=%s (default %s)", strings.Join(c.Namespaces, ","), c.Namespaces[0]),
+		fmt.Sprintf("apiKeys=%s", strings.Join(keyNames, ",")),
+	}
+	if c.APIKeySource != "" {
+		lines = append(lines, "adminAPIKeySource="+c.APIKeySource)
+	}
+	lines = append(lines,
+		fmt.Sprintf("adminReload=%t", c.AdminAPIKey != ""),
+		fmt.Sprintf("auditLogPath=%s auditStdout=%t failClosedOnAudit=%t", c.AuditLogPath, c.AuditStdout, c.FailClosedOnAudit),
+	)
+	if c.Webhook != nil {
+		lines = append(lines, "auditWebhook="+redactURL(c.Webhook.URL))
+	}
+	if len(c.AuditLabels) > 0 {
+		keys := make([]string, 0, len(c.AuditLabels))
+		for key := range c.AuditLabels {
+			keys = append(keys, key+"="+c.AuditLabels[key])
+		}
+		sort.Strings(keys)
+		lines = append(lines, "auditLabels="+strings.Join(keys, ","))
+	}
+	if c.Syslog != nil {
+		lines = append(lines, fmt.Sprintf("auditSyslog network=%s address=%s facility=%s tag=%s",
+			c.Syslog.Network, c.Syslog.Address, c.Syslog.Facility, c.Syslog.Tag))
+	}
+	if c.TrustActorHeader {
+		lines = append(lines, "actorHeader="+c.ActorHeader)
+	}
+	if c.Handler.NamespaceConvention.Template != "" {
+		lines = append(lines, fmt.Sprintf("namespaceConvention=%s exceptions=%s",
+			c.Handler.NamespaceConvention.Template, strings.Join(c.Handler.NamespaceConvention.Exceptions, ",")))
+	}
+	if c.Handler.DefaultDescription.Template != "" {
+		lines = append(lines, fmt.Sprintf("defaultDescription=%q", c.Handler.DefaultDescription.Template))
+	}
+	if c.Handler.MirrorNamespace != "" {
+		lines = append(lines, "mirrorNamespace="+c.Handler.MirrorNamespace)
+	}
+	if c.Handler.NamespaceCheck != "" {
+		lines = append(lines, fmt.Sprintf("namespaceCheck=%s", c.Handler.NamespaceCheck))
+	}
+	if c.Handler.IssueRoleTokens {
+		lines = append(lines, "issueRoleTokens=true")
+	}
+	if c.DebugPatchPreview {
+		lines = append(lines, "debugPatchPreview=true")
+	}
+	if c.DebugHTTP {
+		lines = append(lines, fmt.Sprintf("debugHTTP=true maxBody=%d (request and response bodies are logged)", c.DebugHTTPMaxBody))
+	}
+	lines = append(lines,
+		fmt.Sprintf("maxInFlightMutations=%d idempotencyTTL=%s idempotencyMaxKeys=%d", c.MaxInFlightMutations, c.IdempotencyTTL, c.IdempotencyMaxKeys),
+		fmt.Sprintf("expirySweep=%t interval=%s", c.ExpirySweep, c.ExpirySweepInterval),
+		fmt.Sprintf("archiveRemovals=%t retention=%s purgeInterval=%s", c.Client.ArchiveRemovals, c.ArchiveRetention, c.ArchivePurgeInterval),
+		fmt.Sprintf("destinationMetrics=%t interval=%s", c.DestinationMetrics, c.DestinationMetricsInterval),
+		fmt.Sprintf("scanConcurrency=%d strictScans=%t", c.Client.ScanConcurrency, c.Client.StrictScans),
+		fmt.Sprintf("maxDestinationsPerProject=%d k8sQPS=%g k8sBurst=%d resolveClusterNames=%t projectCacheTTL=%s patchStrategy=%s projectLockTimeout=%s",
+			c.Client.MaxDestinations, c.Client.QPS, c.Client.Burst, c.Client.ResolveClusterNames, c.Client.ProjectCacheTTL, c.Client.PatchStrategy, c.Client.ProjectLockTimeout),
+		fmt.Sprintf("conflictMaxAttempts=%d conflictRetryBudget=%g", c.Client.ConflictAttempts, c.Client.RetryBudget),
+		fmt.Sprintf("requireTicket=%t fieldPolicyRules=%d wildcardProjects=%d protectedProjects=%s",
+			c.Handler.RequireTicket, len(c.Handler.FieldPolicy.Rules), len(c.Handler.WildcardProjects), strings.Join(c.Handler.ProtectedProjects, ",")),
+		fmt.Sprintf("httpTimeouts readHeader=%s read=%s write=%s idle=%s shutdown=%s",
+			c.ReadHeaderTimeout, c.ReadTimeout, c.WriteTimeout, c.IdleTimeout, c.ShutdownTimeout),
+		fmt.Sprintf("tls=%t h2c=%t", c.TLSCertFile != "", c.EnableH2C),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// redactURL hides credentials and query parameters, which may carry tokens
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.Redacted()
+}
+
+// loader collects the errors of every setting it reads
+type loader struct {
+	errs []error
+}
+
+func (l *loader) fail(err error) {
+	l.errs = append(l.errs, err)
+}
+
+func (l *loader) check(err error) {
+	if err != nil {
+		l.fail(err)
+	}
+}
+
+// str reads a string setting, returning def if it is unset
+func (l *loader) str(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// bool reads a boolean setting, defaulting to false when unset
+func (l *loader) bool(name string) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.fail(fmt.Errorf("%s must be a boolean, got %q", name, v))
+	}
+	return b
+}
+
+// int reads an integer setting of at least min, returning def if it is unset
+func (l *loader) int(name string, def, min int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min {
+		l.fail(fmt.Errorf("%s must be an integer of at least %d, got %q", name, min, v))
+		return def
+	}
+	return n
+}
+
+// duration reads a positive duration setting, returning def if it is unset
+func (l *loader) duration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		l.fail(fmt.Errorf("%s must be a positive duration, got %q", name, v))
+		return def
+	}
+	return d
+}
+
+// regexp reads a regular expression setting, returning nil if it is unset
+func (l *loader) regexp(name string) *regexp.Regexp {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	re, err := regexp.Compile(v)
+	if err != nil {
+		l.fail(fmt.Errorf("%s is not a valid regular expression: %w", name, err))
+	}
+	return re
+}
+
+// clientOptions reads the ArgoCD client options
+func (l *loader) clientOptions() argocd.Options {
+	options := argocd.Options{
+		MaxDestinations:     l.int("MAX_DESTINATIONS_PER_PROJECT", 0, 0),
+		Burst:               l.int("K8S_BURST", argocd.DefaultBurst, 1),
+		ResolveClusterNames: l.bool("RESOLVE_CLUSTER_NAMES"),
+		ProjectCacheTTL:     l.duration("PROJECT_CACHE_TTL", 0),
+		ArchiveRemovals:     l.bool("ARCHIVE_REMOVED_DESTINATIONS"),
+		ScanConcurrency:     l.int("SCAN_CONCURRENCY", argocd.DefaultScanConcurrency, 1),
+		StrictScans:         l.bool("STRICT_SCANS"),
+		ConflictAttempts:    l.int("CONFLICT_MAX_ATTEMPTS", argocd.DefaultConflictAttempts, 1),
+		QPS:                 argocd.DefaultQPS,
+		PatchStrategy:       argocd.PatchMerge,
+	}
+
+	if l.bool("PROJECT_LOCKING_ENABLED") {
+		options.ProjectLockTimeout = l.duration("PROJECT_LOCK_TIMEOUT", 10*time.Second)
+	}
+
+	if v := os.Getenv("K8S_QPS"); v != "" {
+		qps, err := strconv.ParseFloat(v, 32)
+		if err != nil || qps <= 0 {
+			l.fail(fmt.Errorf("K8S_QPS must be a positive number, got %q", v))
+		} else {
+			options.QPS = float32(qps)
+		}
+	}
+
+	if v := os.Getenv("CONFLICT_RETRY_BUDGET"); v != "" {
+		budget, err := strconv.ParseFloat(v, 64)
+		if err != nil || budget < 0 {
+			l.fail(fmt.Errorf("CONFLICT_RETRY_BUDGET must be a non-negative number, got %q", v))
+		} else {
+			options.RetryBudget = budget
+		}
+	}
+
+	if v := os.Getenv("PATCH_STRATEGY"); v != "" {
+		strategy, err := argocd.ParsePatchStrategy(v)
+		if err != nil {
+			l.fail(fmt.Errorf("PATCH_STRATEGY: %w", err))
+		} else {
+			options.PatchStrategy = strategy
+		}
+	}
+
+	return options
+}
+
+// handlerOptions reads the handler policies
+func (l *loader) handlerOptions() handlers.Options {
+	options := handlers.Options{
+		CreateProjectsOnImport: l.bool("IMPORT_CREATE_PROJECTS"),
+		RequireTicket:          l.bool("REQUIRE_TICKET"),
+		TicketPattern:          l.regexp("TICKET_PATTERN"),
+		ProjectNamePattern:     l.regexp("PROJECT_NAME_PATTERN"),
+		CheckDestinationUsage:  l.bool("CHECK_DESTINATION_USAGE"),
+		BlockInUseRemoval:      l.bool("BLOCK_IN_USE_REMOVAL"),
+		SortDestinations:       l.bool("SORT_DESTINATIONS"),
+		ProjectSearchLimit:     l.int("PROJECT_SEARCH_MAX_RESULTS", handlers.DefaultProjectSearchLimit, 1),
+		MirrorNamespace:        os.Getenv("MIRROR_NAMESPACE"),
+		IssueRoleTokens:        l.bool("ISSUE_ROLE_TOKENS"),
+	}
+
+	namespaceCheck, err := handlers.ParseNamespaceCheckMode(os.Getenv("CHECK_NAMESPACE_EXISTS"))
+	if err != nil {
+		l.fail(fmt.Errorf("CHECK_NAMESPACE_EXISTS %w", err))
+	}
+	options.NamespaceCheck = namespaceCheck
+
+	allowed := parseList(os.Getenv("ALLOWED_NAMESPACE_PATTERNS"))
+	denied := parseList(os.Getenv("DENIED_NAMESPACE_PATTERNS"))
+	if path := os.Getenv("NAMESPACE_POLICY_FILE"); path != "" {
+		if len(allowed) > 0 || len(denied) > 0 {
+			l.fail(errors.New("NAMESPACE_POLICY_FILE can't be combined with ALLOWED_NAMESPACE_PATTERNS or DENIED_NAMESPACE_PATTERNS"))
+		}
+		options.NamespacePolicy, err = handlers.LoadNamespacePolicy(path)
+	} else {
+		options.NamespacePolicy, err = handlers.NewNamespacePolicy(allowed, denied)
+	}
+	l.check(err)
+
+	if l.bool("ENFORCE_NAMESPACE_CONVENTION") {
+		options.NamespaceConvention, err = handlers.NewNamespaceConvention(
+			l.str("NAMESPACE_CONVENTION_TEMPLATE", "{project}-*"),
+			parseList(os.Getenv("NAMESPACE_CONVENTION_EXCEPTIONS")),
+		)
+		l.check(err)
+	}
+
+	if l.bool("ALLOW_DEFAULT_DESCRIPTION") {
+		options.DefaultDescription, err = handlers.NewDescriptionTemplate(
+			l.str("DEFAULT_DESCRIPTION_TEMPLATE", "Change by {actor} without a description (request {requestId} at {timestamp})"),
+		)
+		l.check(err)
+	}
+
+	if l.bool("ALLOW_WILDCARD_DESTINATIONS") {
+		options.WildcardProjects = make(map[string]bool)
+		for _, project := range parseList(os.Getenv("WILDCARD_DESTINATION_PROJECTS")) {
+			options.WildcardProjects[project] = true
+		}
+	}
+
+	options.ProtectedProjects, err = handlers.NewProtectedProjects(parseList(os.Getenv("PROTECTED_PROJECTS")))
+	l.check(err)
+
+	if path := os.Getenv("DESTINATION_FIELD_POLICY_FILE"); path != "" {
+		options.FieldPolicy, err = handlers.LoadFieldPolicy(path)
+		l.check(err)
+	}
+
+	return options
+}
+
+// auditSinks reads AUDIT_SINK, a comma-separated list of "file", "stdout"
+// and "syslog". It returns the log path, cleared when the file sink is left
+// out, and whether entries also go to stdout and to syslog.
+func (l *loader) auditSinks(path string) (string, bool, bool) {
+	sinks := parseList(os.Getenv("AUDIT_SINK"))
+	if len(sinks) == 0 {
+		return path, false, false
+	}
+
+	file, stdout, syslog := false, false, false
+	for _, sink := range sinks {
+		switch sink {
+		case "file":
+			file = true
+		case "stdout":
+			stdout = true
+		case "syslog":
+			syslog = true
+		default:
+			l.fail(fmt.Errorf("AUDIT_SINK must list file, stdout or syslog, got %q", sink))
+		}
+	}
+	if !file {
+		path = ""
+	}
+	return path, stdout, syslog
+}
+
+// auditLabels reads AUDIT_LABELS, a comma-separated list of key=value pairs
+// added to every audit entry under "labels"
+func (l *loader) auditLabels() map[string]string {
+	items := parseList(os.Getenv("AUDIT_LABELS"))
+	if len(items) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			l.fail(fmt.Errorf("AUDIT_LABELS must list key=value pairs, got %q", item))
+			continue
+		}
+		if _, dup := labels[key]; dup {
+			l.fail(fmt.Errorf("AUDIT_LABELS lists %q more than once", key))
+			continue
+		}
+		labels[key] = value
+	}
+	return labels
+}
+
+// syslog reads the audit syslog sink settings
+func (l *loader) syslog() *audit.SyslogConfig {
+	config := &audit.SyslogConfig{
+		Network:  os.Getenv("AUDIT_SYSLOG_NETWORK"),
+		Address:  os.Getenv("AUDIT_SYSLOG_ADDRESS"),
+		Facility: l.str("AUDIT_SYSLOG_FACILITY", "auth"),
+		Tag:      l.str("AUDIT_SYSLOG_TAG", audit.DefaultSyslogTag),
+	}
+	if config.Network == "local" {
+		config.Network = ""
+	}
+
+	switch config.Network {
+	case "", "udp", "tcp":
+	default:
+		l.fail(fmt.Errorf("AUDIT_SYSLOG_NETWORK must be udp, tcp or local, got %q", config.Network))
+	}
+	if config.Network != "" && config.Address == "" {
+		l.fail(fmt.Errorf("AUDIT_SYSLOG_ADDRESS is required with AUDIT_SYSLOG_NETWORK=%s", config.Network))
+	}
+	if _, err := audit.ParseSyslogFacility(config.Facility); err != nil {
+		l.fail(fmt.Errorf("AUDIT_SYSLOG_FACILITY: %w", err))
+	}
+	return config
+}
+
+// webhook reads the audit webhook sink settings, or returns nil if
+// AUDIT_WEBHOOK_URL is unset
+func (l *loader) webhook() *audit.WebhookConfig {
+	rawURL := os.Getenv("AUDIT_WEBHOOK_URL")
+	if rawURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.fail(errors.New("AUDIT_WEBHOOK_URL must be an http or https URL"))
+	}
+
+	return &audit.WebhookConfig{
+		URL:              rawURL,
+		Timeout:          l.duration("AUDIT_WEBHOOK_TIMEOUT", audit.DefaultWebhookTimeout),
+		Cooldown:         l.duration("AUDIT_WEBHOOK_COOLDOWN", audit.DefaultWebhookCooldown),
+		QueueSize:        l.int("AUDIT_WEBHOOK_QUEUE_SIZE", audit.DefaultWebhookQueueSize, 1),
+		MaxRetries:       l.int("AUDIT_WEBHOOK_MAX_RETRIES", audit.DefaultWebhookMaxRetries, 0),
+		FailureThreshold: l.int("AUDIT_WEBHOOK_FAILURE_THRESHOLD", audit.DefaultWebhookFailureThreshold, 1),
+	}
+}
+
+// namespaces returns the allowed ArgoCD namespaces from ARGOCD_NAMESPACES,
+// falling back to ARGOCD_NAMESPACE. The first namespace is the default.
+func namespaces() []string {
+	namespaces := parseList(os.Getenv("ARGOCD_NAMESPACES"))
+	if len(namespaces) == 0 {
+		namespace := os.Getenv("ARGOCD_NAMESPACE")
+		if namespace == "" {
+			namespace = "argocd"
+		}
+		namespaces = []string{namespace}
+	}
+	return namespaces
+}
+
+// checkWritable verifies that the audit log can be opened for appending,
+// creating it if needed
+func checkWritable(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("AUDIT_LOG_PATH is not writable: %w", err)
+	}
+	return file.Close()
+}
+
+// loadAPIKey reads the admin API key. A bcrypt hash in API_KEY_HASH, with its
+// ID in API_KEY_ID, takes precedence; otherwise the plaintext key is read from the file named by
+// API_KEY_FILE, falling back to the API_KEY environment variable. It returns
+// the key, or the zero key if none is set, and a description of where it was
+// read from.
+func loadAPIKey() (middleware.APIKey, string, error) {
+	admin := middleware.APIKey{Name: "admin", Admin: true}
+
+	key, source, err := loadPlaintextAPIKey()
+	if err != nil {
+		return middleware.APIKey{}, "", err
+	}
+
+	if hash := os.Getenv("API_KEY_HASH"); hash != "" {
+		if err := middleware.CheckKeyHash(hash); err != nil {
+			return middleware.APIKey{}, "", fmt.Errorf("API_KEY_HASH: %w", err)
+		}
+		admin.Hash = hash
+		admin.ID = os.Getenv("API_KEY_ID")
+		if err := middleware.CheckKeyID(admin.ID); err != nil {
+			return middleware.APIKey{}, "", fmt.Errorf("API_KEY_ID: %w", err)
+		}
+		if key != "" {
+			return admin, "API_KEY_HASH env var (" + source + " ignored)", nil
+		}
+		return admin, "API_KEY_HASH env var", nil
+	}
+
+	if key == "" {
+		return middleware.APIKey{}, "", nil
+	}
+	admin.Key = key
+	return admin, source, nil
+}
+
+// loadPlaintextAPIKey reads the API key from the file named by API_KEY_FILE,
+// falling back to the API_KEY environment variable. The file takes precedence
+// when both are set.
+func loadPlaintextAPIKey() (string, string, error) {
+	if path := os.Getenv("API_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read API_KEY_FILE: %w", err)
+		}
+		key := strings.TrimRight(string(data), " \t\r\n")
+		if key == "" {
+			return "", "", fmt.Errorf("API_KEY_FILE %s is empty", path)
+		}
+		if os.Getenv("API_KEY") != "" {
+			return key, "file " + path + " (API_KEY env var ignored)", nil
+		}
+		return key, "file " + path, nil
+	}
+
+	key := os.Getenv("API_KEY")
+	if key == "" {
+		return "", "", nil
+	}
+	return key, "API_KEY env var", nil
+}
+
+// loadAPIKeys combines the admin API key, if set, with the scoped keys from
+// API_KEYS_FILE
+func loadAPIKeys(admin middleware.APIKey) ([]middleware.APIKey, error) {
+	var keys []middleware.APIKey
+	if admin.Key != "" || admin.Hash != "" {
+		keys = append(keys, admin)
+	}
+
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		fileKeys, err := middleware.LoadAPIKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if err := middleware.CheckKeys(keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// parseList splits a comma-separated value into its non-empty, trimmed items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeBasePath turns a configured URL prefix such as "argocd-dest/" into
+// the "/argocd-dest" form used for mounting. An empty prefix mounts at the root.
+func normalizeBasePath(value string) string {
+	trimmed := strings.Trim(strings.TrimSpace(value), "/")
+	return "/" + trimmed
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+)
+
+// purgeActor is the actor recorded on audit entries of purged destinations
+const purgeActor = "archive-purger"
+
+// RestoreDestinationRequest represents a request to restore an archived
+// destination of a project
+type RestoreDestinationRequest struct {
+	Server      string `json:"server"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// ArchivedDestinationsResponse represents the archived destinations of a project
+type ArchivedDestinationsResponse struct {
+	Project      string                       `json:"project"`
+	Destinations []argocd.ArchivedDestination `json:"destinations"`
+}
+
+// ListArchivedDestinations handles GET /projects/{project}/destinations/archived
+func (h *DestinationHandler) ListArchivedDestinations(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	archive, resourceVersion, err := h.client.GetArchivedDestinations(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	writeJSON(w, http.StatusOK, ArchivedDestinationsResponse{Project: project, Destinations: archive})
+}
+
+// RestoreDestination handles POST /projects/{project}/destinations/restore. It
+// adds an archived destination back with its metadata. Restoring is an add,
+// so the namespace policies apply.
+func (h *DestinationHandler) RestoreDestination(w http.ResponseWriter, r *http.Request) {
+	var body RestoreDestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "restore", DestinationRequest{Project: chi.URLParam(r, "project")}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+
+	req := DestinationRequest{
+		Project:     chi.URLParam(r, "project"),
+		Server:      body.Server,
+		Namespace:   body.Namespace,
+		Name:        body.Name,
+		Description: body.Description,
+		TicketID:    body.TicketID,
+	}
+
+	if status, ok := h.validateDestinationRequest(w, r, "add", req); !ok {
+		h.logAudit(r, "restore", req, status)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		h.logAudit(r, "restore", req, status)
+		return
+	}
+
+	dest := argocd.Destination{Server: req.Server, Namespace: req.Namespace, Name: req.Name}
+	restored, result, err := h.client.RestoreDestination(r.Context(), req.Project, dest)
+	if errors.Is(err, argocd.ErrDestinationNotArchived) {
+		writeJSONError(w, r, http.StatusNotFound, "destination is not archived in project: "+req.Project)
+		h.logAudit(r, "restore", req, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		var limitErr *argocd.DestinationLimitError
+		if errors.As(err, &limitErr) {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, limitErr.Error())
+			h.logAudit(r, "restore", req, http.StatusUnprocessableEntity)
+			return
+		}
+		h.logAudit(r, "restore", req, h.handleK8sError(w, r, err, req.Project))
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+	if !result.Changed {
+		h.logAuditOutcome(r, "restore", req, audit.OutcomeNoop, http.StatusOK)
+		writeJSON(w, http.StatusOK, NoopResponse{
+			Noop:            true,
+			Message:         "destination already exists",
+			ResourceVersion: result.ResourceVersion,
+		})
+		return
+	}
+
+	h.logAudit(r, "restore", req, http.StatusCreated)
+
+	log.Printf("Restored destination to project %s: server=%s namespace=%s name=%s description=%q resourceVersion=%s",
+		req.Project, restored.Server, restored.Namespace, restored.Name, req.Description, result.ResourceVersion)
+
+	writeJSON(w, http.StatusCreated, DestinationMetadataResponse{
+		DestinationDetails: argocd.DestinationDetails{Destination: restored.Destination, Metadata: restored.Metadata},
+		ResourceVersion:    result.ResourceVersion,
+	})
+}
+
+// RunArchivePurger permanently drops destinations archived longer than
+// retention from the projects in the given ArgoCD namespaces every interval
+// until ctx is done
+func (h *DestinationHandler) RunArchivePurger(ctx context.Context, interval, retention time.Duration, namespaces []string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.PurgeArchived(ctx, retention, namespaces)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeArchived permanently drops the destinations archived longer than
+// retention from the projects in the given ArgoCD namespaces and writes a
+// "purge" audit entry for each. Failures are logged and retried on the next
+// run.
+func (h *DestinationHandler) PurgeArchived(ctx context.Context, retention time.Duration, namespaces []string) {
+	cutoff := time.Now().Add(-retention)
+	for _, namespace := range namespaces {
+		nsCtx := argocd.WithNamespace(ctx, namespace)
+
+		projects, err := h.client.ProjectsWithArchiveBefore(nsCtx, cutoff)
+		if err != nil {
+			log.Printf("Archive purge failed to list projects in namespace %s: %v", namespace, err)
+			continue
+		}
+
+		for _, project := range projects {
+			purged, _, err := h.client.PurgeArchivedDestinations(nsCtx, project, cutoff)
+			if err != nil {
+				log.Printf("Archive purge failed to purge destinations of project %s: %v", project, err)
+				continue
+			}
+
+			for _, dest := range purged {
+				log.Printf("Purged archived destination of project %s: server=%s namespace=%s name=%s archivedAt=%s",
+					project, dest.Server, dest.Namespace, dest.Name, dest.ArchivedAt.Format(time.RFC3339))
+				entry := audit.Entry{
+					Action:          "purge",
+					Actor:           purgeActor,
+					Project:         project,
+					ArgoCDNamespace: namespace,
+					Server:          dest.Server,
+					Namespace:       dest.Namespace,
+					Name:            dest.Name,
+					Outcome:         audit.OutcomeSuccess,
+				}
+				if dest.Metadata != nil {
+					entry.Description = dest.Metadata.Reason
+				}
+				h.writeAudit(ctx, entry)
+			}
+		}
+	}
+}
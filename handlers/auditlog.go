@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/middleware"
+)
+
+// AuditPageResponse represents a page of audit entries. NextCursor continues
+// after the last entry read, and can be polled for newer entries once More is
+// false.
+type AuditPageResponse struct {
+	Entries    []audit.Entry `json:"entries"`
+	NextCursor string        `json:"nextCursor"`
+	More       bool          `json:"more"`
+}
+
+// QueryAuditLog handles GET /audit. It pages through the whole audit log in
+// chronological order, optionally filtered by project, actor, outcome, ticket
+// and time range. Each page starts at the byte offset its cursor names, so
+// later pages of a large log are as cheap as the first. Only admin keys may
+// use it, since entries of every project are returned.
+func (h *DestinationHandler) QueryAuditLog(w http.ResponseWriter, r *http.Request) {
+	if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+		writeJSONError(w, r, http.StatusForbidden, "reading the audit log requires an admin API key")
+		return
+	}
+
+	params := r.URL.Query()
+	query := audit.Query{
+		Project:  params.Get("project"),
+		Actor:    params.Get("actor"),
+		Outcome:  params.Get("outcome"),
+		TicketID: params.Get("ticketId"),
+	}
+	switch query.Outcome {
+	case "", audit.OutcomeSuccess, audit.OutcomeNoop, audit.OutcomeDenied, audit.OutcomeError:
+	default:
+		writeJSONError(w, r, http.StatusBadRequest, "outcome must be success, noop, denied or error")
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := params.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			writeJSONError(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+			return
+		}
+	}
+
+	var err error
+	if v := params.Get("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := params.Get("until"); v != "" {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "until must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	var cursor int64
+	if v := params.Get("cursor"); v != "" {
+		if cursor, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "cursor must be a cursor returned by a previous page")
+			return
+		}
+	}
+
+	entries, next, more, err := h.auditLogger.Page(query, cursor, limit)
+	if errors.Is(err, audit.ErrNoLogFile) {
+		writeJSONError(w, r, http.StatusNotImplemented, "reading the audit log requires the audit log file sink (AUDIT_SINK=file)")
+		return
+	}
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		writeJSONError(w, r, http.StatusBadRequest, "cursor is no longer valid, the audit log may have been rotated; start again without a cursor")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to page through audit log: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to read audit log")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AuditPageResponse{
+		Entries:    entries,
+		NextCursor: strconv.FormatInt(next, 10),
+		More:       more,
+	})
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// maxBatchSize caps the number of destinations in one batch request
+const maxBatchSize = 100
+
+// batchAttempts bounds how often a best-effort batch retries a destination
+// whose add conflicted with a concurrent modification
+const batchAttempts = 3
+
+// Batch modes
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best-effort"
+)
+
+// BatchDestinationRequest represents a request to add several destinations to
+// one project
+type BatchDestinationRequest struct {
+	Project      string               `json:"project"`
+	Destinations []argocd.Destination `json:"destinations"`
+	Description  string               `json:"description"`
+	TicketID     string               `json:"ticketId,omitempty"`
+}
+
+// BatchEntryResult reports the outcome of one destination of a batch. Status
+// is the HTTP status the destination would have got from POST /destinations.
+type BatchEntryResult struct {
+	argocd.Destination
+	Status   int      `json:"status"`
+	Message  string   `json:"message,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// BatchResponse reports the outcome of a batch add per destination
+type BatchResponse struct {
+	Project         string             `json:"project"`
+	Mode            string             `json:"mode"`
+	Results         []BatchEntryResult `json:"results"`
+	ResourceVersion string             `json:"resourceVersion,omitempty"`
+}
+
+// AddDestinations handles POST /destinations/batch. By default the batch is
+// atomic: it is validated as a whole and applied in a single patch, so either
+// every destination is added or none is. With ?mode=best-effort each
+// destination is validated and added on its own, and the response is a
+// 207 Multi-Status listing the outcome of every entry.
+func (h *DestinationHandler) AddDestinations(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if mode != BatchAtomic && mode != BatchBestEffort {
+		writeJSONError(w, r, http.StatusBadRequest, "mode must be atomic or best-effort")
+		return
+	}
+
+	var req BatchDestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "add", DestinationRequest{Project: req.Project}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &req.Description)
+
+	h.addBatch(w, r, req, mode)
+}
+
+// addBatch validates and applies a batch add in the given mode
+func (h *DestinationHandler) addBatch(w http.ResponseWriter, r *http.Request, req BatchDestinationRequest, mode string) {
+	if status, ok := h.validateBatchRequest(w, r, req); !ok {
+		h.logBatchAudit(r, req, req.Destinations, status)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		h.logBatchAudit(r, req, req.Destinations, status)
+		return
+	}
+
+	required, err := h.requiredFields(r.Context(), req.Project)
+	if err != nil {
+		h.logBatchAudit(r, req, req.Destinations, h.handleK8sError(w, r, err, req.Project))
+		return
+	}
+
+	if mode == BatchBestEffort {
+		h.addDestinationsBestEffort(w, r, req, required)
+		return
+	}
+
+	// Validate every destination before changing anything
+	warnings := make([]string, len(req.Destinations))
+	for i, dest := range req.Destinations {
+		fields := h.destinationErrors(req.Project, dest)
+		if len(fields) > 0 {
+			prefixed := make(map[string]string, len(fields))
+			for field, msg := range fields {
+				prefixed[fmt.Sprintf("destinations[%d].%s", i, field)] = msg
+			}
+			writeValidationError(w, r, prefixed)
+			h.logBatchAudit(r, req, req.Destinations, http.StatusUnprocessableEntity)
+			return
+		}
+		if fields := missingFieldErrors(req.Project, required, dest); len(fields) > 0 {
+			prefixed := make(map[string]string, len(fields))
+			for field, msg := range fields {
+				prefixed[fmt.Sprintf("destinations[%d].%s", i, field)] = msg
+			}
+			writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: joinFieldErrors(prefixed), Fields: prefixed})
+			h.logBatchAudit(r, req, req.Destinations, http.StatusBadRequest)
+			return
+		}
+		if msg := h.policyError(batchEntryRequest(req, dest)); msg != "" {
+			writeJSONError(w, r, http.StatusForbidden, fmt.Sprintf("destinations[%d]: %s", i, msg))
+			h.logBatchAudit(r, req, req.Destinations, http.StatusForbidden)
+			return
+		}
+		warning, refusal, err := h.namespaceCheck(r.Context(), dest)
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, namespaceLookupFailed)
+			h.logBatchAudit(r, req, req.Destinations, http.StatusInternalServerError)
+			return
+		}
+		if refusal != "" {
+			writeValidationError(w, r, map[string]string{fmt.Sprintf("destinations[%d].namespace", i): refusal})
+			h.logBatchAudit(r, req, req.Destinations, http.StatusUnprocessableEntity)
+			return
+		}
+		warnings[i] = warning
+	}
+
+	added, result, err := h.client.AddDestinations(r.Context(), req.Project, req.Destinations, req.metadata())
+	if err != nil {
+		var limitErr *argocd.DestinationLimitError
+		if errors.As(err, &limitErr) {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, limitErr.Error())
+			h.logBatchAudit(r, req, req.Destinations, http.StatusUnprocessableEntity)
+			return
+		}
+		h.logBatchAudit(r, req, req.Destinations, h.handleK8sError(w, r, err, req.Project))
+		return
+	}
+
+	addedCount := len(added)
+	resp := BatchResponse{Project: req.Project, Mode: mode, ResourceVersion: result.ResourceVersion}
+	for i, dest := range req.Destinations {
+		entry := BatchEntryResult{Destination: dest, Status: http.StatusOK, Message: "destination already exists"}
+		if j := indexOf(added, dest); j >= 0 {
+			entry = BatchEntryResult{Destination: dest, Status: http.StatusCreated}
+			added = append(added[:j], added[j+1:]...)
+		}
+		if warnings[i] != "" {
+			entry.Warnings = []string{warnings[i]}
+		}
+		resp.Results = append(resp.Results, entry)
+
+		if entry.Status == http.StatusCreated {
+			h.logAudit(r, "add", batchEntryRequest(req, dest), http.StatusCreated)
+			h.mirror(r, "add", batchEntryRequest(req, dest))
+		} else {
+			h.logAuditOutcome(r, "add", batchEntryRequest(req, dest), audit.OutcomeNoop, http.StatusOK)
+		}
+	}
+
+	status := http.StatusOK
+	if result.Changed {
+		status = http.StatusCreated
+		log.Printf("Added %d destinations to project %s in one batch: reason=%q resourceVersion=%s",
+			addedCount, req.Project, req.Description, result.ResourceVersion)
+	}
+
+	setETag(w, result.ResourceVersion)
+	writeJSON(w, status, resp)
+}
+
+// addDestinationsBestEffort adds each destination of a batch independently and
+// reports every outcome with 207 Multi-Status. required lists the fields the
+// project's field policy requires.
+func (h *DestinationHandler) addDestinationsBestEffort(w http.ResponseWriter, r *http.Request, req BatchDestinationRequest, required []string) {
+	resp := BatchResponse{Project: req.Project, Mode: BatchBestEffort}
+
+	for _, dest := range req.Destinations {
+		entryReq := batchEntryRequest(req, dest)
+		entry := BatchEntryResult{Destination: dest}
+
+		if fields := h.destinationErrors(req.Project, dest); len(fields) > 0 {
+			entry.Status = http.StatusUnprocessableEntity
+			entry.Message = joinFieldErrors(fields)
+		} else if fields := missingFieldErrors(req.Project, required, dest); len(fields) > 0 {
+			entry.Status = http.StatusBadRequest
+			entry.Message = joinFieldErrors(fields)
+		} else if msg := h.policyError(entryReq); msg != "" {
+			entry.Status = http.StatusForbidden
+			entry.Message = msg
+		} else if warning, refusal, err := h.namespaceCheck(r.Context(), dest); err != nil {
+			entry.Status = http.StatusInternalServerError
+			entry.Message = namespaceLookupFailed
+		} else if refusal != "" {
+			entry.Status = http.StatusUnprocessableEntity
+			entry.Message = refusal
+		} else {
+			entry.Status, entry.Message = h.addWithRetry(r, req.Project, dest, req.metadata(), &resp)
+			if warning != "" {
+				entry.Warnings = []string{warning}
+			}
+		}
+
+		switch entry.Status {
+		case http.StatusOK:
+			h.logAuditOutcome(r, "add", entryReq, audit.OutcomeNoop, http.StatusOK)
+		case http.StatusCreated:
+			h.logAudit(r, "add", entryReq, entry.Status)
+			h.mirror(r, "add", entryReq)
+		default:
+			h.logAudit(r, "add", entryReq, entry.Status)
+		}
+		resp.Results = append(resp.Results, entry)
+	}
+
+	writeJSON(w, http.StatusMultiStatus, resp)
+}
+
+// addWithRetry adds one destination of a best-effort batch with its metadata,
+// retrying if the project was modified concurrently. A destination the project
+// already has is left as is. It returns the entry's status and message and
+// records the project's latest resourceVersion in resp.
+func (h *DestinationHandler) addWithRetry(r *http.Request, project string, dest argocd.Destination, meta argocd.DestinationMetadata, resp *BatchResponse) (int, string) {
+	for attempt := 1; ; attempt++ {
+		_, result, err := h.client.AddDestinations(r.Context(), project, []argocd.Destination{dest}, meta)
+		if errors.Is(err, argocd.ErrConflict) && attempt < batchAttempts {
+			continue
+		}
+
+		var limitErr *argocd.DestinationLimitError
+		switch {
+		case errors.As(err, &limitErr):
+			return http.StatusUnprocessableEntity, limitErr.Error()
+		case errors.Is(err, argocd.ErrRetryBudgetExhausted):
+			return http.StatusServiceUnavailable, "too many conflicting changes, please retry later"
+		case errors.Is(err, argocd.ErrConflict):
+			return http.StatusConflict, "resource was modified, please retry"
+		case errors.Is(err, argocd.ErrProjectNotFound):
+			return http.StatusNotFound, "project not found: " + project
+		case errors.Is(err, argocd.ErrForbidden):
+			return http.StatusForbidden, "access denied to project: " + project
+		case errors.Is(err, argocd.ErrThrottled):
+			return http.StatusServiceUnavailable, "kubernetes API is throttling requests, please retry later"
+		case errors.Is(err, argocd.ErrProjectBusy):
+			return http.StatusServiceUnavailable, "project is busy with other changes, please retry"
+		case err != nil:
+			log.Printf("Failed to add destination to project %s: %v", project, err)
+			return http.StatusInternalServerError, "internal server error"
+		}
+
+		resp.ResourceVersion = result.ResourceVersion
+		if !result.Changed {
+			return http.StatusOK, "destination already exists"
+		}
+		return http.StatusCreated, ""
+	}
+}
+
+// validateBatchRequest validates the parts of a batch request shared by all
+// of its destinations and writes an error if they are invalid. It returns the
+// status written and whether the request is valid.
+func (h *DestinationHandler) validateBatchRequest(w http.ResponseWriter, r *http.Request, req BatchDestinationRequest) (int, bool) {
+	fields := make(map[string]string)
+	if msg := h.projectNameError(req.Project); msg != "" {
+		fields["project"] = msg
+	}
+	if req.Description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+	switch {
+	case len(req.Destinations) == 0:
+		fields["destinations"] = "at least one destination is required"
+	case len(req.Destinations) > maxBatchSize:
+		fields["destinations"] = "at most " + strconv.Itoa(maxBatchSize) + " destinations are allowed per batch"
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return http.StatusUnprocessableEntity, false
+	}
+
+	if msg := h.ticketError(req.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		return http.StatusBadRequest, false
+	}
+
+	if msg := h.protectedError(req.Project); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		return http.StatusForbidden, false
+	}
+
+	return 0, true
+}
+
+// logBatchAudit writes an audit entry with the same status for every
+// destination of a batch that was rejected as a whole
+func (h *DestinationHandler) logBatchAudit(r *http.Request, req BatchDestinationRequest, dests []argocd.Destination, status int) {
+	if len(dests) == 0 {
+		h.logAudit(r, "add", batchEntryRequest(req, argocd.Destination{}), status)
+		return
+	}
+	for _, dest := range dests {
+		h.logAudit(r, "add", batchEntryRequest(req, dest), status)
+	}
+}
+
+// metadata returns the destination metadata stored for the destinations a
+// batch adds: its description, as their reason
+func (req BatchDestinationRequest) metadata() argocd.DestinationMetadata {
+	return argocd.DestinationMetadata{Reason: req.Description}
+}
+
+// batchEntryRequest describes one destination of a batch as a single add request
+func batchEntryRequest(req BatchDestinationRequest, dest argocd.Destination) DestinationRequest {
+	return DestinationRequest{
+		Project:     req.Project,
+		Server:      dest.Server,
+		Namespace:   dest.Namespace,
+		Name:        dest.Name,
+		Description: req.Description,
+		TicketID:    req.TicketID,
+	}
+}
+
+// joinFieldErrors combines validation messages into one, in field order
+func joinFieldErrors(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for field := range fields {
+		keys = append(keys, field)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, field := range keys {
+		msgs = append(msgs, fields[field])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// indexOf returns the index of dest in list, or -1
+func indexOf(list []argocd.Destination, dest argocd.Destination) int {
+	for i, d := range list {
+		if d == dest {
+			return i
+		}
+	}
+	return -1
+}
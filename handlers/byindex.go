@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// removeByIndex handles DELETE /destinations?index=N, removing the destination
+// at that position of the project's list as returned by a listing with
+// sort=false. The If-Match header must carry the ETag of the listing: the
+// removal is refused with 412 if the project changed since, as the index may
+// then point at another destination. Only project, description and ticketId
+// of the body are used.
+func (h *DestinationHandler) removeByIndex(w http.ResponseWriter, r *http.Request, req DestinationRequest, rawIndex string, force bool) {
+	logAudit := func(req DestinationRequest, outcome string, status int, apps []string, forced bool) {
+		entry := h.auditEntry(r, "remove", req, outcome, status)
+		entry.MatchedBy = audit.MatchIndex
+		entry.InUseBy = apps
+		entry.Forced = forced
+		h.writeAudit(r.Context(), entry)
+	}
+
+	index, err := strconv.Atoi(rawIndex)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "index must be an integer")
+		logAudit(req, audit.OutcomeForStatus(http.StatusBadRequest), http.StatusBadRequest, nil, false)
+		return
+	}
+	if index < 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "index must not be negative")
+		logAudit(req, audit.OutcomeForStatus(http.StatusBadRequest), http.StatusBadRequest, nil, false)
+		return
+	}
+	resourceVersion, ok := ifMatchVersion(r.Header.Get("If-Match"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "removal by index requires an If-Match header with the ETag of the listed destinations")
+		logAudit(req, audit.OutcomeForStatus(http.StatusBadRequest), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	fields := make(map[string]string)
+	if msg := h.projectNameError(req.Project); msg != "" {
+		fields["project"] = msg
+	}
+	if req.Description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		logAudit(req, audit.OutcomeForStatus(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity, nil, false)
+		return
+	}
+	if msg := h.ticketError(req.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		logAudit(req, audit.OutcomeForStatus(http.StatusBadRequest), http.StatusBadRequest, nil, false)
+		return
+	}
+	if msg := h.protectedError(req.Project); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		logAudit(req, audit.OutcomeForStatus(http.StatusForbidden), http.StatusForbidden, nil, false)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		logAudit(req, audit.OutcomeForStatus(status), status, nil, false)
+		return
+	}
+
+	// The in-use check needs to know which destination the index names. The
+	// removal itself re-checks the version, so a change in between is caught.
+	forced := false
+	if h.options.Load().BlockInUseRemoval {
+		if force {
+			forced = true
+		} else {
+			destinations, version, err := h.client.GetDestinations(r.Context(), req.Project)
+			if err == nil && version != resourceVersion {
+				err = argocd.ErrStaleResourceVersion
+			} else if err == nil && index >= len(destinations) {
+				err = argocd.ErrIndexOutOfRange
+			}
+			if err != nil {
+				status := h.handleIndexError(w, r, err, req.Project)
+				logAudit(req, audit.OutcomeForStatus(status), status, nil, false)
+				return
+			}
+			target := destinations[index]
+			if apps, status, ok := h.checkNotInUse(w, r, req.Project, target); !ok {
+				logAudit(withDestination(req, target), audit.OutcomeForStatus(status), status, apps, false)
+				return
+			}
+		}
+	}
+
+	removed, result, err := h.client.RemoveDestinationAt(r.Context(), req.Project, index, resourceVersion)
+	if err != nil {
+		status := h.handleIndexError(w, r, err, req.Project)
+		logAudit(req, audit.OutcomeForStatus(status), status, nil, forced)
+		return
+	}
+
+	logAudit(withDestination(req, removed), audit.OutcomeSuccess, http.StatusOK, nil, forced)
+	h.mirror(r, "remove", withDestination(req, removed))
+
+	log.Printf("Removed destination from project %s by index: index=%d server=%s namespace=%s name=%s reason=%q forced=%t resourceVersion=%s",
+		req.Project, index, removed.Server, removed.Namespace, removed.Name, req.Description, forced, result.ResourceVersion)
+
+	setETag(w, result.ResourceVersion)
+	writeJSON(w, http.StatusOK, RemovedDestinationsResponse{
+		Removed:         []argocd.Destination{removed},
+		Count:           1,
+		ResourceVersion: result.ResourceVersion,
+	})
+}
+
+// handleIndexError writes the response for an error of a removal by index: a
+// changed project is a failed precondition and an index past the end a bad
+// request. Other errors are handled like any Kubernetes error.
+func (h *DestinationHandler) handleIndexError(w http.ResponseWriter, r *http.Request, err error, project string) int {
+	switch {
+	case errors.Is(err, argocd.ErrStaleResourceVersion):
+		writeJSONError(w, r, http.StatusPreconditionFailed, fmt.Sprintf("project %s changed since the If-Match resourceVersion, list its destinations again", project))
+		return http.StatusPreconditionFailed
+	case errors.Is(err, argocd.ErrIndexOutOfRange):
+		writeJSONError(w, r, http.StatusBadRequest, "index is out of range of the project's destinations")
+		return http.StatusBadRequest
+	default:
+		return h.handleK8sError(w, r, err, project)
+	}
+}
+
+// withDestination returns a copy of a request naming a destination, so audit
+// entries of a removal by index record what was removed
+func withDestination(req DestinationRequest, dest argocd.Destination) DestinationRequest {
+	req.Server = dest.Server
+	req.Namespace = dest.Namespace
+	req.Name = dest.Name
+	return req
+}
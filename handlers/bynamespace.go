@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+)
+
+// RemoveByNamespaceRequest represents a request to remove every destination
+// of a project that targets a namespace
+type RemoveByNamespaceRequest struct {
+	Namespace   string `json:"namespace"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// RemoveDestinationsByNamespace handles DELETE
+// /projects/{project}/destinations/by-namespace. Every destination with the
+// namespace is removed, whatever its server, in a single patch. Each removed
+// destination gets its own audit entry, marked as matched by namespace with
+// the number of matches. With Options.BlockInUseRemoval, the removal is
+// refused while Applications of the project deploy to the namespace on any
+// cluster, unless ?force=true.
+func (h *DestinationHandler) RemoveDestinationsByNamespace(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	var body RemoveByNamespaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "remove", DestinationRequest{Project: project}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+
+	req := DestinationRequest{
+		Project:     project,
+		Namespace:   body.Namespace,
+		Description: body.Description,
+		TicketID:    body.TicketID,
+	}
+
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "force must be a boolean")
+			h.logAudit(r, "remove", req, http.StatusBadRequest)
+			return
+		}
+	}
+
+	fields := make(map[string]string)
+	if msg := h.projectNameError(project); msg != "" {
+		fields["project"] = msg
+	}
+	if req.Namespace == "" {
+		fields["namespace"] = "namespace is required"
+	}
+	if req.Description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		h.logAudit(r, "remove", req, http.StatusUnprocessableEntity)
+		return
+	}
+	if msg := h.ticketError(req.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		h.logAudit(r, "remove", req, http.StatusBadRequest)
+		return
+	}
+	if msg := h.protectedError(project); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		h.logAudit(r, "remove", req, http.StatusForbidden)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, project); !ok {
+		h.logAudit(r, "remove", req, status)
+		return
+	}
+
+	// A forced removal skips the in-use check, which its audit entries note.
+	// The wildcards match Applications on any cluster, by server or by name.
+	forced := false
+	if h.options.Load().BlockInUseRemoval {
+		if force {
+			forced = true
+		} else if apps, status, ok := h.checkNotInUse(w, r, project, argocd.Destination{Server: "*", Namespace: req.Namespace, Name: "*"}); !ok {
+			entry := h.auditEntry(r, "remove", req, audit.OutcomeForStatus(status), status)
+			entry.MatchedBy = audit.MatchNamespace
+			entry.InUseBy = apps
+			h.writeAudit(r.Context(), entry)
+			return
+		}
+	}
+
+	logAudit := func(req DestinationRequest, outcome string, matches, status int) {
+		entry := h.auditEntry(r, "remove", req, outcome, status)
+		entry.MatchedBy = audit.MatchNamespace
+		entry.Matches = matches
+		entry.Forced = forced
+		h.writeAudit(r.Context(), entry)
+	}
+
+	removed, result, err := h.client.RemoveDestinationsByNamespace(r.Context(), project, req.Namespace)
+	if err != nil {
+		status := h.handleK8sError(w, r, err, project)
+		logAudit(req, audit.OutcomeForStatus(status), 0, status)
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+
+	if !result.Changed {
+		logAudit(req, audit.OutcomeNoop, 0, http.StatusOK)
+		writeJSON(w, http.StatusOK, NoopResponse{
+			Noop:            true,
+			Message:         "no destination with this namespace, nothing removed",
+			ResourceVersion: result.ResourceVersion,
+		})
+		return
+	}
+
+	for _, dest := range removed {
+		entryReq := req
+		entryReq.Server = dest.Server
+		entryReq.Name = dest.Name
+		logAudit(entryReq, audit.OutcomeSuccess, len(removed), http.StatusOK)
+	}
+	h.mirrorRemoved(r, req, removed)
+
+	log.Printf("Removed %d destinations from project %s by namespace: namespace=%s reason=%q resourceVersion=%s",
+		len(removed), project, req.Namespace, req.Description, result.ResourceVersion)
+
+	writeJSON(w, http.StatusOK, RemovedDestinationsResponse{
+		Removed:         removed,
+		Count:           len(removed),
+		ResourceVersion: result.ResourceVersion,
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultClusterDestinationsLimit = 100
+	maxClusterDestinationsLimit     = 1000
+)
+
+// ClustersResponse represents the clusters registered with ArgoCD
+type ClustersResponse struct {
+	Clusters []argocd.Cluster `json:"clusters"`
+}
+
+// ListClusters handles GET /clusters. It lists the clusters registered with
+// ArgoCD, sorted by name, so clients can offer valid destination servers.
+// The in-cluster cluster is included unless a cluster secret registers its
+// server.
+func (h *DestinationHandler) ListClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := h.client.ListClusters(r.Context())
+	if errors.Is(err, argocd.ErrForbidden) {
+		writeJSONError(w, r, http.StatusForbidden, "access denied to ArgoCD cluster secrets")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to list clusters: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list clusters")
+		return
+	}
+
+	inCluster := false
+	for _, cluster := range clusters {
+		if cluster.Server == argocd.InClusterServer {
+			inCluster = true
+		}
+	}
+	if !inCluster {
+		clusters = append(clusters, argocd.Cluster{Name: argocd.InClusterName, Server: argocd.InClusterServer})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+
+	writeJSON(w, http.StatusOK, ClustersResponse{Clusters: clusters})
+}
+
+// ClusterDestination is a destination together with the project it belongs to
+type ClusterDestination struct {
+	Project string `json:"project"`
+	argocd.Destination
+}
+
+// ClusterDestinationsResponse represents a page of the destinations that
+// target one cluster across all projects
+type ClusterDestinationsResponse struct {
+	Server       string               `json:"server"`
+	Destinations []ClusterDestination `json:"destinations"`
+	// Total counts the matching destinations on all pages
+	Total int `json:"total"`
+	// NextOffset is the offset of the next page, if there is one
+	NextOffset *int `json:"nextOffset,omitempty"`
+	// Errors lists the projects whose destinations couldn't be read and are
+	// missing from the results
+	Errors []ProjectScanError `json:"errors,omitempty"`
+}
+
+// ProjectScanError reports a project skipped by a cluster-wide scan
+type ProjectScanError struct {
+	Project string `json:"project"`
+	Error   string `json:"error"`
+}
+
+// ClusterDestinations handles GET /clusters/{server}/destinations. The server
+// URL is path-escaped. Destinations are ordered by project name, then as
+// stored, and paged with the limit and offset query parameters.
+func (h *DestinationHandler) ClusterDestinations(w http.ResponseWriter, r *http.Request) {
+	server, err := url.PathUnescape(chi.URLParam(r, "server"))
+	if err != nil || server == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "server must be a path-escaped URL")
+		return
+	}
+
+	params := r.URL.Query()
+	limit := defaultClusterDestinationsLimit
+	if v := params.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxClusterDestinationsLimit {
+			writeJSONError(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxClusterDestinationsLimit))
+			return
+		}
+	}
+	offset := 0
+	if v := params.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+	}
+
+	projects, err := h.client.ListProjects(r.Context(), projectSelector(r.Context()), "")
+	if err != nil {
+		log.Printf("Failed to list projects: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list projects")
+		return
+	}
+
+	matches, err := h.client.ServerMatcher(r.Context(), server)
+	if err != nil {
+		log.Printf("Failed to resolve cluster names: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to resolve cluster names")
+		return
+	}
+
+	// ListProjects results may be cached, so sort a copy
+	sorted := append([]argocd.Project(nil), projects...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	all := []ClusterDestination{}
+	var scanErrors []ProjectScanError
+	for _, project := range sorted {
+		if project.Error != "" {
+			scanErrors = append(scanErrors, ProjectScanError{Project: project.Name, Error: project.Error})
+			continue
+		}
+		for _, dest := range project.Destinations {
+			if matches(dest) {
+				all = append(all, ClusterDestination{Project: project.Name, Destination: dest})
+			}
+		}
+	}
+
+	resp := ClusterDestinationsResponse{Server: server, Destinations: []ClusterDestination{}, Total: len(all), Errors: scanErrors}
+	if offset < len(all) {
+		end := min(offset+limit, len(all))
+		resp.Destinations = all[offset:end]
+		if end < len(all) {
+			resp.NextOffset = &end
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
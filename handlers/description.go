@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/example/argocd-destination-api/middleware"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// descriptionPlaceholder matches the placeholders of a DescriptionTemplate
+var descriptionPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// descriptionPlaceholders are the placeholders a DescriptionTemplate may use
+var descriptionPlaceholders = map[string]bool{
+	"{actor}":     true,
+	"{requestId}": true,
+	"{timestamp}": true,
+}
+
+// DescriptionTemplate is the description recorded for changes whose client
+// omitted one, such as "Automated change by {actor} ({requestId})". {actor} is
+// replaced by the actor, {requestId} by the request ID and {timestamp} by the
+// current time in RFC 3339. The zero value leaves descriptions required.
+type DescriptionTemplate struct {
+	Template string
+}
+
+// NewDescriptionTemplate creates a description template, rejecting unknown
+// placeholders
+func NewDescriptionTemplate(template string) (DescriptionTemplate, error) {
+	if strings.TrimSpace(template) == "" {
+		return DescriptionTemplate{}, fmt.Errorf("description template is empty")
+	}
+	for _, placeholder := range descriptionPlaceholder.FindAllString(template, -1) {
+		if !descriptionPlaceholders[placeholder] {
+			return DescriptionTemplate{}, fmt.Errorf("unknown placeholder %s in description template %q", placeholder, template)
+		}
+	}
+	return DescriptionTemplate{Template: template}, nil
+}
+
+// Expand fills in the template for a request
+func (t DescriptionTemplate) Expand(r *http.Request) string {
+	actor, _ := middleware.Actor(r.Context())
+	return t.ExpandFor(actor, chimiddleware.GetReqID(r.Context()))
+}
+
+// ExpandFor fills in the template for a change by actor. requestID is empty
+// for changes made outside a request.
+func (t DescriptionTemplate) ExpandFor(actor, requestID string) string {
+	return strings.NewReplacer(
+		"{actor}", actor,
+		"{requestId}", requestID,
+		"{timestamp}", time.Now().UTC().Format(time.RFC3339),
+	).Replace(t.Template)
+}
+
+// defaultDescription fills in an omitted description from
+// Options.DefaultDescription, before validation, so the audit entry records
+// the description that was applied
+func (h *DestinationHandler) defaultDescription(r *http.Request, description *string) {
+	template := h.options.Load().DefaultDescription
+	if *description == "" && template.Template != "" {
+		*description = template.Expand(r)
+	}
+}
+
+// DefaultDescription returns description, or Options.DefaultDescription
+// filled in for actor if it is empty, for changes made outside the HTTP
+// server such as by the add and remove commands
+func (h *DestinationHandler) DefaultDescription(actor, description string) string {
+	template := h.options.Load().DefaultDescription
+	if description == "" && template.Template != "" {
+		return template.ExpandFor(actor, "")
+	}
+	return description
+}
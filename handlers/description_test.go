@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+func TestDefaultDescriptionOutsideRequests(t *testing.T) {
+	template, err := NewDescriptionTemplate("Change by {actor} (request {requestId})")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHandler(t, Options{DefaultDescription: template}, argocd.Options{})
+	if got := h.DefaultDescription("cli", ""); got != "Change by cli (request )" {
+		t.Errorf("DefaultDescription() = %q, want the template filled in for cli", got)
+	}
+	if got := h.DefaultDescription("cli", "onboarding"); got != "onboarding" {
+		t.Errorf("DefaultDescription() = %q, want the given description", got)
+	}
+
+	h = newTestHandler(t, Options{}, argocd.Options{})
+	if got := h.DefaultDescription("cli", ""); got != "" {
+		t.Errorf("DefaultDescription() = %q without a template, want it left empty", got)
+	}
+}
@@ -1,22 +1,94 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/example/argocd-destination-api/argocd"
 	"github.com/example/argocd-destination-api/audit"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
-var projectNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+// defaultProjectNameRegex matches RFC 1123 labels, which AppProject names
+// must be: lowercase alphanumerics and dashes, starting and ending with an
+// alphanumeric
+var defaultProjectNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// maxProjectNameLength is the maximum length of an RFC 1123 label
+const maxProjectNameLength = 63
 
 // DestinationHandler handles destination-related HTTP requests
 type DestinationHandler struct {
 	client      *argocd.Client
 	auditLogger *audit.Logger
+	labels      *labelCache
+	// options is replaced as a whole by SetOptions while requests are served
+	options atomic.Pointer[Options]
+}
+
+// Options configures optional handler policies. The zero value applies no
+// policies beyond the built-in validation rules.
+type Options struct {
+	// NamespacePolicy restricts the namespaces new destinations may target
+	NamespacePolicy NamespacePolicy
+	// NamespaceConvention restricts new destinations to namespaces named
+	// after their project
+	NamespaceConvention NamespaceConvention
+	// CreateProjectsOnImport lets POST /projects/import create projects that
+	// exist in the import document but not in the cluster
+	CreateProjectsOnImport bool
+	// RequireTicket rejects changes that don't reference a change ticket
+	RequireTicket bool
+	// TicketPattern, if set, is the format change-ticket references must match
+	TicketPattern *regexp.Regexp
+	// WildcardProjects lists the projects that may have wildcard (*) server
+	// or namespace destinations. All other projects reject wildcards.
+	WildcardProjects map[string]bool
+	// ProjectNamePattern replaces the RFC 1123 label rules project names are
+	// validated against
+	ProjectNamePattern *regexp.Regexp
+	// FieldPolicy requires additional destination fields for some projects
+	FieldPolicy FieldPolicy
+	// CheckDestinationUsage warns when an added destination isn't used by
+	// any Application or ApplicationSet of the project
+	CheckDestinationUsage bool
+	// NamespaceCheck checks that the namespace of a destination added for the
+	// in-cluster server exists, warning or refusing the add if not. Empty
+	// disables the check.
+	NamespaceCheck NamespaceCheckMode
+	// BlockInUseRemoval refuses to remove a destination that Applications of
+	// the project deploy to, unless the removal is forced
+	BlockInUseRemoval bool
+	// ProjectSearchLimit caps the matches returned by GET /projects/search;
+	// zero uses DefaultProjectSearchLimit
+	ProjectSearchLimit int
+	// DefaultDescription, if set, is recorded as the description of changes
+	// that omit one instead of rejecting them
+	DefaultDescription DescriptionTemplate
+	// SortDestinations sorts listed destinations by server, namespace and
+	// name and drops exact duplicates unless a request passes sort=false
+	SortDestinations bool
+	// ProtectedProjects can't be changed through the API, whatever the key
+	ProtectedProjects ProtectedProjects
+	// MirrorNamespace, if set, is an ArgoCD namespace successful adds and
+	// removals are replayed in, best effort
+	MirrorNamespace string
+	// IssueRoleTokens enables issuing project role tokens, which signs them
+	// with ArgoCD's server secret key
+	IssueRoleTokens bool
 }
 
 // DestinationRequest represents a request to add or remove a destination
@@ -26,16 +98,62 @@ type DestinationRequest struct {
 	Namespace   string `json:"namespace"`
 	Name        string `json:"name,omitempty"`
 	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+	// ExpiresAt makes an added destination temporary; the expiry sweeper
+	// removes it once this time has passed. Ignored on remove.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Owner and Reason are stored as the destination's metadata. An add
+	// without a reason stores its description instead. Ignored on remove.
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// metadata returns the destination metadata the request sets
+func (req DestinationRequest) metadata() argocd.DestinationMetadata {
+	return argocd.DestinationMetadata{Owner: req.Owner, Reason: req.Reason, ExpiresAt: req.ExpiresAt}
 }
 
-// ErrorResponse represents a JSON error response
+// addMetadata returns the destination metadata an add stores: the request's,
+// with the description as the reason unless one is given, so listings show
+// why each destination currently exists
+func (req DestinationRequest) addMetadata() argocd.DestinationMetadata {
+	meta := req.metadata()
+	if meta.Reason == "" {
+		meta.Reason = req.Description
+	}
+	return meta
+}
+
+// ErrorResponse represents a JSON error response. Fields maps request field
+// names to validation messages and is only set for validation errors.
 type ErrorResponse struct {
-	Message string `json:"message"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
 }
 
-// DestinationsResponse represents a list of destinations
+// NoopResponse is returned when a mutation found nothing to change
+type NoopResponse struct {
+	Noop            bool   `json:"noop"`
+	Message         string `json:"message"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// DestinationResponse represents a destination after a mutation together with
+// the AppProject's resulting resourceVersion
+type DestinationResponse struct {
+	argocd.Destination
+	ResourceVersion string     `json:"resourceVersion,omitempty"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
+	// MetadataUpdated is set when the destination already existed and only
+	// its metadata was updated
+	MetadataUpdated bool `json:"metadataUpdated,omitempty"`
+	// Warnings are advisory findings that didn't stop the change
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DestinationsResponse represents a list of destinations with their metadata
 type DestinationsResponse struct {
-	Destinations []argocd.Destination `json:"destinations"`
+	Destinations []argocd.DestinationDetails `json:"destinations"`
 }
 
 // ProjectsResponse represents a list of projects
@@ -44,69 +162,206 @@ type ProjectsResponse struct {
 }
 
 // NewDestinationHandler creates a new destination handler
-func NewDestinationHandler(client *argocd.Client, auditLogger *audit.Logger) *DestinationHandler {
-	return &DestinationHandler{
+func NewDestinationHandler(client *argocd.Client, auditLogger *audit.Logger, options Options) *DestinationHandler {
+	h := &DestinationHandler{
 		client:      client,
 		auditLogger: auditLogger,
+		labels:      newLabelCache(client, projectLabelTTL),
+	}
+	h.options.Store(&options)
+	return h
+}
+
+// Options returns the policies the handler currently applies
+func (h *DestinationHandler) Options() Options {
+	return *h.options.Load()
+}
+
+// SetOptions replaces the handler's policies. Requests already being handled
+// may finish with the old ones.
+func (h *DestinationHandler) SetOptions(options Options) {
+	h.options.Store(&options)
+}
+
+// sortRequested reports whether listed destinations should be sorted and
+// deduplicated: the sort query parameter if given, otherwise
+// Options.SortDestinations. It writes an error if the parameter is malformed.
+func (h *DestinationHandler) sortRequested(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("sort")
+	if v == "" {
+		return h.options.Load().SortDestinations, true
 	}
+	sorted, err := strconv.ParseBool(v)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "sort must be a boolean")
+		return false, false
+	}
+	return sorted, true
 }
 
-// ListProjects handles GET /projects
+// sortProject returns a copy of the project with its destinations sorted and
+// deduplicated, leaving the original, which may be cached, untouched
+func sortProject(project argocd.Project) argocd.Project {
+	project.Destinations = argocd.SortDestinations(project.Destinations)
+	project.DestinationCount = len(project.Destinations)
+	return project
+}
+
+// ListProjects handles GET /projects. The optional fieldSelector query
+// parameter filters projects server-side by metadata.name or metadata.namespace,
+// and sort selects sorted, deduplicated destinations.
 func (h *DestinationHandler) ListProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := h.client.ListProjects(r.Context())
+	fieldSelector := r.URL.Query().Get("fieldSelector")
+	if msg := fieldSelectorError(fieldSelector); msg != "" {
+		writeJSONError(w, r, http.StatusBadRequest, msg)
+		return
+	}
+	sorted, ok := h.sortRequested(w, r)
+	if !ok {
+		return
+	}
+
+	projects, err := h.client.ListProjects(r.Context(), projectSelector(r.Context()), fieldSelector)
 	if err != nil {
 		log.Printf("Failed to list projects: %v", err)
-		writeJSONError(w, http.StatusInternalServerError, "failed to list projects")
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list projects")
 		return
 	}
 
 	if projects == nil {
 		projects = []argocd.Project{}
 	}
+	if sorted {
+		// ListProjects results may be cached, so sort copies
+		projects = append([]argocd.Project(nil), projects...)
+		for i := range projects {
+			projects[i] = sortProject(projects[i])
+		}
+	}
 
 	writeJSON(w, http.StatusOK, ProjectsResponse{Projects: projects})
 }
 
+// GetProject handles GET /projects/{project}. Besides the destination
+// summary it returns the rest of the spec the API manages, with the
+// resourceVersion as its ETag.
+func (h *DestinationHandler) GetProject(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	sorted, ok := h.sortRequested(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	details, err := h.client.GetProjectDetails(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+	if sorted {
+		details.Project = sortProject(details.Project)
+	}
+
+	setETag(w, details.ResourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), details.ResourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
 // ListDestinationsRequest represents a request to list destinations
 type ListDestinationsRequest struct {
 	Project string `json:"project"`
 }
 
-// ListDestinations handles POST /destinations/list
+// ListDestinations handles POST /destinations/list. The response carries the
+// AppProject resourceVersion as its ETag, and a request whose If-None-Match
+// matches it gets 304 Not Modified without a body. The sort query parameter
+// selects sorted, deduplicated destinations.
 func (h *DestinationHandler) ListDestinations(w http.ResponseWriter, r *http.Request) {
 	var req ListDestinationsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if !h.validateProjectName(w, r, req.Project) {
+		return
+	}
+	sorted, ok := h.sortRequested(w, r)
+	if !ok {
 		return
 	}
 
-	if !h.validateProjectName(w, req.Project) {
+	if _, ok := h.authorizeProject(w, r, req.Project); !ok {
 		return
 	}
 
-	destinations, _, err := h.client.GetDestinations(r.Context(), req.Project)
+	destinations, resourceVersion, err := h.client.GetDestinationDetails(r.Context(), req.Project)
 	if err != nil {
-		h.handleK8sError(w, err, req.Project)
+		h.handleK8sError(w, r, err, req.Project)
 		return
 	}
+	if sorted {
+		destinations = argocd.SortDestinationDetails(destinations)
+	}
 
-	// Ensure we return an empty array, not null
-	if destinations == nil {
-		destinations = []argocd.Destination{}
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	writeJSON(w, http.StatusOK, DestinationsResponse{Destinations: destinations})
+	writeDestinations(w, destinations)
+}
+
+// writeDestinations writes a DestinationsResponse, encoding the destinations
+// one at a time instead of building the whole document in memory first.
+// Everything that can fail with a proper status must be checked beforehand.
+func writeDestinations(w http.ResponseWriter, destinations []argocd.DestinationDetails) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	io.WriteString(w, `{"destinations":[`)
+	for i, dest := range destinations {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		if err := enc.Encode(dest); err != nil {
+			// The status has already been sent, so abort the response to keep
+			// clients from mistaking a truncated list for a complete one.
+			log.Printf("Destination list aborted after %d destinations: %v", i, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	io.WriteString(w, "]}\n")
 }
 
 // AddDestination handles POST /destinations
 func (h *DestinationHandler) AddDestination(w http.ResponseWriter, r *http.Request) {
 	var req DestinationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "add", req, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &req.Description)
+
+	if status, ok := h.validateDestinationRequest(w, r, "add", req); !ok {
+		h.logAudit(r, "add", req, status)
 		return
 	}
 
-	if !h.validateDestinationRequest(w, req) {
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		h.logAudit(r, "add", req, status)
 		return
 	}
 
@@ -116,45 +371,133 @@ func (h *DestinationHandler) AddDestination(w http.ResponseWriter, r *http.Reque
 		Name:      req.Name,
 	}
 
-	err := h.client.AddDestination(r.Context(), req.Project, dest)
+	required, err := h.requiredFields(r.Context(), req.Project)
 	if err != nil {
-		if errors.IsConflict(err) {
-			writeJSONError(w, http.StatusConflict, "resource was modified, please retry")
+		h.logAudit(r, "add", req, h.handleK8sError(w, r, err, req.Project))
+		return
+	}
+	if fields := missingFieldErrors(req.Project, required, dest); len(fields) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: joinFieldErrors(fields), Fields: fields})
+		h.logAudit(r, "add", req, http.StatusBadRequest)
+		return
+	}
+
+	namespaceWarning, status, ok := h.checkNamespaceExists(w, r, dest)
+	if !ok {
+		h.logAudit(r, "add", req, status)
+		return
+	}
+
+	result, err := h.client.AddDestinationWithMetadata(r.Context(), req.Project, dest, req.addMetadata())
+	if err != nil {
+		var limitErr *argocd.DestinationLimitError
+		if errors.As(err, &limitErr) {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, limitErr.Error())
+			h.logAudit(r, "add", req, http.StatusUnprocessableEntity)
 			return
 		}
-		h.handleK8sError(w, err, req.Project)
+		h.logAudit(r, "add", req, h.handleK8sError(w, r, err, req.Project))
 		return
 	}
 
-	// Write audit log entry
-	if err := h.auditLogger.Log(audit.Entry{
-		Action:      "add",
-		Project:     req.Project,
-		Server:      req.Server,
-		Namespace:   req.Namespace,
-		Name:        req.Name,
-		Description: req.Description,
-		UserAgent:   r.UserAgent(),
-		RemoteAddr:  r.RemoteAddr,
-	}); err != nil {
-		log.Printf("Failed to write audit log: %v", err)
+	setETag(w, result.ResourceVersion)
+	resp := DestinationResponse{Destination: dest, ResourceVersion: result.ResourceVersion}
+	if namespaceWarning != "" {
+		resp.Warnings = append(resp.Warnings, namespaceWarning)
+	}
+	if msg := h.usageWarning(r.Context(), req.Project, dest); msg != "" {
+		resp.Warnings = append(resp.Warnings, msg)
+	}
+	if existing := result.Existing; existing != nil && *existing != dest {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("the project already targets this cluster and namespace as server=%q name=%q; no duplicate was added", existing.Server, existing.Name))
+	}
+
+	if !result.Changed {
+		h.logAuditOutcome(r, "add", req, audit.OutcomeNoop, http.StatusOK)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp.ExpiresAt = req.ExpiresAt
+
+	// The destination already existed, so the add only updated its metadata
+	if result.MetadataUpdated {
+		resp.MetadataUpdated = true
+		h.logAudit(r, "update_metadata", req, http.StatusOK)
+		h.mirror(r, "add", req)
+
+		log.Printf("Updated destination metadata on add to project %s: server=%s namespace=%s name=%s owner=%q reason=%q resourceVersion=%s",
+			req.Project, dest.Server, dest.Namespace, dest.Name, req.Owner, req.Reason, result.ResourceVersion)
+
+		writeJSON(w, http.StatusOK, resp)
+		return
 	}
 
-	log.Printf("Added destination to project %s: server=%s namespace=%s name=%s reason=%q",
-		req.Project, dest.Server, dest.Namespace, dest.Name, req.Description)
+	h.logAudit(r, "add", req, http.StatusCreated)
+	h.mirror(r, "add", req)
 
-	writeJSON(w, http.StatusCreated, dest)
+	log.Printf("Added destination to project %s: server=%s namespace=%s name=%s reason=%q resourceVersion=%s",
+		req.Project, dest.Server, dest.Namespace, dest.Name, req.Description, result.ResourceVersion)
+	if isWildcard(req) {
+		log.Printf("WARNING: wildcard destination added to project %s: server=%s namespace=%s", req.Project, dest.Server, dest.Namespace)
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
 }
 
-// RemoveDestination handles DELETE /destinations
+// DestinationInUseResponse is returned when a removal is refused because
+// Applications deploy to the destination
+type DestinationInUseResponse struct {
+	Message      string   `json:"message"`
+	Applications []string `json:"applications"`
+}
+
+// RemoveDestination handles DELETE /destinations. With
+// ?matchByServerNamespace=true the name is ignored and every destination with
+// the request's server and namespace is removed. With
+// Options.BlockInUseRemoval, destinations Applications deploy to are only
+// removed with ?force=true.
 func (h *DestinationHandler) RemoveDestination(w http.ResponseWriter, r *http.Request) {
 	var req DestinationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "remove", req, http.StatusBadRequest)
 		return
 	}
+	h.defaultDescription(r, &req.Description)
 
-	if !h.validateDestinationRequest(w, req) {
+	matchByServerNamespace := false
+	if v := r.URL.Query().Get("matchByServerNamespace"); v != "" {
+		var err error
+		if matchByServerNamespace, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "matchByServerNamespace must be a boolean")
+			h.logAudit(r, "remove", req, http.StatusBadRequest)
+			return
+		}
+	}
+
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "force must be a boolean")
+			h.logAudit(r, "remove", req, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if v := r.URL.Query().Get("index"); v != "" {
+		h.removeByIndex(w, r, req, v, force)
+		return
+	}
+
+	if status, ok := h.validateDestinationRequest(w, r, "remove", req); !ok {
+		h.logAudit(r, "remove", req, status)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		h.logAudit(r, "remove", req, status)
 		return
 	}
 
@@ -163,100 +506,509 @@ func (h *DestinationHandler) RemoveDestination(w http.ResponseWriter, r *http.Re
 		Namespace: req.Namespace,
 		Name:      req.Name,
 	}
+	if matchByServerNamespace {
+		dest.Name = ""
+	}
 
-	err := h.client.RemoveDestination(r.Context(), req.Project, dest)
-	if err != nil {
-		if errors.IsConflict(err) {
-			writeJSONError(w, http.StatusConflict, "resource was modified, please retry")
+	// A forced removal skips the in-use check, which its audit entries note
+	forced := false
+	if h.options.Load().BlockInUseRemoval {
+		if force {
+			forced = true
+		} else if apps, status, ok := h.checkNotInUse(w, r, req.Project, dest); !ok {
+			entry := h.auditEntry(r, "remove", req, audit.OutcomeForStatus(status), status)
+			entry.InUseBy = apps
+			h.writeAudit(r.Context(), entry)
 			return
 		}
-		h.handleK8sError(w, err, req.Project)
+	}
+
+	if matchByServerNamespace {
+		h.removeByServerNamespace(w, r, req, forced)
 		return
 	}
 
-	// Write audit log entry
-	if err := h.auditLogger.Log(audit.Entry{
-		Action:      "remove",
-		Project:     req.Project,
-		Server:      req.Server,
-		Namespace:   req.Namespace,
-		Name:        req.Name,
-		Description: req.Description,
-		UserAgent:   r.UserAgent(),
-		RemoteAddr:  r.RemoteAddr,
-	}); err != nil {
-		log.Printf("Failed to write audit log: %v", err)
+	logAudit := func(outcome string, status int) {
+		entry := h.auditEntry(r, "remove", req, outcome, status)
+		entry.Forced = forced
+		h.writeAudit(r.Context(), entry)
 	}
 
-	log.Printf("Removed destination from project %s: server=%s namespace=%s name=%s reason=%q",
-		req.Project, dest.Server, dest.Namespace, dest.Name, req.Description)
+	result, err := h.client.RemoveDestination(r.Context(), req.Project, dest)
+	if err != nil {
+		status := h.handleK8sError(w, r, err, req.Project)
+		logAudit(audit.OutcomeForStatus(status), status)
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+
+	if !result.Changed {
+		logAudit(audit.OutcomeNoop, http.StatusOK)
+		writeJSON(w, http.StatusOK, NoopResponse{
+			Noop:            true,
+			Message:         "destination not found, nothing removed",
+			ResourceVersion: result.ResourceVersion,
+		})
+		return
+	}
+
+	logAudit(audit.OutcomeSuccess, http.StatusNoContent)
+	h.mirror(r, "remove", req)
+
+	log.Printf("Removed destination from project %s: server=%s namespace=%s name=%s reason=%q forced=%t resourceVersion=%s",
+		req.Project, dest.Server, dest.Namespace, dest.Name, req.Description, forced, result.ResourceVersion)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// validateProjectName validates the project name and writes an error if invalid
-func (h *DestinationHandler) validateProjectName(w http.ResponseWriter, project string) bool {
-	if project == "" {
-		writeJSONError(w, http.StatusBadRequest, "project name is required")
-		return false
+// RemovedDestinationsResponse lists the destinations a removal by server and
+// namespace removed
+type RemovedDestinationsResponse struct {
+	Removed         []argocd.Destination `json:"removed"`
+	Count           int                  `json:"count"`
+	ResourceVersion string               `json:"resourceVersion,omitempty"`
+}
+
+// removeByServerNamespace removes every destination with the request's server
+// and namespace. Each removed destination gets its own audit entry, marked as
+// matched by server and namespace with the number of matches, since the
+// request didn't identify it exactly.
+func (h *DestinationHandler) removeByServerNamespace(w http.ResponseWriter, r *http.Request, req DestinationRequest, forced bool) {
+	logAudit := func(req DestinationRequest, outcome string, matches, status int) {
+		entry := h.auditEntry(r, "remove", req, outcome, status)
+		entry.MatchedBy = audit.MatchServerNamespace
+		entry.Matches = matches
+		entry.Forced = forced
+		h.writeAudit(r.Context(), entry)
+	}
+
+	removed, result, err := h.client.RemoveDestinationsByServerNamespace(r.Context(), req.Project, req.Server, req.Namespace)
+	if err != nil {
+		status := h.handleK8sError(w, r, err, req.Project)
+		logAudit(req, audit.OutcomeForStatus(status), 0, status)
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+
+	if !result.Changed {
+		logAudit(req, audit.OutcomeNoop, 0, http.StatusOK)
+		writeJSON(w, http.StatusOK, NoopResponse{
+			Noop:            true,
+			Message:         "no destination with this server and namespace, nothing removed",
+			ResourceVersion: result.ResourceVersion,
+		})
+		return
+	}
+
+	for _, dest := range removed {
+		entryReq := req
+		entryReq.Name = dest.Name
+		logAudit(entryReq, audit.OutcomeSuccess, len(removed), http.StatusOK)
+	}
+	h.mirrorRemoved(r, req, removed)
+
+	log.Printf("Removed %d destinations from project %s by server and namespace: server=%s namespace=%s reason=%q resourceVersion=%s",
+		len(removed), req.Project, req.Server, req.Namespace, req.Description, result.ResourceVersion)
+
+	writeJSON(w, http.StatusOK, RemovedDestinationsResponse{
+		Removed:         removed,
+		Count:           len(removed),
+		ResourceVersion: result.ResourceVersion,
+	})
+}
+
+// checkNotInUse refuses the removal of a destination that Applications of the
+// project deploy to with 409, listing them in the response. If the
+// Applications can't be listed the removal is refused too, since it can't be
+// shown to be safe. It returns the Applications using the destination, the
+// status written and false if the removal must not proceed.
+func (h *DestinationHandler) checkNotInUse(w http.ResponseWriter, r *http.Request, project string, dest argocd.Destination) ([]string, int, bool) {
+	apps, err := h.client.ApplicationsUsing(r.Context(), project, dest)
+	if err != nil {
+		log.Printf("Failed to check Applications using destination of project %s: %v", project, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to check whether Applications use the destination; pass force=true to remove it anyway")
+		return nil, http.StatusInternalServerError, false
+	}
+	if len(apps) == 0 {
+		return nil, 0, true
+	}
+
+	sort.Strings(apps)
+	msg := "destination is in use by Applications " + strings.Join(apps, ", ") + "; pass force=true to remove it anyway"
+	if prefersPlainText(r) {
+		writeJSONError(w, r, http.StatusConflict, msg)
+	} else {
+		writeJSON(w, http.StatusConflict, DestinationInUseResponse{Message: msg, Applications: apps})
+	}
+	return apps, http.StatusConflict, false
+}
+
+// usageWarning returns a warning if Options.CheckDestinationUsage is set and
+// no Application or ApplicationSet of the project deploys to the destination,
+// so the grant may be dead. Failures to check are logged, not reported.
+func (h *DestinationHandler) usageWarning(ctx context.Context, project string, dest argocd.Destination) string {
+	if !h.options.Load().CheckDestinationUsage {
+		return ""
+	}
+
+	apps, err := h.client.ApplicationsUsing(ctx, project, dest)
+	if err != nil {
+		log.Printf("Failed to check Applications using destination of project %s: %v", project, err)
+		return ""
+	}
+	if len(apps) > 0 {
+		return ""
+	}
+
+	appSets, err := h.client.ApplicationSetsUsing(ctx, project, dest)
+	if err != nil {
+		log.Printf("Failed to check ApplicationSets using destination of project %s: %v", project, err)
+		return ""
+	}
+	if len(appSets) > 0 {
+		return ""
 	}
 
-	if !projectNameRegex.MatchString(project) {
-		writeJSONError(w, http.StatusBadRequest, "project name must contain only alphanumeric characters, dashes, and underscores")
+	return "no Application or ApplicationSet of project " + project + " deploys to this destination"
+}
+
+// validateProjectName validates the project name and writes an error if invalid
+func (h *DestinationHandler) validateProjectName(w http.ResponseWriter, r *http.Request, project string) bool {
+	if msg := h.projectNameError(project); msg != "" {
+		writeJSONError(w, r, http.StatusBadRequest, msg)
 		return false
 	}
 
 	return true
 }
 
-// validateDestinationRequest validates a destination request and writes an error if invalid
-func (h *DestinationHandler) validateDestinationRequest(w http.ResponseWriter, req DestinationRequest) bool {
-	if !h.validateProjectName(w, req.Project) {
-		return false
+// projectNameError returns a message describing why the project name is invalid,
+// or an empty string if it is valid
+func (h *DestinationHandler) projectNameError(project string) string {
+	if project == "" {
+		return "project name is required"
 	}
 
-	if req.Server == "" {
-		writeJSONError(w, http.StatusBadRequest, "server is required")
-		return false
+	if pattern := h.options.Load().ProjectNamePattern; pattern != nil {
+		if !pattern.MatchString(project) {
+			return fmt.Sprintf("project name %q must match %s", project, pattern)
+		}
+		return ""
 	}
 
-	if req.Namespace == "" {
-		writeJSONError(w, http.StatusBadRequest, "namespace is required")
-		return false
+	switch {
+	case len(project) > maxProjectNameLength:
+		return fmt.Sprintf("project name must be at most %d characters, got %d", maxProjectNameLength, len(project))
+	case strings.ToLower(project) != project:
+		return fmt.Sprintf("project name %q must be lowercase", project)
+	case !defaultProjectNameRegex.MatchString(project):
+		return fmt.Sprintf("project name %q must consist of lowercase alphanumeric characters or '-', and must start and end with an alphanumeric character", project)
 	}
 
-	if req.Server == "*" {
-		writeJSONError(w, http.StatusBadRequest, "wildcard server (*) is not allowed")
-		return false
+	return ""
+}
+
+// validateDestinationRequest validates a destination request for the given
+// action and writes an error if it is invalid: a 422 listing every invalid
+// field, a 400 for a missing or malformed ticket reference, or a 403 if the
+// project is protected or an add violates a policy. It returns the status
+// written and whether the request is valid.
+func (h *DestinationHandler) validateDestinationRequest(w http.ResponseWriter, r *http.Request, action string, req DestinationRequest) (int, bool) {
+	if fields := h.destinationRequestErrors(req); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return http.StatusUnprocessableEntity, false
 	}
 
-	if req.Namespace == "*" {
-		writeJSONError(w, http.StatusBadRequest, "wildcard namespace (*) is not allowed")
-		return false
+	if msg := h.protectedError(req.Project); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		return http.StatusForbidden, false
+	}
+
+	if msg := h.ticketError(req.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		return http.StatusBadRequest, false
+	}
+
+	if action != "remove" && req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeValidationError(w, r, map[string]string{"expiresAt": "expiresAt must be in the future"})
+		return http.StatusUnprocessableEntity, false
+	}
+
+	if action == "add" {
+		if msg := h.policyError(req); msg != "" {
+			writeJSONError(w, r, http.StatusForbidden, msg)
+			return http.StatusForbidden, false
+		}
+	}
+
+	return 0, true
+}
+
+// Validate returns the validation errors of a destination request for the
+// given action keyed by JSON field name, or an empty map if it is valid. It
+// applies the same rules as the HTTP handlers so other entrypoints can reuse them.
+func (h *DestinationHandler) Validate(ctx context.Context, action string, req DestinationRequest) map[string]string {
+	fields := h.destinationRequestErrors(req)
+	if msg := h.ticketError(req.TicketID); msg != "" {
+		fields["ticketId"] = msg
+	}
+	if msg := h.protectedError(req.Project); msg != "" && fields["project"] == "" {
+		fields["project"] = msg
+	}
+	if len(fields) == 0 && action == "add" {
+		if msg := h.policyError(req); msg != "" {
+			fields["policy"] = msg
+		}
+	}
+	if len(fields) == 0 && action == "add" {
+		required, err := h.requiredFields(ctx, req.Project)
+		if err != nil {
+			fields["project"] = fmt.Sprintf("failed to look up project %s: %v", req.Project, err)
+			return fields
+		}
+		dest := argocd.Destination{Server: req.Server, Namespace: req.Namespace, Name: req.Name}
+		for field, msg := range missingFieldErrors(req.Project, required, dest) {
+			fields[field] = msg
+		}
+	}
+	return fields
+}
+
+// policyError returns a message naming the policy rule a new destination
+// violates, or an empty string if it complies. Policies only restrict adds so
+// that destinations violating them can still be removed.
+func (h *DestinationHandler) policyError(req DestinationRequest) string {
+	_, msg := h.policyViolation(req.Project, req.Namespace)
+	return msg
+}
+
+// policyViolation returns the policy rule a destination namespace of a project
+// violates and a message describing it, or empty strings if it complies
+func (h *DestinationHandler) policyViolation(project, namespace string) (string, string) {
+	options := h.options.Load()
+	if msg := options.NamespacePolicy.Check(namespace); msg != "" {
+		return RuleNamespacePolicy, msg
+	}
+	if msg := options.NamespaceConvention.Check(project, namespace); msg != "" {
+		return RuleNamespaceConvention, msg
+	}
+	return "", ""
+}
+
+// ticketError returns a message explaining why a change-ticket reference is
+// missing or malformed, or an empty string if it is acceptable. A reference is
+// checked against Options.TicketPattern whenever one is given.
+func (h *DestinationHandler) ticketError(ticketID string) string {
+	if ticketID == "" {
+		if h.options.Load().RequireTicket {
+			return "ticketId is required (reference the change ticket for this change)"
+		}
+		return ""
+	}
+	if pattern := h.options.Load().TicketPattern; pattern != nil && !pattern.MatchString(ticketID) {
+		return fmt.Sprintf("ticketId %q does not match the required format %s", ticketID, pattern)
+	}
+	return ""
+}
+
+// destinationRequestErrors collects the validation errors of a destination
+// request keyed by JSON field name
+func (h *DestinationHandler) destinationRequestErrors(req DestinationRequest) map[string]string {
+	fields := h.destinationErrors(req.Project, argocd.Destination{
+		Server:    req.Server,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+	})
+
+	if msg := h.projectNameError(req.Project); msg != "" {
+		fields["project"] = msg
 	}
 
 	if req.Description == "" {
-		writeJSONError(w, http.StatusBadRequest, "description is required (explain why this change is being made)")
-		return false
+		fields["description"] = "description is required (explain why this change is being made)"
 	}
 
-	return true
+	return fields
 }
 
-// handleK8sError handles Kubernetes API errors and writes appropriate HTTP responses
-func (h *DestinationHandler) handleK8sError(w http.ResponseWriter, err error, project string) {
-	if errors.IsNotFound(err) {
-		writeJSONError(w, http.StatusNotFound, "project not found: "+project)
-		return
+// destinationErrors collects the validation errors of a single destination of
+// a project keyed by JSON field name. Wildcards are only allowed for projects
+// in Options.WildcardProjects.
+func (h *DestinationHandler) destinationErrors(project string, dest argocd.Destination) map[string]string {
+	fields := make(map[string]string)
+	allowWildcards := h.options.Load().WildcardProjects[project]
+
+	if dest.Server == "" {
+		fields["server"] = "server is required"
+	} else if dest.Server == "*" && !allowWildcards {
+		fields["server"] = "wildcard server (*) is not allowed"
 	}
 
-	if errors.IsForbidden(err) {
-		writeJSONError(w, http.StatusForbidden, "access denied to project: "+project)
-		return
+	if dest.Namespace == "" {
+		fields["namespace"] = "namespace is required"
+	} else if dest.Namespace == "*" && !allowWildcards {
+		fields["namespace"] = "wildcard namespace (*) is not allowed"
+	}
+
+	return fields
+}
+
+// isWildcard reports whether a destination request targets any server or any namespace
+func isWildcard(req DestinationRequest) bool {
+	return req.Server == "*" || req.Namespace == "*"
+}
+
+// handleK8sError handles errors from the ArgoCD client and writes appropriate HTTP responses.
+// It returns the status code that was written.
+func (h *DestinationHandler) handleK8sError(w http.ResponseWriter, r *http.Request, err error, project string) int {
+	if errors.Is(err, argocd.ErrProjectNotFound) {
+		writeJSONError(w, r, http.StatusNotFound, "project not found: "+project)
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, argocd.ErrForbidden) {
+		writeJSONError(w, r, http.StatusForbidden, "access denied to project: "+project)
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, argocd.ErrProjectExists) {
+		writeJSONError(w, r, http.StatusConflict, "project already exists: "+project)
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, argocd.ErrRoleNotFound) {
+		writeJSONError(w, r, http.StatusNotFound, err.Error())
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, argocd.ErrSigningKeyUnavailable) {
+		log.Printf("Can't issue role token for project %s: %v", project, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "ArgoCD token signing key unavailable")
+		return http.StatusInternalServerError
+	}
+
+	if errors.Is(err, argocd.ErrRoleExists) {
+		writeJSONError(w, r, http.StatusConflict, err.Error())
+		return http.StatusConflict
+	}
+
+	// Checked before ErrConflict, which it wraps
+	if errors.Is(err, argocd.ErrRetryBudgetExhausted) {
+		log.Printf("Conflict retry budget exhausted for project %s: %v", project, err)
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, r, http.StatusServiceUnavailable, "too many conflicting changes, please retry later")
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, argocd.ErrConflict) {
+		writeJSONError(w, r, http.StatusConflict, "resource was modified, please retry")
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, argocd.ErrProjectBusy) {
+		log.Printf("Gave up waiting for other changes to project %s: %v", project, err)
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, r, http.StatusServiceUnavailable, "project is busy with other changes, please retry")
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, argocd.ErrThrottled) {
+		retryAfter := time.Second
+		if d, ok := argocd.RetryAfter(err); ok && d > 0 {
+			retryAfter = d
+		}
+		log.Printf("Kubernetes API throttled request for project %s, retry after %s: %v", project, retryAfter, err)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		writeJSONError(w, r, http.StatusServiceUnavailable, "kubernetes API is throttling requests, please retry later")
+		return http.StatusServiceUnavailable
 	}
 
 	log.Printf("Kubernetes API error: %v", err)
-	writeJSONError(w, http.StatusInternalServerError, "internal server error")
+	writeJSONError(w, r, http.StatusInternalServerError, "internal server error")
+	return http.StatusInternalServerError
+}
+
+// logAudit writes an audit entry for a mutation attempt. The outcome is derived
+// from the HTTP status so rejected and failed attempts are recorded alongside
+// successful ones.
+func (h *DestinationHandler) logAudit(r *http.Request, action string, req DestinationRequest, status int) {
+	h.logAuditOutcome(r, action, req, audit.OutcomeForStatus(status), status)
+}
+
+// logAuditOutcome writes an audit entry for a mutation attempt with an explicit outcome
+func (h *DestinationHandler) logAuditOutcome(r *http.Request, action string, req DestinationRequest, outcome string, status int) {
+	h.writeAudit(r.Context(), h.auditEntry(r, action, req, outcome, status))
+}
+
+// auditEntry describes a mutation attempt as an audit entry
+func (h *DestinationHandler) auditEntry(r *http.Request, action string, req DestinationRequest, outcome string, status int) audit.Entry {
+	actor, apiKey := middleware.Actor(r.Context())
+
+	return audit.Entry{
+		Action:          action,
+		Actor:           actor,
+		APIKey:          apiKey,
+		Project:         req.Project,
+		ArgoCDNamespace: h.client.Namespace(r.Context()),
+		Server:          req.Server,
+		Namespace:       req.Namespace,
+		Name:            req.Name,
+		Description:     req.Description,
+		TicketID:        req.TicketID,
+		Wildcard:        isWildcard(req),
+		ExpiresAt:       req.ExpiresAt,
+		Outcome:         outcome,
+		Status:          status,
+		RequestID:       chimiddleware.GetReqID(r.Context()),
+		UserAgent:       r.UserAgent(),
+		RemoteAddr:      r.RemoteAddr,
+	}
+}
+
+// writeAudit writes an audit entry, logging failures. It waits for the write
+// no longer than the request lasts; see audit.Logger.LogContext.
+func (h *DestinationHandler) writeAudit(ctx context.Context, entry audit.Entry) {
+	err := h.auditLogger.LogContext(ctx, entry)
+	switch {
+	case errors.Is(err, audit.ErrWritePending):
+		log.Printf("Request ended before its audit entry was written: %v", err)
+	case err != nil:
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// setETag sets the ETag header to the AppProject resourceVersion
+func setETag(w http.ResponseWriter, resourceVersion string) {
+	if resourceVersion != "" {
+		w.Header().Set("ETag", `"`+resourceVersion+`"`)
+	}
+}
+
+// ifMatchVersion returns the resourceVersion of a single strong ETag in an
+// If-Match header. A wildcard or a list of ETags doesn't name one version.
+func ifMatchVersion(header string) (string, bool) {
+	tag := strings.TrimSpace(header)
+	if len(tag) < 3 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || strings.Contains(tag, ",") {
+		return "", false
+	}
+	return tag[1 : len(tag)-1], true
+}
+
+// etagMatches reports whether an If-None-Match header value matches the ETag
+// of a resourceVersion. Weak validators compare equal to strong ones.
+func etagMatches(header, resourceVersion string) bool {
+	if header == "" || resourceVersion == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == `"`+resourceVersion+`"` {
+			return true
+		}
+	}
+	return false
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -265,8 +1017,54 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
+// writeJSONError writes an error response. Clients that prefer text/plain
+// over JSON in their Accept header get just the message as plain text.
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeError(w, r, status, ErrorResponse{Message: message})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, resp ErrorResponse) {
+	if prefersPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, resp.Message+"\n")
+		return
+	}
+
+	writeJSON(w, status, resp)
+}
+
+// prefersPlainText reports whether the Accept header lists text/plain before
+// any JSON media type. JSON stays the default.
+func prefersPlainText(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.TrimSpace(mediaType) {
+		case "text/plain":
+			return true
+		case "application/json", "application/*":
+			return false
+		}
+	}
+	return false
+}
+
+// writeValidationError writes a 422 response listing every invalid field. The
+// message summarizes all problems for clients that ignore the fields object.
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fields[name])
+	}
+
+	writeError(w, r, http.StatusUnprocessableEntity, ErrorResponse{
+		Message: strings.Join(messages, "; "),
+		Fields:  fields,
+	})
 }
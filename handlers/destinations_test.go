@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/middleware"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	testNamespace = "argocd"
+	testAPIKey    = "test-key"
+)
+
+var projectGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "appprojects"}
+
+// recordingSink keeps the audit entries it is sent
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (s *recordingSink) Send(entry audit.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+// Entries returns the entries sent so far
+func (s *recordingSink) Entries() []audit.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]audit.Entry(nil), s.entries...)
+}
+
+// WaitEntries returns the entries sent once there are n of them, failing
+// the test if they don't arrive
+func (s *recordingSink) WaitEntries(t *testing.T, n int) []audit.Entry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		entries := s.Entries()
+		if len(entries) >= n || time.Now().After(deadline) {
+			return entries
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testProject returns an AppProject with the given destinations
+func testProject(name string, destinations ...argocd.Destination) *unstructured.Unstructured {
+	raw := make([]interface{}, 0, len(destinations))
+	for _, dest := range destinations {
+		entry := map[string]interface{}{"server": dest.Server, "namespace": dest.Namespace}
+		if dest.Name != "" {
+			entry["name"] = dest.Name
+		}
+		raw = append(raw, entry)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "AppProject",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       testNamespace,
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{"destinations": raw},
+	}}
+}
+
+// testHandler is a handler backed by a fake dynamic client, recording its
+// audit entries
+type testHandler struct {
+	*DestinationHandler
+	dyn   *fake.FakeDynamicClient
+	audit *recordingSink
+}
+
+// newTestHandler creates a handler for the objects with the given options
+func newTestHandler(t *testing.T, options Options, clientOptions argocd.Options, objects ...runtime.Object) *testHandler {
+	t.Helper()
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		projectGVR:                           "AppProjectList",
+		{Version: "v1", Resource: "secrets"}: "SecretList",
+	}, objects...)
+
+	auditLogger, err := audit.NewLogger("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	auditLogger.AddSink(sink)
+
+	client := argocd.NewClientWithInterface(dyn, testNamespace, clientOptions)
+	return &testHandler{DestinationHandler: NewDestinationHandler(client, auditLogger, options), dyn: dyn, audit: sink}
+}
+
+// serve calls handler with an admin API key and returns the response
+func serve(t *testing.T, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveContext(t, context.Background(), handler, method, target, body)
+}
+
+// serveContext is serve for a request with the given context
+func serveContext(t *testing.T, ctx context.Context, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	keys := middleware.NewKeySet([]middleware.APIKey{{Name: "admin", Key: testAPIKey, Admin: true}})
+	req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("X-API-Key", testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	middleware.APIKeyAuth(keys)(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+// failPatches makes every AppProject patch fail with err
+func failPatches(dyn *fake.FakeDynamicClient, err error) {
+	dyn.PrependReactor("patch", "appprojects", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	})
+}
+
+// decodeError decodes a JSON error response
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error response %q: %v", rec.Body.String(), err)
+	}
+	return resp
+}
+
+const addBody = `{"project":"team-a","server":"https://prod.example.com","namespace":"team-a-app","description":"onboarding"}`
+
+func TestAddDestinationRetryBudgetExhausted(t *testing.T) {
+	h := newTestHandler(t, Options{}, argocd.Options{ConflictAttempts: 10, RetryBudget: 1}, testProject("team-a"))
+	failPatches(h.dyn, apierrors.NewConflict(projectGVR.GroupResource(), "team-a", errors.New("the object has been modified")))
+
+	rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	entries := h.audit.Entries()
+	if len(entries) != 1 || entries[0].Status != http.StatusServiceUnavailable || entries[0].Outcome != audit.OutcomeError {
+		t.Errorf("audit entries = %+v, want one error entry with status 503", entries)
+	}
+
+	projects, err := h.client.ListProjects(context.Background(), "", "")
+	if err != nil || len(projects) != 1 || projects[0].DestinationCount != 0 {
+		t.Errorf("projects = %+v (%v), want team-a unchanged", projects, err)
+	}
+}
+
+func TestAddDestinationDisconnectAfterPatch(t *testing.T) {
+	h := newTestHandler(t, Options{}, argocd.Options{ProjectCacheTTL: time.Minute}, testProject("team-a"))
+	if _, err := h.client.ListProjects(context.Background(), "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The patch is applied, but the client goes away and the API server's
+	// response is lost
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.dyn.PrependReactor("patch", "appprojects", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if _, _, err := k8stesting.ObjectReaction(h.dyn.Tracker())(action); err != nil {
+			return true, nil, err
+		}
+		cancel()
+		return true, nil, apierrors.NewTimeoutError("request did not complete", 1)
+	})
+
+	rec := serveContext(t, ctx, h.AddDestination, http.MethodPost, "/destinations", addBody)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500: %s", rec.Code, rec.Body)
+	}
+
+	// The attempt is audited although the request context ended
+	entries := h.audit.WaitEntries(t, 1)
+	if len(entries) != 1 || entries[0].Project != "team-a" || entries[0].Status != http.StatusInternalServerError {
+		t.Errorf("audit entries = %+v, want the failed attempt", entries)
+	}
+
+	// Reads after the failed patch see the change instead of the cached list
+	projects, err := h.client.ListProjects(context.Background(), "", "")
+	if err != nil || len(projects) != 1 || projects[0].DestinationCount != 1 {
+		t.Errorf("projects = %+v (%v), want team-a with the added destination", projects, err)
+	}
+
+	// A retry finds the destination and doesn't add it twice
+	rec = serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, want 200 for an existing destination: %s", rec.Code, rec.Body)
+	}
+	destinations, _, err := h.client.GetDestinations(context.Background(), "team-a")
+	if err != nil || len(destinations) != 1 {
+		t.Errorf("destinations = %v (%v), want the one added", destinations, err)
+	}
+}
+
+func TestAddDestinationThrottled(t *testing.T) {
+	tests := []struct {
+		name           string
+		retryAfter     int
+		wantRetryAfter string
+	}{
+		{"retry after from the API server", 5, "5"},
+		{"default retry after", 0, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{}, argocd.Options{}, testProject("team-a"))
+			failPatches(h.dyn, apierrors.NewTooManyRequests("too many requests, please try again later", tt.retryAfter))
+
+			rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want 503: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if resp := decodeError(t, rec); !strings.Contains(resp.Message, "throttling") {
+				t.Errorf("message = %q, want it to mention throttling", resp.Message)
+			}
+		})
+	}
+}
+
+func TestAddDestinationMirror(t *testing.T) {
+	const mirrorNamespace = "argocd-mirror"
+	mirrorProject := testProject("team-a")
+	mirrorProject.SetNamespace(mirrorNamespace)
+
+	tests := []struct {
+		name            string
+		objects         []runtime.Object
+		failMirror      bool
+		wantMirrored    int
+		wantMirrorAudit string
+		wantStatus      int
+	}{
+		{
+			name:            "replays the add",
+			objects:         []runtime.Object{testProject("team-a"), mirrorProject},
+			wantMirrored:    1,
+			wantMirrorAudit: audit.OutcomeSuccess,
+			wantStatus:      http.StatusCreated,
+		},
+		{
+			name:            "mirror patch fails",
+			objects:         []runtime.Object{testProject("team-a"), mirrorProject},
+			failMirror:      true,
+			wantMirrorAudit: audit.OutcomeError,
+			wantStatus:      http.StatusInternalServerError,
+		},
+		{
+			name:            "mirror project missing",
+			objects:         []runtime.Object{testProject("team-a")},
+			wantMirrorAudit: audit.OutcomeError,
+			wantStatus:      http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{MirrorNamespace: mirrorNamespace}, argocd.Options{}, tt.objects...)
+			if tt.failMirror {
+				h.dyn.PrependReactor("patch", "appprojects", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.GetNamespace() != mirrorNamespace {
+						return false, nil, nil
+					}
+					return true, nil, errors.New("mirror unavailable")
+				})
+			}
+
+			// The primary change succeeds whatever happens to the replay
+			rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+			}
+			destinations, _, err := h.client.GetDestinations(context.Background(), "team-a")
+			if err != nil || len(destinations) != 1 {
+				t.Errorf("primary destinations = %v (%v), want the added one", destinations, err)
+			}
+			if tt.wantMirrored > 0 {
+				mirrorCtx := argocd.WithNamespace(context.Background(), mirrorNamespace)
+				if destinations, _, err := h.client.GetDestinations(mirrorCtx, "team-a"); err != nil || len(destinations) != tt.wantMirrored {
+					t.Errorf("mirror destinations = %v (%v), want the added one", destinations, err)
+				}
+			}
+
+			entries := h.audit.Entries()
+			if len(entries) != 2 {
+				t.Fatalf("audit entries = %+v, want the change and its replay", entries)
+			}
+			if entries[0].Mirror || entries[0].Outcome != audit.OutcomeSuccess {
+				t.Errorf("primary audit entry = %+v, want a successful change", entries[0])
+			}
+			mirrored := entries[1]
+			if !mirrored.Mirror || mirrored.ArgoCDNamespace != mirrorNamespace || mirrored.Outcome != tt.wantMirrorAudit || mirrored.Status != tt.wantStatus {
+				t.Errorf("mirror audit entry = %+v, want outcome %s with status %d in %s", mirrored, tt.wantMirrorAudit, tt.wantStatus, mirrorNamespace)
+			}
+		})
+	}
+}
+
+func TestAddDestinationValidation(t *testing.T) {
+	allowTeams := NamespacePolicy{Allowed: []string{"team-*"}}
+	denyKube := NamespacePolicy{Allowed: []string{"*"}, Denied: []string{"kube-*"}}
+
+	tests := []struct {
+		name        string
+		options     Options
+		body        string
+		wantStatus  int
+		wantMessage string
+		wantFields  []string
+	}{
+		{
+			name:       "no policy allows every namespace",
+			body:       `{"project":"team-a","server":"https://prod.example.com","namespace":"kube-system","description":"d"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "allowed pattern",
+			options:    Options{NamespacePolicy: allowTeams},
+			body:       `{"project":"team-a","server":"https://prod.example.com","namespace":"team-a-app","description":"d"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:        "no allowed pattern matches",
+			options:     Options{NamespacePolicy: allowTeams},
+			body:        `{"project":"team-a","server":"https://prod.example.com","namespace":"payments","description":"d"}`,
+			wantStatus:  http.StatusForbidden,
+			wantMessage: "namespace payments does not match any allowed pattern (team-*)",
+		},
+		{
+			name:        "denied pattern takes precedence",
+			options:     Options{NamespacePolicy: denyKube},
+			body:        `{"project":"team-a","server":"https://prod.example.com","namespace":"kube-system","description":"d"}`,
+			wantStatus:  http.StatusForbidden,
+			wantMessage: `namespace kube-system is denied by pattern "kube-*"`,
+		},
+		{
+			name:       "allowed despite a deny list",
+			options:    Options{NamespacePolicy: denyKube},
+			body:       `{"project":"team-a","server":"https://prod.example.com","namespace":"team-a-app","description":"d"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "missing fields are reported together",
+			options:    Options{NamespacePolicy: denyKube},
+			body:       `{"project":"team-a"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"description", "namespace", "server"},
+		},
+		{
+			name:       "wildcards need an exemption",
+			body:       `{"project":"team-a","server":"*","namespace":"*","description":"d"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"namespace", "server"},
+		},
+		{
+			name:       "wildcard exemption",
+			options:    Options{WildcardProjects: map[string]bool{"team-a": true}},
+			body:       `{"project":"team-a","server":"*","namespace":"*","description":"d"}`,
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.options, argocd.Options{}, testProject("team-a"))
+
+			rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus < 300 {
+				return
+			}
+
+			resp := decodeError(t, rec)
+			if tt.wantMessage != "" && resp.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Message, tt.wantMessage)
+			}
+			if len(resp.Fields) != len(tt.wantFields) {
+				t.Errorf("fields = %v, want %v", resp.Fields, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if resp.Fields[field] == "" {
+					t.Errorf("fields = %v, want an error for %s", resp.Fields, field)
+				}
+			}
+			if entries := h.audit.Entries(); len(entries) != 1 || entries[0].Status != tt.wantStatus {
+				t.Errorf("audit entries = %+v, want the rejected attempt", entries)
+			}
+		})
+	}
+}
+
+func TestProjectNameError(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern *regexp.Regexp
+		project string
+		want    string
+	}{
+		{name: "valid", project: "team-a"},
+		{name: "63 characters", project: strings.Repeat("a", 63)},
+		{name: "64 characters", project: strings.Repeat("a", 64), want: "project name must be at most 63 characters, got 64"},
+		{name: "uppercase", project: "Team-A", want: `project name "Team-A" must be lowercase`},
+		{name: "leading dash", project: "-team", want: `project name "-team" must consist of lowercase alphanumeric characters or '-', and must start and end with an alphanumeric character`},
+		{name: "dot", project: "team.a", want: `project name "team.a" must consist of lowercase alphanumeric characters or '-', and must start and end with an alphanumeric character`},
+		{name: "empty", project: "", want: "project name is required"},
+		{name: "override allows uppercase", pattern: regexp.MustCompile(`^[A-Za-z-]+$`), project: "Team-A"},
+		{name: "override allows long names", pattern: regexp.MustCompile(`^a+$`), project: strings.Repeat("a", 64)},
+		{name: "override rejects", pattern: regexp.MustCompile(`^team-`), project: "payments", want: `project name "payments" must match ^team-`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{ProjectNamePattern: tt.pattern}, argocd.Options{})
+			if got := h.projectNameError(tt.project); got != tt.want {
+				t.Errorf("projectNameError(%q) = %q, want %q", tt.project, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDestinationInvalidProjectName(t *testing.T) {
+	h := newTestHandler(t, Options{}, argocd.Options{})
+	body := `{"project":"Team-A","server":"https://prod.example.com","namespace":"team-a-app","description":"d"}`
+
+	rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", body)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	if resp := decodeError(t, rec); resp.Fields["project"] != `project name "Team-A" must be lowercase` {
+		t.Errorf("fields = %v, want the project name rejected", resp.Fields)
+	}
+}
+
+func TestDestinationMutationNoops(t *testing.T) {
+	prod := argocd.Destination{Server: "https://prod.example.com", Namespace: "team-a-app"}
+	staging := argocd.Destination{Server: "https://staging.example.com", Namespace: "team-a-app"}
+
+	tests := []struct {
+		name        string
+		remove      bool
+		existing    []argocd.Destination
+		wantStatus  int
+		wantOutcome string
+		wantNoop    bool
+		wantPatch   bool
+		// repeat sends the request twice, checking the second response
+		repeat bool
+	}{
+		{name: "add new", existing: []argocd.Destination{staging}, wantStatus: http.StatusCreated, wantOutcome: audit.OutcomeSuccess, wantPatch: true},
+		// The first add also stores the description as the reason
+		{name: "add existing", existing: []argocd.Destination{staging}, repeat: true, wantStatus: http.StatusOK, wantOutcome: audit.OutcomeNoop},
+		{name: "remove existing", remove: true, existing: []argocd.Destination{prod}, wantStatus: http.StatusNoContent, wantOutcome: audit.OutcomeSuccess, wantPatch: true},
+		{name: "remove absent", remove: true, existing: []argocd.Destination{staging}, wantStatus: http.StatusOK, wantOutcome: audit.OutcomeNoop, wantNoop: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{}, argocd.Options{}, testProject("team-a", tt.existing...))
+			handler, method, action := h.AddDestination, http.MethodPost, "add"
+			if tt.remove {
+				handler, method, action = h.RemoveDestination, http.MethodDelete, "remove"
+			}
+			audited := 0
+			if tt.repeat {
+				serve(t, handler, method, "/destinations", addBody)
+				audited = len(h.audit.Entries())
+			}
+
+			patched := false
+			h.dyn.PrependReactor("patch", "appprojects", func(k8stesting.Action) (bool, runtime.Object, error) {
+				patched = true
+				return false, nil, nil
+			})
+			rec := serve(t, handler, method, "/destinations", addBody)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if patched != tt.wantPatch {
+				t.Errorf("patched = %t, want %t", patched, tt.wantPatch)
+			}
+			if tt.wantNoop {
+				var resp NoopResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || !resp.Noop {
+					t.Errorf("response = %+v (%v), want a noop", resp, err)
+				}
+			}
+
+			entries := h.audit.Entries()[audited:]
+			if len(entries) != 1 || entries[0].Action != action || entries[0].Outcome != tt.wantOutcome || entries[0].Status != tt.wantStatus {
+				t.Errorf("audit entries = %+v, want one %s entry with outcome %s and status %d", entries, action, tt.wantOutcome, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAddDestinationStoredInAnotherForm(t *testing.T) {
+	stored := argocd.Destination{Server: "https://prod.example.com", Namespace: "team-a-app", Name: "prod"}
+	h := newTestHandler(t, Options{}, argocd.Options{ResolveClusterNames: true}, testProject("team-a", stored))
+
+	rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp DestinationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := `the project already targets this cluster and namespace as server="https://prod.example.com" name="prod"; no duplicate was added`
+	if len(resp.Warnings) != 1 || resp.Warnings[0] != want {
+		t.Errorf("warnings = %q, want %q", resp.Warnings, want)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// DiffResponse lists the destinations a proposed set would add to and remove
+// from a project, relative to the project at ResourceVersion
+type DiffResponse struct {
+	Added           []argocd.Destination `json:"added"`
+	Removed         []argocd.Destination `json:"removed"`
+	ResourceVersion string               `json:"resourceVersion"`
+}
+
+// DiffDestinations handles POST /projects/{project}/destinations/diff. It
+// compares a proposed full destination set with the project's current
+// destinations without applying or auditing anything.
+func (h *DestinationHandler) DiffDestinations(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+
+	var req ValidateDestinationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	diff, resourceVersion, err := h.client.PlanDestinations(r.Context(), project, req.Destinations)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	resp := DiffResponse{
+		Added:           diff.Added,
+		Removed:         diff.Removed,
+		ResourceVersion: resourceVersion,
+	}
+	if resp.Added == nil {
+		resp.Added = []argocd.Destination{}
+	}
+	if resp.Removed == nil {
+		resp.Removed = []argocd.Destination{}
+	}
+
+	setETag(w, resourceVersion)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExpandDestinationsRequest represents a request to grant a project several
+// namespaces on one cluster
+type ExpandDestinationsRequest struct {
+	Server      string   `json:"server"`
+	Namespaces  []string `json:"namespaces"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description"`
+	TicketID    string   `json:"ticketId,omitempty"`
+}
+
+// ExpandDestinations handles POST /projects/{project}/destinations/expand. It
+// adds a destination for every namespace on the server as an atomic batch, so
+// validation, the single patch, the response and the audit entry per
+// namespace are those of POST /destinations/batch.
+func (h *DestinationHandler) ExpandDestinations(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	var req ExpandDestinationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "add", DestinationRequest{Project: project}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &req.Description)
+
+	if len(req.Namespaces) == 0 {
+		writeValidationError(w, r, map[string]string{"namespaces": "at least one namespace is required"})
+		h.logAudit(r, "add", DestinationRequest{Project: project, Server: req.Server, Description: req.Description, TicketID: req.TicketID}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	batch := BatchDestinationRequest{
+		Project:     project,
+		Description: req.Description,
+		TicketID:    req.TicketID,
+	}
+	for _, namespace := range req.Namespaces {
+		batch.Destinations = append(batch.Destinations, argocd.Destination{
+			Server:    req.Server,
+			Namespace: namespace,
+			Name:      req.Name,
+		})
+	}
+
+	h.addBatch(w, r, batch, BatchAtomic)
+}
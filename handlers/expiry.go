@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// expiryActor is the actor recorded on audit entries of expired destinations
+const expiryActor = "expiry-sweeper"
+
+// RunExpirySweeper removes expired destinations from the projects in the
+// given ArgoCD namespaces every interval until ctx is done
+func (h *DestinationHandler) RunExpirySweeper(ctx context.Context, interval time.Duration, namespaces []string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.SweepExpired(ctx, namespaces)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepExpired removes the destinations that have expired from the projects
+// in the given ArgoCD namespaces and writes an "expire" audit entry for each.
+// Removal uses the same conflict-checked patch as DELETE /destinations, so it
+// is safe alongside live mutations and other replicas sweeping. Failures are
+// logged and retried on the next sweep.
+func (h *DestinationHandler) SweepExpired(ctx context.Context, namespaces []string) {
+	now := time.Now()
+	for _, namespace := range namespaces {
+		nsCtx := argocd.WithNamespace(ctx, namespace)
+
+		projects, err := h.client.ProjectsWithExpiredDestinations(nsCtx, now)
+		if err != nil {
+			log.Printf("Expiry sweep failed to list projects in namespace %s: %v", namespace, err)
+			continue
+		}
+
+		for _, project := range projects {
+			removed, _, err := h.client.RemoveExpiredDestinations(nsCtx, project, now)
+			if err != nil {
+				log.Printf("Expiry sweep failed to remove expired destinations from project %s: %v", project, err)
+				continue
+			}
+
+			for _, dest := range removed {
+				log.Printf("Removed expired destination from project %s: server=%s namespace=%s name=%s expiresAt=%s",
+					project, dest.Server, dest.Namespace, dest.Name, dest.Metadata.ExpiresAt.Format(time.RFC3339))
+				h.writeAudit(ctx, audit.Entry{
+					Action:          "expire",
+					Actor:           expiryActor,
+					Project:         project,
+					ArgoCDNamespace: namespace,
+					Server:          dest.Server,
+					Namespace:       dest.Namespace,
+					Name:            dest.Name,
+					Description:     dest.Metadata.Reason,
+					ExpiresAt:       dest.Metadata.ExpiresAt,
+					Outcome:         audit.OutcomeSuccess,
+				})
+			}
+		}
+	}
+}
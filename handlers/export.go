@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// exportPageSize is how many projects are listed per API call while exporting
+const exportPageSize = 100
+
+// ExportDocument is the JSON export format of GET /projects/export. The NDJSON
+// format writes the projects one per line instead.
+type ExportDocument struct {
+	ArgoCDNamespace string           `json:"argocdNamespace"`
+	Projects        []argocd.Project `json:"projects"`
+}
+
+// ExportProjects handles GET /projects/export. It streams every project the
+// caller may access with its full destination list, as a JSON document by
+// default or as NDJSON with ?format=ndjson.
+func (h *DestinationHandler) ExportProjects(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "ndjson" {
+		writeJSONError(w, r, http.StatusBadRequest, "format must be json or ndjson")
+		return
+	}
+
+	// The export may take longer than the server's write timeout allows for
+	// ordinary responses
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to lift write deadline for export: %v", err)
+	}
+
+	namespace := h.client.Namespace(r.Context())
+	contentType := "application/json"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+
+	// Headers are written with the first project so that a failure to list
+	// the first page can still be reported with a proper status code.
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="projects-%s.%s"`, namespace, format))
+		w.WriteHeader(http.StatusOK)
+		if format == "json" {
+			prefix, _ := json.Marshal(namespace)
+			fmt.Fprintf(w, `{"argocdNamespace":%s,"projects":[`, prefix)
+		}
+	}
+
+	count := 0
+	err := h.client.ExportProjects(r.Context(), projectSelector(r.Context()), exportPageSize, func(project argocd.Project) error {
+		if !started {
+			start()
+		}
+
+		data, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
+		if format == "json" && count > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if format == "ndjson" {
+			data = append(data, '\n')
+		}
+		count++
+
+		_, err = w.Write(data)
+		return err
+	})
+
+	if err != nil {
+		if !started {
+			log.Printf("Failed to export projects: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "failed to export projects")
+			return
+		}
+		// The status has already been sent, so abort the response to keep
+		// clients from mistaking a truncated export for a complete one.
+		log.Printf("Export aborted after %d projects: %v", count, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		start()
+	}
+	if format == "json" {
+		w.Write([]byte("]}\n"))
+	}
+}
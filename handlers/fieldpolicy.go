@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// requirableFields are the destination fields a FieldRule may require
+var requirableFields = map[string]bool{
+	"server":    true,
+	"namespace": true,
+	"name":      true,
+}
+
+// FieldRule requires destination fields for the projects it matches. A rule
+// matches a project whose name matches one of Projects, if any are given, and
+// whose labels include all of Labels.
+type FieldRule struct {
+	// Projects are glob patterns matched against the project name
+	Projects []string          `json:"projects,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Required lists the destination fields new destinations must set
+	Required []string `json:"required"`
+}
+
+// FieldPolicy maps projects to the destination fields they require. The first
+// matching rule applies; projects no rule matches only need server and
+// namespace.
+type FieldPolicy struct {
+	Rules []FieldRule
+}
+
+// LoadFieldPolicy reads a JSON array of field rules from a file
+func LoadFieldPolicy(path string) (FieldPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FieldPolicy{}, fmt.Errorf("failed to read field policy file: %w", err)
+	}
+
+	var rules []FieldRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return FieldPolicy{}, fmt.Errorf("failed to parse field policy file: %w", err)
+	}
+
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return FieldPolicy{}, fmt.Errorf("field policy rule %d: %w", i, err)
+		}
+	}
+
+	return FieldPolicy{Rules: rules}, nil
+}
+
+// validate rejects rules that would match every project, malformed patterns
+// and unknown fields
+func (rule FieldRule) validate() error {
+	if len(rule.Projects) == 0 && len(rule.Labels) == 0 {
+		return fmt.Errorf("projects or labels are required")
+	}
+	for _, pattern := range rule.Projects {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid project pattern %q: %w", pattern, err)
+		}
+	}
+	for _, field := range rule.Required {
+		if !requirableFields[field] {
+			return fmt.Errorf("unknown field %q (must be server, namespace or name)", field)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a project
+func (rule FieldRule) matches(project string, projectLabels map[string]string) bool {
+	for key, value := range rule.Labels {
+		if v, ok := projectLabels[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	if len(rule.Projects) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Projects {
+		if ok, _ := path.Match(pattern, project); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Required returns the fields the first rule matching a project requires, or
+// nil if no rule matches
+func (p FieldPolicy) Required(project string, projectLabels map[string]string) []string {
+	for _, rule := range p.Rules {
+		if rule.matches(project, projectLabels) {
+			return rule.Required
+		}
+	}
+	return nil
+}
+
+// usesLabels reports whether any rule matches on project labels
+func (p FieldPolicy) usesLabels() bool {
+	for _, rule := range p.Rules {
+		if len(rule.Labels) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredFields returns the destination fields Options.FieldPolicy requires
+// for a project. Labels are only looked up if a rule needs them; projects
+// that don't exist yet are matched as having none.
+func (h *DestinationHandler) requiredFields(ctx context.Context, project string) ([]string, error) {
+	policy := h.options.Load().FieldPolicy
+	if !policy.usesLabels() {
+		return policy.Required(project, nil), nil
+	}
+
+	projectLabels, err := h.labels.get(ctx, project)
+	if err != nil && !errors.Is(err, argocd.ErrProjectNotFound) {
+		return nil, err
+	}
+	return policy.Required(project, projectLabels), nil
+}
+
+// missingFieldErrors returns an error keyed by JSON field name for each
+// required field the destination leaves empty
+func missingFieldErrors(project string, required []string, dest argocd.Destination) map[string]string {
+	values := map[string]string{
+		"server":    dest.Server,
+		"namespace": dest.Namespace,
+		"name":      dest.Name,
+	}
+
+	fields := make(map[string]string)
+	for _, field := range required {
+		if values[field] == "" {
+			fields[field] = fmt.Sprintf("%s is required for destinations of project %s", field, project)
+		}
+	}
+	return fields
+}
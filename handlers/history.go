@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// HistoryResponse represents the destination change history of a project
+type HistoryResponse struct {
+	Project string        `json:"project"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// ProjectHistory handles GET /projects/{project}/history
+func (h *DestinationHandler) ProjectHistory(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+
+	query := audit.Query{
+		Project:         project,
+		ArgoCDNamespace: h.client.Namespace(r.Context()),
+		SuccessOnly:     true,
+		Limit:           defaultHistoryLimit,
+	}
+
+	params := r.URL.Query()
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			writeJSONError(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	var err error
+	if v := params.Get("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := params.Get("until"); v != "" {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "until must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	entries, err := h.auditLogger.Query(query)
+	if errors.Is(err, audit.ErrNoLogFile) {
+		writeJSONError(w, r, http.StatusNotImplemented, "history requires the audit log file sink (AUDIT_SINK=file)")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to query audit log: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to read audit log")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HistoryResponse{Project: project, Entries: entries})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// importDescription is recorded as the description of audit entries for
+// changes made by an import
+const importDescription = "import from backup"
+
+// Per-project import statuses
+const (
+	ImportUnchanged = "unchanged"
+	ImportChanged   = "changed"
+	ImportMissing   = "missing"
+	ImportCreated   = "created"
+	ImportInvalid   = "invalid"
+	ImportDenied    = "denied"
+	ImportError     = "error"
+)
+
+// ImportResponse reports the outcome of an import for every project in the
+// document. With DryRun set nothing was changed and the diffs show what would be.
+type ImportResponse struct {
+	DryRun   bool                  `json:"dryRun"`
+	Projects []ProjectImportResult `json:"projects"`
+}
+
+// ProjectImportResult reports the destination changes for one imported project
+type ProjectImportResult struct {
+	Project string `json:"project"`
+	Status  string `json:"status"`
+	argocd.DestinationDiff
+	ResourceVersion string   `json:"resourceVersion,omitempty"`
+	Errors          []string `json:"errors,omitempty"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+// ImportProjects handles POST /projects/import. It reconciles the destinations
+// of every project in an export document, in the JSON or NDJSON format of
+// GET /projects/export. Nothing is changed unless the request sets
+// ?dryRun=false. The change ticket for the import is passed as ?ticketId=.
+// Projects missing from the cluster are reported, or created when
+// Options.CreateProjectsOnImport is set.
+func (h *DestinationHandler) ImportProjects(w http.ResponseWriter, r *http.Request) {
+	dryRun := true
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "dryRun must be a boolean")
+			return
+		}
+		dryRun = b
+	}
+
+	ticketID := r.URL.Query().Get("ticketId")
+	if msg := h.ticketError(ticketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		return
+	}
+
+	projects, err := decodeImport(r)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid import document: "+err.Error())
+		return
+	}
+
+	resp := ImportResponse{DryRun: dryRun, Projects: make([]ProjectImportResult, 0, len(projects))}
+	for _, project := range projects {
+		resp.Projects = append(resp.Projects, h.importProject(r, project, ticketID, dryRun))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decodeImport reads the projects of an export document from the request body
+func decodeImport(r *http.Request) ([]argocd.Project, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" {
+		var doc ExportDocument
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			return nil, err
+		}
+		return doc.Projects, nil
+	}
+
+	var projects []argocd.Project
+	decoder := json.NewDecoder(r.Body)
+	for {
+		var project argocd.Project
+		err := decoder.Decode(&project)
+		if err == io.EOF {
+			return projects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+}
+
+// importProject validates and reconciles a single project of an import
+func (h *DestinationHandler) importProject(r *http.Request, project argocd.Project, ticketID string, dryRun bool) ProjectImportResult {
+	ctx := r.Context()
+	result := ProjectImportResult{Project: project.Name}
+
+	if msg := h.projectNameError(project.Name); msg != "" {
+		result.Status = ImportInvalid
+		result.Errors = []string{msg}
+		return result
+	}
+
+	if msg := h.protectedError(project.Name); msg != "" {
+		result.Status = ImportDenied
+		result.Errors = []string{msg}
+		return result
+	}
+
+	required, err := h.requiredFields(ctx, project.Name)
+	if err != nil {
+		return importFailure(result, err)
+	}
+
+	if report := h.validateDestinationSet(project.Name, required, project.Destinations); !report.Valid {
+		result.Status = ImportInvalid
+		result.Errors = append(result.Errors, report.Errors...)
+		for _, dest := range report.Results {
+			for _, reason := range dest.Reasons {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %s", dest.Destination.Server, dest.Destination.Namespace, reason))
+			}
+		}
+		return result
+	}
+
+	for _, dest := range project.Destinations {
+		warning, refusal, err := h.namespaceCheck(ctx, dest)
+		switch {
+		case err != nil:
+			result.Status = ImportError
+			result.Errors = []string{namespaceLookupFailed}
+			return result
+		case refusal != "":
+			result.Status = ImportInvalid
+			result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %s", dest.Server, dest.Namespace, refusal))
+		case warning != "":
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+	if result.Status == ImportInvalid {
+		return result
+	}
+
+	allowed, err := h.projectAccess(ctx, project.Name)
+	switch {
+	case errors.Is(err, argocd.ErrProjectNotFound):
+		missing := h.importMissingProject(r, project, ticketID, dryRun)
+		missing.Warnings = result.Warnings
+		return missing
+	case err != nil:
+		return importFailure(result, err)
+	case !allowed:
+		result.Status = ImportDenied
+		result.Errors = []string{"access denied to project: " + project.Name}
+		return result
+	}
+
+	if dryRun {
+		diff, resourceVersion, err := h.client.PlanDestinations(ctx, project.Name, project.Destinations)
+		if err != nil {
+			return importFailure(result, err)
+		}
+		result.DestinationDiff = diff
+		result.ResourceVersion = resourceVersion
+		result.Status = ImportChanged
+		if diff.Empty() {
+			result.Status = ImportUnchanged
+		}
+		return result
+	}
+
+	diff, applied, err := h.client.SetDestinations(ctx, project.Name, project.Destinations)
+	if err != nil {
+		return importFailure(result, err)
+	}
+	result.DestinationDiff = diff
+	result.ResourceVersion = applied.ResourceVersion
+	result.Status = ImportUnchanged
+	if applied.Changed {
+		result.Status = ImportChanged
+		h.logImportChanges(r, project.Name, ticketID, diff)
+		h.mirrorImport(r, project.Name, ticketID, diff)
+		log.Printf("Imported destinations of project %s: added=%d removed=%d resourceVersion=%s",
+			project.Name, len(diff.Added), len(diff.Removed), applied.ResourceVersion)
+	}
+	return result
+}
+
+// importMissingProject reports a project that doesn't exist in the cluster,
+// creating it if project creation on import is enabled
+func (h *DestinationHandler) importMissingProject(r *http.Request, project argocd.Project, ticketID string, dryRun bool) ProjectImportResult {
+	result := ProjectImportResult{
+		Project:         project.Name,
+		Status:          ImportMissing,
+		DestinationDiff: argocd.DestinationDiff{Added: project.Destinations},
+	}
+	if !h.options.Load().CreateProjectsOnImport {
+		result.Errors = []string{"project does not exist and project creation on import is disabled"}
+		return result
+	}
+	if dryRun {
+		return result
+	}
+
+	resourceVersion, err := h.client.CreateProject(r.Context(), project.Name, projectOwnerLabels(r.Context()), project.Destinations)
+	if err != nil {
+		return importFailure(result, err)
+	}
+
+	result.Status = ImportCreated
+	result.ResourceVersion = resourceVersion
+	h.logImportChanges(r, project.Name, ticketID, result.DestinationDiff)
+	h.mirrorImport(r, project.Name, ticketID, result.DestinationDiff)
+	log.Printf("Created project %s from import with %d destinations resourceVersion=%s",
+		project.Name, len(project.Destinations), resourceVersion)
+	return result
+}
+
+// logImportChanges writes an audit entry for every destination an import added or removed
+func (h *DestinationHandler) logImportChanges(r *http.Request, project, ticketID string, diff argocd.DestinationDiff) {
+	for _, dest := range diff.Added {
+		h.logAuditOutcome(r, "add", importRequest(project, ticketID, dest), audit.OutcomeSuccess, http.StatusOK)
+	}
+	for _, dest := range diff.Removed {
+		h.logAuditOutcome(r, "remove", importRequest(project, ticketID, dest), audit.OutcomeSuccess, http.StatusOK)
+	}
+}
+
+// importRequest describes a destination changed by an import for the audit log
+func importRequest(project, ticketID string, dest argocd.Destination) DestinationRequest {
+	return DestinationRequest{
+		Project:     project,
+		Server:      dest.Server,
+		Namespace:   dest.Namespace,
+		Name:        dest.Name,
+		Description: importDescription,
+		TicketID:    ticketID,
+	}
+}
+
+// importFailure marks result as failed with err, reporting only errors that
+// are safe to show to clients
+func importFailure(result ProjectImportResult, err error) ProjectImportResult {
+	log.Printf("Failed to import project %s: %v", result.Project, err)
+
+	msg := "internal server error"
+	var limitErr *argocd.DestinationLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		msg = limitErr.Error()
+	case errors.Is(err, argocd.ErrForbidden):
+		msg = "access denied to project: " + result.Project
+	case errors.Is(err, argocd.ErrRetryBudgetExhausted):
+		msg = "too many conflicting changes, please retry later"
+	case errors.Is(err, argocd.ErrConflict):
+		msg = "resource was modified, please retry"
+	case errors.Is(err, argocd.ErrThrottled):
+		msg = "kubernetes API is throttling requests, please retry later"
+	case errors.Is(err, argocd.ErrProjectBusy):
+		msg = "project is busy with other changes, please retry"
+	}
+
+	result.Status = ImportError
+	result.DestinationDiff = argocd.DestinationDiff{}
+	result.Errors = []string{msg}
+	return result
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+func TestImportProjectsMirror(t *testing.T) {
+	const mirrorNamespace = "argocd-mirror"
+	kept := argocd.Destination{Server: "https://prod.example.com", Namespace: "team-a-app"}
+	dropped := argocd.Destination{Server: "https://prod.example.com", Namespace: "team-a-old"}
+	added := argocd.Destination{Server: "https://prod.example.com", Namespace: "team-a-new"}
+
+	mirrorProject := testProject("team-a", kept, dropped)
+	mirrorProject.SetNamespace(mirrorNamespace)
+	h := newTestHandler(t, Options{MirrorNamespace: mirrorNamespace}, argocd.Options{}, testProject("team-a", kept, dropped), mirrorProject)
+
+	body := `{"projects":[{"name":"team-a","destinations":[` +
+		`{"server":"https://prod.example.com","namespace":"team-a-app"},` +
+		`{"server":"https://prod.example.com","namespace":"team-a-new"}]}]}`
+	if rec := serve(t, h.ImportProjects, http.MethodPost, "/projects/import?dryRun=false", body); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	want := []argocd.Destination{kept, added}
+	mirrorCtx := argocd.WithNamespace(context.Background(), mirrorNamespace)
+	if got, _, err := h.client.GetDestinations(mirrorCtx, "team-a"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("mirror destinations = %v (%v), want %v", got, err, want)
+	}
+
+	var mirrored []string
+	for _, entry := range h.audit.Entries() {
+		if entry.Mirror {
+			mirrored = append(mirrored, entry.Action+" "+entry.Namespace+" "+entry.Outcome)
+		}
+	}
+	if want := []string{"add team-a-new success", "remove team-a-old success"}; !reflect.DeepEqual(mirrored, want) {
+		t.Errorf("mirror audit entries = %v, want %v", mirrored, want)
+	}
+}
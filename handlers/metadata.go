@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// DestinationMetadataResponse represents a destination and its metadata after
+// an update together with the AppProject's resulting resourceVersion
+type DestinationMetadataResponse struct {
+	argocd.DestinationDetails
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// SetDestinationMetadata handles PUT /destinations/metadata. The request's
+// owner, reason and expiresAt replace the stored metadata; all empty removes it.
+func (h *DestinationHandler) SetDestinationMetadata(w http.ResponseWriter, r *http.Request) {
+	var req DestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "metadata", req, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &req.Description)
+
+	if status, ok := h.validateDestinationRequest(w, r, "metadata", req); !ok {
+		h.logAudit(r, "metadata", req, status)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, req.Project); !ok {
+		h.logAudit(r, "metadata", req, status)
+		return
+	}
+
+	dest := argocd.Destination{
+		Server:    req.Server,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+	}
+	meta := req.metadata()
+
+	result, err := h.client.SetDestinationMetadata(r.Context(), req.Project, dest, meta)
+	if errors.Is(err, argocd.ErrDestinationNotFound) {
+		writeJSONError(w, r, http.StatusNotFound, "destination not found in project: "+req.Project)
+		h.logAudit(r, "metadata", req, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logAudit(r, "metadata", req, h.handleK8sError(w, r, err, req.Project))
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+	resp := DestinationMetadataResponse{
+		DestinationDetails: argocd.DestinationDetails{Destination: dest},
+		ResourceVersion:    result.ResourceVersion,
+	}
+	if !meta.IsZero() {
+		resp.Metadata = &meta
+	}
+
+	if !result.Changed {
+		h.logAuditOutcome(r, "metadata", req, audit.OutcomeNoop, http.StatusOK)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	h.logAudit(r, "metadata", req, http.StatusOK)
+
+	log.Printf("Set destination metadata in project %s: server=%s namespace=%s name=%s owner=%q reason=%q resourceVersion=%s",
+		req.Project, dest.Server, dest.Namespace, dest.Name, meta.Owner, meta.Reason, result.ResourceVersion)
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// mirrorTimeout bounds how long a request waits for its change to be
+// replayed in the mirror namespace
+const mirrorTimeout = 10 * time.Second
+
+// mirror replays successful adds or removals in Options.MirrorNamespace, e.g.
+// while migrating between two ArgoCD instances. It is best effort: failures
+// are logged, counted and audited, but never fail the request, whose change
+// has already been made. Each replay gets its own audit entry marked as a
+// mirror. Changes to the mirror namespace itself aren't replayed.
+func (h *DestinationHandler) mirror(r *http.Request, action string, reqs ...DestinationRequest) {
+	h.replay(r.Context(), action, reqs, func(req DestinationRequest, outcome string, status int) audit.Entry {
+		return h.auditEntry(r, action, req, outcome, status)
+	})
+}
+
+// Mirror replays a change made outside the HTTP server, such as by the add
+// and remove commands, like mirror does for requests. entry is the audit
+// entry of the change, which the replay's entry is based on.
+func (h *DestinationHandler) Mirror(ctx context.Context, action string, req DestinationRequest, entry audit.Entry) {
+	h.replay(ctx, action, []DestinationRequest{req}, func(_ DestinationRequest, outcome string, status int) audit.Entry {
+		replayed := entry
+		replayed.Action, replayed.Outcome, replayed.Status = action, outcome, status
+		return replayed
+	})
+}
+
+// replay replays changes in Options.MirrorNamespace, auditing each with the
+// entry auditEntry returns for it
+func (h *DestinationHandler) replay(ctx context.Context, action string, reqs []DestinationRequest, auditEntry func(req DestinationRequest, outcome string, status int) audit.Entry) {
+	namespace := h.options.Load().MirrorNamespace
+	if namespace == "" || namespace == h.client.Namespace(ctx) {
+		return
+	}
+
+	// The replay must finish even if the client went away after the change
+	ctx, cancel := context.WithTimeout(argocd.WithNamespace(context.WithoutCancel(ctx), namespace), mirrorTimeout)
+	defer cancel()
+
+	for _, req := range reqs {
+		dest := argocd.Destination{Server: req.Server, Namespace: req.Namespace, Name: req.Name}
+
+		var result argocd.Result
+		var err error
+		switch action {
+		case "add":
+			result, err = h.client.AddDestinationWithMetadata(ctx, req.Project, dest, req.addMetadata())
+		case "remove":
+			result, err = h.client.RemoveDestination(ctx, req.Project, dest)
+		default:
+			return
+		}
+
+		outcome, status := audit.OutcomeSuccess, http.StatusOK
+		switch {
+		case err != nil:
+			outcome, status = audit.OutcomeError, mirrorErrorStatus(err)
+			log.Printf("Failed to mirror %s of destination to project %s in namespace %s: server=%s namespace=%s name=%s: %v",
+				action, req.Project, namespace, dest.Server, dest.Namespace, dest.Name, err)
+		case !result.Changed:
+			outcome = audit.OutcomeNoop
+		case action == "add":
+			status = http.StatusCreated
+		}
+		metrics.MirroredChanges.WithLabelValues(action, outcome).Inc()
+
+		entry := auditEntry(req, outcome, status)
+		entry.ArgoCDNamespace = namespace
+		entry.Mirror = true
+		h.writeAudit(ctx, entry)
+	}
+}
+
+// mirrorImport replays the destinations an import added and removed
+func (h *DestinationHandler) mirrorImport(r *http.Request, project, ticketID string, diff argocd.DestinationDiff) {
+	added := make([]DestinationRequest, 0, len(diff.Added))
+	for _, dest := range diff.Added {
+		added = append(added, importRequest(project, ticketID, dest))
+	}
+	h.mirror(r, "add", added...)
+
+	removed := make([]DestinationRequest, 0, len(diff.Removed))
+	for _, dest := range diff.Removed {
+		removed = append(removed, importRequest(project, ticketID, dest))
+	}
+	h.mirror(r, "remove", removed...)
+}
+
+// mirrorRemoved replays the removal of destinations matched by a request
+func (h *DestinationHandler) mirrorRemoved(r *http.Request, req DestinationRequest, removed []argocd.Destination) {
+	reqs := make([]DestinationRequest, 0, len(removed))
+	for _, dest := range removed {
+		reqs = append(reqs, withDestination(req, dest))
+	}
+	h.mirror(r, "remove", reqs...)
+}
+
+// mirrorErrorStatus is the status a failed replay is audited with, as if the
+// change had been requested of the mirror namespace directly
+func mirrorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, argocd.ErrProjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, argocd.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, argocd.ErrConflict):
+		return http.StatusConflict
+	default:
+		var limitErr *argocd.DestinationLimitError
+		if errors.As(err, &limitErr) {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// NamespaceCheckMode selects what an add does when the in-cluster namespace
+// of its destination doesn't exist
+type NamespaceCheckMode string
+
+// Namespace check modes. The zero value disables the check.
+const (
+	// NamespaceCheckWarn adds the destination with a warning
+	NamespaceCheckWarn NamespaceCheckMode = "warn"
+	// NamespaceCheckBlock refuses the add with 422
+	NamespaceCheckBlock NamespaceCheckMode = "block"
+)
+
+// ParseNamespaceCheckMode parses "off", "warn" or "block"; "off" and the
+// empty string disable the check
+func ParseNamespaceCheckMode(value string) (NamespaceCheckMode, error) {
+	switch mode := NamespaceCheckMode(value); mode {
+	case "", "off":
+		return "", nil
+	case NamespaceCheckWarn, NamespaceCheckBlock:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("must be off, warn or block, got %q", value)
+	}
+}
+
+// namespaceLookupFailed is the message of an add refused because the
+// namespace lookup failed in block mode
+const namespaceLookupFailed = "failed to check the namespace exists in the cluster"
+
+// namespaceCheck applies Options.NamespaceCheck to a destination being added.
+// Only the in-cluster server is checked, since other clusters would need their
+// own credentials, and namespace patterns aren't checked at all. It returns a
+// warning for the add, or a message refusing it with 422. In block mode a
+// failed lookup is returned as an error refusing the add; in warn mode it is
+// only logged.
+func (h *DestinationHandler) namespaceCheck(ctx context.Context, dest argocd.Destination) (warning, refusal string, err error) {
+	mode := h.options.Load().NamespaceCheck
+	if mode == "" || !argocd.IsInCluster(dest) || strings.ContainsAny(dest.Namespace, "*?[!") {
+		return "", "", nil
+	}
+
+	exists, err := h.client.NamespaceExists(ctx, dest.Namespace)
+	if err != nil {
+		log.Printf("Failed to check namespace %s exists: %v", dest.Namespace, err)
+		if mode == NamespaceCheckBlock {
+			return "", "", err
+		}
+		return "", "", nil
+	}
+	if exists {
+		return "", "", nil
+	}
+
+	msg := fmt.Sprintf("namespace %s doesn't exist in the cluster; Applications can't sync to it until it is created", dest.Namespace)
+	if mode == NamespaceCheckBlock {
+		return "", msg, nil
+	}
+	return msg, "", nil
+}
+
+// checkNamespaceExists applies namespaceCheck to the destination of a single
+// add. It returns a warning for the add response, or writes the refusal and
+// returns false with its status.
+func (h *DestinationHandler) checkNamespaceExists(w http.ResponseWriter, r *http.Request, dest argocd.Destination) (string, int, bool) {
+	warning, refusal, err := h.namespaceCheck(r.Context(), dest)
+	switch {
+	case err != nil:
+		writeJSONError(w, r, http.StatusInternalServerError, namespaceLookupFailed)
+		return "", http.StatusInternalServerError, false
+	case refusal != "":
+		writeValidationError(w, r, map[string]string{"namespace": refusal})
+		return "", http.StatusUnprocessableEntity, false
+	}
+	return warning, 0, true
+}
+
+// CheckNamespace applies the namespace check of adds to dest for callers
+// outside the HTTP server. It returns a warning, or validation errors
+// refusing the add.
+func (h *DestinationHandler) CheckNamespace(ctx context.Context, dest argocd.Destination) (string, map[string]string) {
+	warning, refusal, err := h.namespaceCheck(ctx, dest)
+	switch {
+	case err != nil:
+		return "", map[string]string{"namespace": fmt.Sprintf("%s: %v", namespaceLookupFailed, err)}
+	case refusal != "":
+		return "", map[string]string{"namespace": refusal}
+	}
+	return warning, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testNamespaceObject returns a namespace of the cluster the service runs in
+func testNamespaceObject(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": name},
+	}}
+}
+
+func TestAddDestinationsNamespaceCheck(t *testing.T) {
+	const body = `{"project":"team-a","description":"onboarding","destinations":[` +
+		`{"server":"https://kubernetes.default.svc","namespace":"apps"},` +
+		`{"server":"https://kubernetes.default.svc","namespace":"missing"},` +
+		`{"server":"https://prod.example.com","namespace":"missing"}]}`
+
+	storedCount := func(t *testing.T, h *testHandler) int {
+		t.Helper()
+		destinations, _, err := h.client.GetDestinations(context.Background(), "team-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(destinations)
+	}
+	decodeBatch := func(t *testing.T, body []byte) BatchResponse {
+		t.Helper()
+		var resp BatchResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("atomic batch is refused", func(t *testing.T) {
+		h := newTestHandler(t, Options{NamespaceCheck: NamespaceCheckBlock}, argocd.Options{}, testProject("team-a"), testNamespaceObject("apps"))
+
+		rec := serve(t, h.AddDestinations, http.MethodPost, "/destinations/batch", body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+		}
+		if resp := decodeError(t, rec); resp.Fields["destinations[1].namespace"] == "" {
+			t.Errorf("fields = %v, want destinations[1].namespace", resp.Fields)
+		}
+		if got := storedCount(t, h); got != 0 {
+			t.Errorf("stored %d destinations, want none", got)
+		}
+	})
+
+	t.Run("best-effort batch refuses the entry", func(t *testing.T) {
+		h := newTestHandler(t, Options{NamespaceCheck: NamespaceCheckBlock}, argocd.Options{}, testProject("team-a"), testNamespaceObject("apps"))
+
+		rec := serve(t, h.AddDestinations, http.MethodPost, "/destinations/batch?mode=best-effort", body)
+		if rec.Code != http.StatusMultiStatus {
+			t.Fatalf("status = %d, want 207: %s", rec.Code, rec.Body)
+		}
+		resp := decodeBatch(t, rec.Body.Bytes())
+		want := []int{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusCreated}
+		for i, result := range resp.Results {
+			if result.Status != want[i] {
+				t.Errorf("results[%d] = %d %q, want %d", i, result.Status, result.Message, want[i])
+			}
+		}
+		if got := storedCount(t, h); got != 2 {
+			t.Errorf("stored %d destinations, want the 2 accepted", got)
+		}
+	})
+
+	t.Run("warn mode adds with a warning", func(t *testing.T) {
+		h := newTestHandler(t, Options{NamespaceCheck: NamespaceCheckWarn}, argocd.Options{}, testProject("team-a"), testNamespaceObject("apps"))
+
+		rec := serve(t, h.AddDestinations, http.MethodPost, "/destinations/batch", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+		}
+		resp := decodeBatch(t, rec.Body.Bytes())
+		for i, result := range resp.Results {
+			if wantWarning := i == 1; (len(result.Warnings) > 0) != wantWarning {
+				t.Errorf("results[%d] warnings = %v, want a warning only for the missing in-cluster namespace", i, result.Warnings)
+			}
+		}
+		if got := storedCount(t, h); got != 3 {
+			t.Errorf("stored %d destinations, want 3", got)
+		}
+	})
+}
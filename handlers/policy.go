@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// NamespacePolicy restricts which namespaces destinations may target using
+// glob patterns. Denied patterns take precedence over allowed patterns, and
+// an empty allow list allows every namespace that isn't denied.
+type NamespacePolicy struct {
+	Allowed []string `json:"allowed,omitempty"`
+	Denied  []string `json:"denied,omitempty"`
+}
+
+// NewNamespacePolicy creates a namespace policy, rejecting malformed patterns
+func NewNamespacePolicy(allowed, denied []string) (NamespacePolicy, error) {
+	for _, pattern := range append(append([]string{}, allowed...), denied...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return NamespacePolicy{}, fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+		}
+	}
+	return NamespacePolicy{Allowed: allowed, Denied: denied}, nil
+}
+
+// LoadNamespacePolicy reads a namespace policy from a JSON file of the form
+// {"allowed": [...], "denied": [...]}
+func LoadNamespacePolicy(path string) (NamespacePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NamespacePolicy{}, fmt.Errorf("failed to read namespace policy file: %w", err)
+	}
+
+	var policy NamespacePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return NamespacePolicy{}, fmt.Errorf("failed to parse namespace policy file: %w", err)
+	}
+	return NewNamespacePolicy(policy.Allowed, policy.Denied)
+}
+
+// Check returns a message naming the rule the namespace violates, or an empty
+// string if the namespace is allowed
+func (p NamespacePolicy) Check(namespace string) string {
+	for _, pattern := range p.Denied {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return fmt.Sprintf("namespace %s is denied by pattern %q", namespace, pattern)
+		}
+	}
+
+	if len(p.Allowed) == 0 {
+		return ""
+	}
+	for _, pattern := range p.Allowed {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("namespace %s does not match any allowed pattern (%s)", namespace, strings.Join(p.Allowed, ", "))
+}
+
+// projectPlaceholder is replaced by the project name in a NamespaceConvention
+// template
+const projectPlaceholder = "{project}"
+
+// NamespaceConvention requires the namespaces of a project's destinations to
+// match a glob pattern derived from the project name, such as "{project}-*".
+// Namespaces matching an exception pattern, e.g. shared namespaces, are exempt.
+// The zero value enforces nothing.
+type NamespaceConvention struct {
+	Template   string
+	Exceptions []string
+}
+
+// NewNamespaceConvention creates a namespace convention, rejecting malformed
+// patterns
+func NewNamespaceConvention(template string, exceptions []string) (NamespaceConvention, error) {
+	if template == "" {
+		return NamespaceConvention{}, fmt.Errorf("namespace template is empty")
+	}
+	if _, err := path.Match(strings.ReplaceAll(template, projectPlaceholder, "project"), ""); err != nil {
+		return NamespaceConvention{}, fmt.Errorf("invalid namespace template %q: %w", template, err)
+	}
+	for _, pattern := range exceptions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return NamespaceConvention{}, fmt.Errorf("invalid namespace exception pattern %q: %w", pattern, err)
+		}
+	}
+	return NamespaceConvention{Template: template, Exceptions: exceptions}, nil
+}
+
+// Check returns a message explaining why the project may not target the
+// namespace, or an empty string if it may. Project names can't contain glob
+// metacharacters, so they are substituted into the template as is.
+func (c NamespaceConvention) Check(project, namespace string) string {
+	if c.Template == "" {
+		return ""
+	}
+
+	for _, pattern := range c.Exceptions {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return ""
+		}
+	}
+
+	pattern := strings.ReplaceAll(c.Template, projectPlaceholder, project)
+	if ok, _ := path.Match(pattern, namespace); ok {
+		return ""
+	}
+	return fmt.Sprintf("namespace %s does not match %q required for project %s", namespace, pattern, project)
+}
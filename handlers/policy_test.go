@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+func TestNamespaceConventionCheck(t *testing.T) {
+	convention, err := NewNamespaceConvention("{project}-*", []string{"shared-*", "monitoring"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		project   string
+		namespace string
+		want      string
+	}{
+		{name: "matches", project: "team-a", namespace: "team-a-app"},
+		{name: "matches another suffix", project: "team-a", namespace: "team-a-staging"},
+		{name: "other project's namespace", project: "team-a", namespace: "team-b-app", want: `namespace team-b-app does not match "team-a-*" required for project team-a`},
+		{name: "prefix of the project", project: "team-a", namespace: "team-app", want: `namespace team-app does not match "team-a-*" required for project team-a`},
+		{name: "project name alone", project: "team-a", namespace: "team-a", want: `namespace team-a does not match "team-a-*" required for project team-a`},
+		{name: "exception pattern", project: "team-a", namespace: "shared-ingress"},
+		{name: "exact exception", project: "team-a", namespace: "monitoring"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convention.Check(tt.project, tt.namespace); got != tt.want {
+				t.Errorf("Check(%q, %q) = %q, want %q", tt.project, tt.namespace, got, tt.want)
+			}
+		})
+	}
+
+	if got := (NamespaceConvention{}).Check("team-a", "anything"); got != "" {
+		t.Errorf("zero convention Check() = %q, want no restriction", got)
+	}
+}
+
+func TestNewNamespaceConventionInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		template   string
+		exceptions []string
+	}{
+		{template: ""},
+		{template: "{project}-["},
+		{template: "{project}-*", exceptions: []string{"["}},
+	} {
+		if _, err := NewNamespaceConvention(tt.template, tt.exceptions); err == nil {
+			t.Errorf("NewNamespaceConvention(%q, %q) succeeded", tt.template, tt.exceptions)
+		}
+	}
+}
+
+func TestAddDestinationNamespaceConvention(t *testing.T) {
+	convention, err := NewNamespaceConvention("{project}-*", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Options{NamespaceConvention: convention}, argocd.Options{}, testProject("team-a"))
+
+	body := `{"project":"team-a","server":"https://prod.example.com","namespace":"team-b-app","description":"d"}`
+	rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", body)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	if resp := decodeError(t, rec); resp.Message != `namespace team-b-app does not match "team-a-*" required for project team-a` {
+		t.Errorf("message = %q, want the convention named", resp.Message)
+	}
+
+	if rec := serve(t, h.AddDestination, http.MethodPost, "/destinations", addBody); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 for a conforming namespace: %s", rec.Code, rec.Body)
+	}
+}
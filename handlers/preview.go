@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/middleware"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PatchPreviewResponse represents the patch an add or remove would send to
+// Kubernetes. Patch is empty when the change would be a no-op.
+type PatchPreviewResponse struct {
+	Action          string          `json:"action"`
+	Project         string          `json:"project"`
+	Changed         bool            `json:"changed"`
+	PatchType       types.PatchType `json:"patchType,omitempty"`
+	Patch           json.RawMessage `json:"patch,omitempty"`
+	ResourceVersion string          `json:"resourceVersion"`
+}
+
+// PreviewPatch handles POST /debug/patch-preview?action=add|remove. It runs
+// the add or remove of the destination in the body up to the point of
+// patching and returns the patch type, body and base resourceVersion that
+// would be sent, without sending them. Only admin keys may use it, since the
+// patch shows annotations of the project verbatim.
+func (h *DestinationHandler) PreviewPatch(w http.ResponseWriter, r *http.Request) {
+	if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+		writeJSONError(w, r, http.StatusForbidden, "patch preview requires an admin API key")
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	if action != "add" && action != "remove" {
+		writeJSONError(w, r, http.StatusBadRequest, "action must be add or remove")
+		return
+	}
+
+	var req DestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	h.defaultDescription(r, &req.Description)
+
+	if _, ok := h.validateDestinationRequest(w, r, action, req); !ok {
+		return
+	}
+
+	ctx, preview := argocd.WithPatchPreview(r.Context())
+	dest := argocd.Destination{Server: req.Server, Namespace: req.Namespace, Name: req.Name}
+
+	var result argocd.Result
+	var err error
+	if action == "add" {
+		result, err = h.client.AddDestinationWithMetadata(ctx, req.Project, dest, req.addMetadata())
+	} else {
+		result, err = h.client.RemoveDestination(ctx, req.Project, dest)
+	}
+	if err != nil {
+		var limitErr *argocd.DestinationLimitError
+		if errors.As(err, &limitErr) {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, limitErr.Error())
+			return
+		}
+		h.handleK8sError(w, r, err, req.Project)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PatchPreviewResponse{
+		Action:          action,
+		Project:         req.Project,
+		Changed:         result.Changed,
+		PatchType:       preview.PatchType,
+		Patch:           preview.Patch,
+		ResourceVersion: result.ResourceVersion,
+	})
+}
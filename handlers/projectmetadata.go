@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// managedAnnotationPrefix prefixes the annotations this API maintains itself,
+// such as DestinationMetadataAnnotation
+const managedAnnotationPrefix = "argocd-destination-api/"
+
+// ProjectMetadataRequest represents a request to update a project's
+// description, labels and annotations. Fields left out are not changed;
+// labels and annotations set to null are removed, as is an empty
+// projectDescription. Description explains the change.
+type ProjectMetadataRequest struct {
+	ProjectDescription *string            `json:"projectDescription"`
+	Labels             map[string]*string `json:"labels"`
+	Annotations        map[string]*string `json:"annotations"`
+	Description        string             `json:"description"`
+	TicketID           string             `json:"ticketId,omitempty"`
+}
+
+// UpdateProjectMetadata handles PATCH /projects/{project}/metadata
+func (h *DestinationHandler) UpdateProjectMetadata(w http.ResponseWriter, r *http.Request) {
+	change := specChange{action: "update_project_metadata", project: chi.URLParam(r, "project")}
+
+	var body ProjectMetadataRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.item, change.description, change.ticketID = projectMetadataItem(body), body.Description, body.TicketID
+
+	fields := projectMetadataErrors(body)
+	// The owner label decides which scoped keys may access the project
+	if _, ok := body.Labels[ownerLabel]; ok {
+		if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+			fields["labels."+ownerLabel] = "only admin API keys may change the " + ownerLabel + " label"
+		}
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	result, err := h.client.UpdateProjectMetadata(r.Context(), change.project, argocd.ProjectMetadataUpdate{
+		Description: body.ProjectDescription,
+		Labels:      body.Labels,
+		Annotations: body.Annotations,
+	})
+	if err == nil && result.Changed {
+		h.labels.forget(r.Context(), change.project)
+	}
+	h.finishSpecChange(w, r, change, result, err, http.StatusOK, "project metadata already matches, nothing changed")
+}
+
+// projectMetadataErrors validates the labels and annotations of a project
+// metadata update the way Kubernetes does, returning the errors by field
+func projectMetadataErrors(body ProjectMetadataRequest) map[string]string {
+	fields := make(map[string]string)
+	if body.ProjectDescription == nil && len(body.Labels) == 0 && len(body.Annotations) == 0 {
+		fields["labels"] = "at least one of projectDescription, labels or annotations is required"
+	}
+
+	for key, value := range body.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			fields["labels."+key] = "invalid label key: " + strings.Join(errs, "; ")
+		} else if value != nil {
+			if errs := validation.IsValidLabelValue(*value); len(errs) > 0 {
+				fields["labels."+key] = "invalid label value: " + strings.Join(errs, "; ")
+			}
+		}
+	}
+
+	for key := range body.Annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			fields["annotations."+key] = "invalid annotation key: " + strings.Join(errs, "; ")
+		} else if strings.HasPrefix(key, managedAnnotationPrefix) {
+			fields["annotations."+key] = "annotations with the prefix " + managedAnnotationPrefix + " are managed by this API"
+		}
+	}
+	return fields
+}
+
+// projectMetadataItem describes what a project metadata update changes for
+// its audit entry, e.g. "description; labels: cost-center, team"
+func projectMetadataItem(body ProjectMetadataRequest) string {
+	var parts []string
+	if body.ProjectDescription != nil {
+		parts = append(parts, "description")
+	}
+	for _, field := range []struct {
+		name   string
+		values map[string]*string
+	}{{"labels", body.Labels}, {"annotations", body.Annotations}} {
+		if len(field.values) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(field.values))
+		for key := range field.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts = append(parts, field.name+": "+strings.Join(keys, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
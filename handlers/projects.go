@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateProjectRequest represents a request to create an AppProject
+type CreateProjectRequest struct {
+	Name         string               `json:"name"`
+	Destinations []argocd.Destination `json:"destinations,omitempty"`
+	Description  string               `json:"description"`
+	TicketID     string               `json:"ticketId,omitempty"`
+}
+
+// DeleteProjectRequest represents a request to delete an AppProject
+type DeleteProjectRequest struct {
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// ProjectHasDestinationsResponse is returned when a deletion is refused
+// because the project still has destinations
+type ProjectHasDestinationsResponse struct {
+	Message          string `json:"message"`
+	DestinationCount int    `json:"destinationCount"`
+}
+
+// CreateProject handles POST /projects. The project is created with only the
+// given destinations, so it permits no source repositories until they are
+// configured separately. Projects created with a scoped key get the key's
+// owner label, so the key can manage them afterwards. The creation is audited
+// with action create_project, and each initial destination as an add.
+func (h *DestinationHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	var body CreateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "create_project", DestinationRequest{}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+
+	req := DestinationRequest{Project: body.Name, Description: body.Description, TicketID: body.TicketID}
+	logAudit := func(status int) {
+		h.logAudit(r, "create_project", req, status)
+	}
+
+	fields := make(map[string]string)
+	if msg := h.projectNameError(body.Name); msg != "" {
+		fields["name"] = msg
+	}
+	if body.Description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+	if limit := h.client.MaxDestinations(); limit > 0 && len(body.Destinations) > limit {
+		fields["destinations"] = fmt.Sprintf("at most %d destinations are allowed per project", limit)
+	}
+	if len(fields) == 0 {
+		required, err := h.requiredFields(r.Context(), body.Name)
+		if err != nil {
+			logAudit(h.handleK8sError(w, r, err, body.Name))
+			return
+		}
+		for i, dest := range body.Destinations {
+			destFields := h.destinationErrors(body.Name, dest)
+			for field, msg := range missingFieldErrors(body.Name, required, dest) {
+				destFields[field] = msg
+			}
+			for field, msg := range destFields {
+				fields[fmt.Sprintf("destinations[%d].%s", i, field)] = msg
+			}
+		}
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		logAudit(http.StatusUnprocessableEntity)
+		return
+	}
+	if msg := h.ticketError(body.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		logAudit(http.StatusBadRequest)
+		return
+	}
+	if msg := h.protectedError(body.Name); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		logAudit(http.StatusForbidden)
+		return
+	}
+	for i, dest := range body.Destinations {
+		if msg := h.policyError(withDestination(req, dest)); msg != "" {
+			writeJSONError(w, r, http.StatusForbidden, fmt.Sprintf("destinations[%d]: %s", i, msg))
+			logAudit(http.StatusForbidden)
+			return
+		}
+	}
+
+	destinations := body.Destinations
+	if destinations == nil {
+		destinations = []argocd.Destination{}
+	}
+	resourceVersion, err := h.client.CreateProject(r.Context(), body.Name, projectOwnerLabels(r.Context()), destinations)
+	if err != nil {
+		logAudit(h.handleK8sError(w, r, err, body.Name))
+		return
+	}
+	h.labels.forget(r.Context(), body.Name)
+
+	logAudit(http.StatusCreated)
+	for _, dest := range destinations {
+		h.logAudit(r, "add", withDestination(req, dest), http.StatusCreated)
+	}
+
+	log.Printf("Created project %s with %d destinations: reason=%q resourceVersion=%s",
+		body.Name, len(destinations), body.Description, resourceVersion)
+
+	setETag(w, resourceVersion)
+	w.Header().Set("Location", path.Join(r.URL.Path, body.Name))
+	writeJSON(w, http.StatusCreated, argocd.Project{
+		Name:             body.Name,
+		DestinationCount: len(destinations),
+		Destinations:     destinations,
+	})
+}
+
+// DeleteProject handles DELETE /projects/{project}. A project that still has
+// destinations is only deleted with ?force=true, so a typo can't take away
+// the targets of running Applications. The deletion is audited with action
+// delete_project, recording the destinations it dropped in matches.
+func (h *DestinationHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	var body DeleteProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logAudit(r, "delete_project", DestinationRequest{Project: project}, http.StatusBadRequest)
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+
+	req := DestinationRequest{Project: project, Description: body.Description, TicketID: body.TicketID}
+	forced := false
+	logAudit := func(outcome string, status, destinations int) {
+		entry := h.auditEntry(r, "delete_project", req, outcome, status)
+		entry.Matches = destinations
+		entry.Forced = forced
+		h.writeAudit(r.Context(), entry)
+	}
+
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "force must be a boolean")
+			logAudit(audit.OutcomeDenied, http.StatusBadRequest, 0)
+			return
+		}
+	}
+
+	fields := make(map[string]string)
+	if msg := h.projectNameError(project); msg != "" {
+		fields["project"] = msg
+	}
+	if body.Description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		logAudit(audit.OutcomeDenied, http.StatusUnprocessableEntity, 0)
+		return
+	}
+	if msg := h.ticketError(body.TicketID); msg != "" {
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		logAudit(audit.OutcomeDenied, http.StatusBadRequest, 0)
+		return
+	}
+	if msg := h.protectedError(project); msg != "" {
+		writeJSONError(w, r, http.StatusForbidden, msg)
+		logAudit(audit.OutcomeDenied, http.StatusForbidden, 0)
+		return
+	}
+
+	if status, ok := h.authorizeProject(w, r, project); !ok {
+		logAudit(audit.OutcomeForStatus(status), status, 0)
+		return
+	}
+
+	// The deletion is conditioned on the version checked here, so a
+	// destination added in between can't be deleted without force
+	destinations, resourceVersion, err := h.client.GetDestinations(r.Context(), project)
+	if err != nil {
+		status := h.handleK8sError(w, r, err, project)
+		logAudit(audit.OutcomeForStatus(status), status, 0)
+		return
+	}
+	destinationCount := len(destinations)
+	if destinationCount > 0 {
+		if !force {
+			writeJSON(w, http.StatusConflict, ProjectHasDestinationsResponse{
+				Message:          fmt.Sprintf("project %s still has %d destinations; remove them first or pass force=true", project, destinationCount),
+				DestinationCount: destinationCount,
+			})
+			logAudit(audit.OutcomeDenied, http.StatusConflict, destinationCount)
+			return
+		}
+		forced = true
+	}
+
+	if err := h.client.DeleteProject(r.Context(), project, resourceVersion); err != nil {
+		if errors.Is(err, argocd.ErrConflict) {
+			writeJSONError(w, r, http.StatusConflict, fmt.Sprintf("project %s changed while it was being deleted, please retry", project))
+			logAudit(audit.OutcomeForStatus(http.StatusConflict), http.StatusConflict, destinationCount)
+			return
+		}
+		status := h.handleK8sError(w, r, err, project)
+		logAudit(audit.OutcomeForStatus(status), status, destinationCount)
+		return
+	}
+	h.labels.forget(r.Context(), project)
+
+	logAudit(audit.OutcomeSuccess, http.StatusNoContent, destinationCount)
+
+	log.Printf("Deleted project %s with %d destinations: reason=%q forced=%t",
+		project, destinationCount, body.Description, forced)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"path"
+)
+
+// ProtectedProjects lists glob patterns of projects that can't be changed
+// through the API with any key, as a safety rail for critical projects such
+// as default. They can still be read.
+type ProtectedProjects []string
+
+// NewProtectedProjects creates a protected project list, rejecting malformed
+// patterns
+func NewProtectedProjects(patterns []string) (ProtectedProjects, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected project pattern %q: %w", pattern, err)
+		}
+	}
+	return ProtectedProjects(patterns), nil
+}
+
+// Check returns a message naming the pattern that protects the project, or an
+// empty string if it may be changed
+func (p ProtectedProjects) Check(project string) string {
+	for _, pattern := range p {
+		if ok, _ := path.Match(pattern, project); ok {
+			if pattern == project {
+				return fmt.Sprintf("project %s is protected and can't be changed through this API", project)
+			}
+			return fmt.Sprintf("project %s is protected by pattern %q and can't be changed through this API", project, pattern)
+		}
+	}
+	return ""
+}
+
+// protectedError returns a message if the project is protected by
+// Options.ProtectedProjects, or an empty string if it may be changed
+func (h *DestinationHandler) protectedError(project string) string {
+	return h.options.Load().ProtectedProjects.Check(project)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetProjectSpec handles GET /projects/{project}/raw. It returns the spec of
+// the AppProject exactly as ArgoCD stores it, including roles, sync windows
+// and resource whitelists, for debugging why a destination doesn't take
+// effect. Only admin keys may use it, since roles and their JWT token
+// metadata are shown unredacted.
+func (h *DestinationHandler) GetProjectSpec(w http.ResponseWriter, r *http.Request) {
+	if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+		writeJSONError(w, r, http.StatusForbidden, "raw project spec requires an admin API key")
+		return
+	}
+
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+
+	spec, resourceVersion, err := h.client.GetProjectSpec(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	writeJSON(w, http.StatusOK, spec)
+}
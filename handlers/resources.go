@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// ResourceRequest represents a request to add or remove a group/kind pair of
+// a project's resource lists. Group is empty for the core API group.
+type ResourceRequest struct {
+	Group       string `json:"group"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// ResourcesResponse lists the entries of one of a project's resource lists
+type ResourcesResponse struct {
+	Resources []argocd.GroupKind `json:"resources"`
+}
+
+// ListClusterResourceWhitelist handles GET /projects/{project}/cluster-resource-whitelist
+func (h *DestinationHandler) ListClusterResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.listResources(w, r, argocd.ClusterResourceWhitelist)
+}
+
+// AddClusterResourceWhitelist handles POST /projects/{project}/cluster-resource-whitelist
+func (h *DestinationHandler) AddClusterResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.ClusterResourceWhitelist, "add_cluster_resource_whitelist")
+}
+
+// RemoveClusterResourceWhitelist handles DELETE /projects/{project}/cluster-resource-whitelist
+func (h *DestinationHandler) RemoveClusterResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.ClusterResourceWhitelist, "remove_cluster_resource_whitelist")
+}
+
+// ListNamespaceResourceWhitelist handles GET /projects/{project}/namespace-resource-whitelist
+func (h *DestinationHandler) ListNamespaceResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.listResources(w, r, argocd.NamespaceResourceWhitelist)
+}
+
+// AddNamespaceResourceWhitelist handles POST /projects/{project}/namespace-resource-whitelist
+func (h *DestinationHandler) AddNamespaceResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.NamespaceResourceWhitelist, "add_namespace_resource_whitelist")
+}
+
+// RemoveNamespaceResourceWhitelist handles DELETE /projects/{project}/namespace-resource-whitelist
+func (h *DestinationHandler) RemoveNamespaceResourceWhitelist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.NamespaceResourceWhitelist, "remove_namespace_resource_whitelist")
+}
+
+// ListNamespaceResourceBlacklist handles GET /projects/{project}/namespace-resource-blacklist
+func (h *DestinationHandler) ListNamespaceResourceBlacklist(w http.ResponseWriter, r *http.Request) {
+	h.listResources(w, r, argocd.NamespaceResourceBlacklist)
+}
+
+// AddNamespaceResourceBlacklist handles POST /projects/{project}/namespace-resource-blacklist
+func (h *DestinationHandler) AddNamespaceResourceBlacklist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.NamespaceResourceBlacklist, "add_namespace_resource_blacklist")
+}
+
+// RemoveNamespaceResourceBlacklist handles DELETE /projects/{project}/namespace-resource-blacklist
+func (h *DestinationHandler) RemoveNamespaceResourceBlacklist(w http.ResponseWriter, r *http.Request) {
+	h.changeResource(w, r, argocd.NamespaceResourceBlacklist, "remove_namespace_resource_blacklist")
+}
+
+func (h *DestinationHandler) listResources(w http.ResponseWriter, r *http.Request, list argocd.ResourceList) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	resources, resourceVersion, err := h.client.GetResources(r.Context(), project, list)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, ResourcesResponse{Resources: resources})
+}
+
+// changeResource adds or removes a group/kind pair, depending on whether
+// action starts with "add_". Adding or removing it again is a no-op.
+func (h *DestinationHandler) changeResource(w http.ResponseWriter, r *http.Request, list argocd.ResourceList, action string) {
+	change := specChange{action: action, project: chi.URLParam(r, "project")}
+	adding := strings.HasPrefix(action, "add_")
+
+	var body ResourceRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	gk := argocd.GroupKind{Group: body.Group, Kind: body.Kind}
+	change.item, change.description, change.ticketID = gk.String(), body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	switch {
+	case body.Kind == "":
+		fields["kind"] = "kind is required"
+	case strings.ContainsAny(body.Kind, " \t\n"):
+		fields["kind"] = "kind must not contain whitespace"
+	}
+	if strings.ContainsAny(body.Group, " \t\n") {
+		fields["group"] = "group must not contain whitespace"
+	}
+	// A wildcard in a whitelist permits every resource. Removing one from a
+	// blacklist does too, but an empty blacklist permits everything anyway.
+	if adding && !list.Blacklist() && !h.options.Load().WildcardProjects[change.project] {
+		if body.Group == "*" {
+			fields["group"] = "wildcard group (*) is not allowed"
+		}
+		if body.Kind == "*" {
+			fields["kind"] = "wildcard kind (*) is not allowed"
+		}
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	if adding {
+		result, err := h.client.AddResource(r.Context(), change.project, list, gk)
+		h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "project already has this resource in "+string(list))
+		return
+	}
+	result, err := h.client.RemoveResource(r.Context(), change.project, list, gk)
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "project doesn't have this resource in "+string(list)+", nothing removed")
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// roleNameRegex is the format ArgoCD requires of project role names
+var roleNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([-_a-zA-Z0-9]*[a-zA-Z0-9])?$`)
+
+// CreateRoleRequest represents a request to create a project role.
+// RoleDescription is stored on the role; Description explains the change.
+type CreateRoleRequest struct {
+	Name            string   `json:"name"`
+	RoleDescription string   `json:"roleDescription,omitempty"`
+	Policies        []string `json:"policies"`
+	Groups          []string `json:"groups"`
+	Description     string   `json:"description"`
+	TicketID        string   `json:"ticketId,omitempty"`
+}
+
+// RoleChangeRequest represents a request to delete a role, or to add or
+// remove one of its policies or groups. Only the field of the change is used.
+type RoleChangeRequest struct {
+	Policy      string `json:"policy,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// RolesResponse lists the roles of a project
+type RolesResponse struct {
+	Roles []argocd.Role `json:"roles"`
+}
+
+// ListRoles handles GET /projects/{project}/roles
+func (h *DestinationHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	roles, resourceVersion, err := h.client.GetRoles(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, RolesResponse{Roles: roles})
+}
+
+// CreateRole handles POST /projects/{project}/roles. Creating a role the
+// project already has returns 409.
+func (h *DestinationHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	change := specChange{action: "create_role", project: chi.URLParam(r, "project")}
+
+	var body CreateRoleRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.item, change.description, change.ticketID = body.Name, body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	if msg := roleNameError(body.Name); msg != "" {
+		fields["name"] = msg
+	}
+	for i, policy := range body.Policies {
+		if msg := policyError(change.project, body.Name, policy); msg != "" {
+			fields[fmt.Sprintf("policies[%d]", i)] = msg
+		}
+	}
+	for i, group := range body.Groups {
+		if msg := groupError(group); msg != "" {
+			fields[fmt.Sprintf("groups[%d]", i)] = msg
+		}
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	result, err := h.client.CreateRole(r.Context(), change.project, argocd.Role{
+		Name:        body.Name,
+		Description: body.RoleDescription,
+		Policies:    body.Policies,
+		Groups:      body.Groups,
+	})
+	h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "")
+}
+
+// DeleteRole handles DELETE /projects/{project}/roles/{role}. The role's
+// tokens stop working. Deleting a role the project doesn't have is a no-op.
+func (h *DestinationHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role := chi.URLParam(r, "role")
+	change := specChange{action: "delete_role", project: chi.URLParam(r, "project"), item: role}
+
+	var body RoleChangeRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.description, change.ticketID = body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	if msg := roleNameError(role); msg != "" {
+		fields["role"] = msg
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	result, err := h.client.DeleteRole(r.Context(), change.project, role)
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "project doesn't have this role, nothing removed")
+}
+
+// AddRolePolicy handles POST /projects/{project}/roles/{role}/policies
+func (h *DestinationHandler) AddRolePolicy(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, "add_role_policy")
+}
+
+// RemoveRolePolicy handles DELETE /projects/{project}/roles/{role}/policies
+func (h *DestinationHandler) RemoveRolePolicy(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, "remove_role_policy")
+}
+
+// AddRoleGroup handles POST /projects/{project}/roles/{role}/groups
+func (h *DestinationHandler) AddRoleGroup(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, "add_role_group")
+}
+
+// RemoveRoleGroup handles DELETE /projects/{project}/roles/{role}/groups
+func (h *DestinationHandler) RemoveRoleGroup(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, "remove_role_group")
+}
+
+// changeRole adds or removes a policy or group of a role, depending on the
+// action. Adding or removing it again is a no-op; a missing role returns 404.
+func (h *DestinationHandler) changeRole(w http.ResponseWriter, r *http.Request, action string) {
+	role := chi.URLParam(r, "role")
+	change := specChange{action: action, project: chi.URLParam(r, "project")}
+	policies := strings.HasSuffix(action, "_policy")
+
+	var body RoleChangeRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	value := body.Group
+	if policies {
+		value = body.Policy
+	}
+	change.item, change.description, change.ticketID = role+": "+value, body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	if msg := roleNameError(role); msg != "" {
+		fields["role"] = msg
+	}
+	switch {
+	case !policies:
+		if msg := groupError(value); msg != "" {
+			fields["group"] = msg
+		}
+	case strings.HasPrefix(action, "add_"):
+		if msg := policyError(change.project, role, value); msg != "" {
+			fields["policy"] = msg
+		}
+	case value == "":
+		// Malformed policies may be removed, e.g. ones added by hand
+		fields["policy"] = "policy is required"
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	ctx := r.Context()
+	var result argocd.Result
+	var err error
+	switch action {
+	case "add_role_policy":
+		result, err = h.client.AddRolePolicy(ctx, change.project, role, value)
+	case "remove_role_policy":
+		result, err = h.client.RemoveRolePolicy(ctx, change.project, role, value)
+	case "add_role_group":
+		result, err = h.client.AddRoleGroup(ctx, change.project, role, value)
+	default:
+		result, err = h.client.RemoveRoleGroup(ctx, change.project, role, value)
+	}
+
+	if strings.HasPrefix(action, "add_") {
+		h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "role already has this entry")
+		return
+	}
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "role doesn't have this entry, nothing removed")
+}
+
+// roleNameError returns why name is not a valid role name, or "" if it is
+func roleNameError(name string) string {
+	switch {
+	case name == "":
+		return "role name is required"
+	case len(name) > 63:
+		return "role name must be at most 63 characters"
+	case !roleNameRegex.MatchString(name):
+		return "role name must consist of alphanumeric characters, '-' or '_', and start and end with an alphanumeric character"
+	}
+	return ""
+}
+
+// policyError returns why policy is not a valid policy of the role, or "" if
+// it is. Like ArgoCD, it requires the Casbin form
+// "p, proj:<project>:<role>, <resource>, <action>, <project>/<object>, allow|deny",
+// so a role can't grant access to other projects.
+func policyError(project, role, policy string) string {
+	if policy == "" {
+		return "policy is required"
+	}
+	parts := strings.Split(policy, ",")
+	if len(parts) != 6 {
+		return "policy must have the form 'p, proj:<project>:<role>, <resource>, <action>, <project>/<object>, allow|deny'"
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	switch {
+	case parts[0] != "p":
+		return "policy must start with 'p'"
+	case parts[1] != "proj:"+project+":"+role:
+		return fmt.Sprintf("policy subject must be 'proj:%s:%s'", project, role)
+	case parts[2] == "" || parts[3] == "":
+		return "policy resource and action are required"
+	case !strings.HasPrefix(parts[4], project+"/") || parts[4] == project+"/":
+		return fmt.Sprintf("policy object must start with '%s/'", project)
+	case parts[5] != "allow" && parts[5] != "deny":
+		return "policy effect must be 'allow' or 'deny'"
+	}
+	return ""
+}
+
+// groupError returns why group is not a valid SSO group binding, or "" if
+// it is. Commas and line breaks would corrupt the generated Casbin policy.
+func groupError(group string) string {
+	switch {
+	case strings.TrimSpace(group) == "":
+		return "group is required"
+	case strings.ContainsAny(group, ",\n\r"):
+		return "group must not contain commas or line breaks"
+	}
+	return ""
+}
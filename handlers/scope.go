@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/middleware"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ownerLabel is the AppProject label compared against a scoped key's owner
+const ownerLabel = "owner"
+
+// projectLabelTTL is how long project labels are cached for access checks
+const projectLabelTTL = 30 * time.Second
+
+// labelCache caches AppProject labels briefly so access checks don't add a
+// GET to every request
+type labelCache struct {
+	client  *argocd.Client
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]labelCacheEntry
+}
+
+type labelCacheEntry struct {
+	labels  map[string]string
+	expires time.Time
+}
+
+func newLabelCache(client *argocd.Client, ttl time.Duration) *labelCache {
+	return &labelCache{
+		client:  client,
+		ttl:     ttl,
+		entries: make(map[string]labelCacheEntry),
+	}
+}
+
+// get returns the labels of a project, fetching them if not cached
+func (c *labelCache) get(ctx context.Context, project string) (map[string]string, error) {
+	key := c.client.Namespace(ctx) + "/" + project
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.labels, nil
+	}
+
+	projectLabels, err := c.client.GetProjectLabels(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = labelCacheEntry{labels: projectLabels, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return projectLabels, nil
+}
+
+// forget drops the cached labels of a project, e.g. once it was deleted, so a
+// project created under the same name isn't checked against them
+func (c *labelCache) forget(ctx context.Context, project string) {
+	c.mu.Lock()
+	delete(c.entries, c.client.Namespace(ctx)+"/"+project)
+	c.mu.Unlock()
+}
+
+// authorizeProject checks that the caller's API key may access the project and
+// writes an error response if not. It returns the status written and whether
+// access is allowed.
+func (h *DestinationHandler) authorizeProject(w http.ResponseWriter, r *http.Request, project string) (int, bool) {
+	allowed, err := h.projectAccess(r.Context(), project)
+	if err != nil {
+		return h.handleK8sError(w, r, err, project), false
+	}
+
+	if !allowed {
+		writeJSONError(w, r, http.StatusForbidden, "access denied to project: "+project)
+		return http.StatusForbidden, false
+	}
+
+	return 0, true
+}
+
+// projectAccess reports whether the caller's API key may access the project.
+// Admin keys may access every project; scoped keys only projects whose owner
+// label matches, so unlabeled projects are denied.
+func (h *DestinationHandler) projectAccess(ctx context.Context, project string) (bool, error) {
+	identity, ok := middleware.IdentityFromContext(ctx)
+	if ok && identity.Admin {
+		return true, nil
+	}
+
+	projectLabels, err := h.labels.get(ctx, project)
+	if err != nil {
+		return false, err
+	}
+
+	return ok && projectLabels[ownerLabel] == identity.Owner, nil
+}
+
+// projectSelector returns the label selector limiting project listings to the
+// projects the caller's API key may access
+func projectSelector(ctx context.Context) string {
+	identity, ok := middleware.IdentityFromContext(ctx)
+	if ok && identity.Admin {
+		return ""
+	}
+	return labels.Set{ownerLabel: identity.Owner}.String()
+}
+
+// projectOwnerLabels returns the labels that give the caller's API key access
+// to a project it creates. Projects created with admin keys get no owner.
+func projectOwnerLabels(ctx context.Context) map[string]string {
+	identity, ok := middleware.IdentityFromContext(ctx)
+	if ok && identity.Admin {
+		return nil
+	}
+	return map[string]string{ownerLabel: identity.Owner}
+}
+
+// projectSelectableFields are the fields AppProjects can be filtered by server-side
+var projectSelectableFields = map[string]bool{
+	"metadata.name":      true,
+	"metadata.namespace": true,
+}
+
+// fieldSelectorError returns a message explaining why a project field
+// selector is invalid, or an empty string if it is valid
+func fieldSelectorError(selector string) string {
+	if selector == "" {
+		return ""
+	}
+
+	parsed, err := fields.ParseSelector(selector)
+	if err != nil {
+		return "invalid fieldSelector: " + err.Error()
+	}
+	for _, req := range parsed.Requirements() {
+		if !projectSelectableFields[req.Field] {
+			return "fieldSelector may only select metadata.name or metadata.namespace, got " + req.Field
+		}
+	}
+	return ""
+}
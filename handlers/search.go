@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultProjectSearchLimit is the number of matches returned by project
+// search unless Options.ProjectSearchLimit is set
+const DefaultProjectSearchLimit = 20
+
+// ProjectMatch summarizes a project found by search
+type ProjectMatch struct {
+	Name             string `json:"name"`
+	DestinationCount int    `json:"destinationCount"`
+}
+
+// ProjectSearchResponse represents the projects whose name matches a query
+type ProjectSearchResponse struct {
+	Query    string         `json:"query"`
+	Projects []ProjectMatch `json:"projects"`
+	// Truncated is set when more projects matched than were returned
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// SearchProjects handles GET /projects/search. It returns the projects whose
+// name contains the q query parameter, ignoring case, sorted by name. Only
+// names and destination counts are returned to keep the payload small.
+func (h *DestinationHandler) SearchProjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	limit := h.options.Load().ProjectSearchLimit
+	if limit <= 0 {
+		limit = DefaultProjectSearchLimit
+	}
+
+	projects, err := h.client.ListProjects(r.Context(), projectSelector(r.Context()), "")
+	if err != nil {
+		log.Printf("Failed to list projects: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list projects")
+		return
+	}
+
+	needle := strings.ToLower(query)
+	matches := []ProjectMatch{}
+	for _, project := range projects {
+		if strings.Contains(strings.ToLower(project.Name), needle) {
+			matches = append(matches, ProjectMatch{Name: project.Name, DestinationCount: project.DestinationCount})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+
+	resp := ProjectSearchResponse{Query: query, Projects: matches}
+	if len(matches) > limit {
+		resp.Projects = matches[:limit]
+		resp.Truncated = true
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// ProjectSettingsRequest represents a request to change a project's
+// settings. Settings left out are not changed.
+type ProjectSettingsRequest struct {
+	PermitOnlyProjectScopedClusters *bool  `json:"permitOnlyProjectScopedClusters"`
+	Description                     string `json:"description"`
+	TicketID                        string `json:"ticketId,omitempty"`
+}
+
+// GetProjectSettings handles GET /projects/{project}/settings
+func (h *DestinationHandler) GetProjectSettings(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	settings, resourceVersion, err := h.client.GetProjectSettings(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// UpdateProjectSettings handles PATCH /projects/{project}/settings. Settings
+// decide how far a project's destinations reach, so only admin keys may
+// change them.
+func (h *DestinationHandler) UpdateProjectSettings(w http.ResponseWriter, r *http.Request) {
+	change := specChange{action: "update_project_settings", project: chi.URLParam(r, "project")}
+
+	if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+		writeJSONError(w, r, http.StatusForbidden, "only admin API keys may change project settings")
+		h.logSpecChange(r, change, audit.OutcomeDenied, http.StatusForbidden)
+		return
+	}
+
+	var body ProjectSettingsRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.description, change.ticketID = body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	if body.PermitOnlyProjectScopedClusters == nil {
+		fields["permitOnlyProjectScopedClusters"] = "permitOnlyProjectScopedClusters is required"
+	} else {
+		change.item = "permitOnlyProjectScopedClusters=" + strconv.FormatBool(*body.PermitOnlyProjectScopedClusters)
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	result, err := h.client.SetPermitOnlyProjectScopedClusters(r.Context(), change.project, *body.PermitOnlyProjectScopedClusters)
+	h.finishSpecChange(w, r, change, result, err, http.StatusOK, "project settings already match, nothing changed")
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// keyIDRegex matches the long (16 hex digit) GPG key IDs ArgoCD requires
+var keyIDRegex = regexp.MustCompile(`^[0-9A-F]{16}$`)
+
+// SignatureKeyRequest represents a request to add or remove a GPG key ID
+// commits to a project must be signed with
+type SignatureKeyRequest struct {
+	KeyID       string `json:"keyId"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// SignatureKeysResponse lists the GPG key IDs of a project
+type SignatureKeysResponse struct {
+	SignatureKeys []string `json:"signatureKeys"`
+}
+
+// ListSignatureKeys handles GET /projects/{project}/signature-keys
+func (h *DestinationHandler) ListSignatureKeys(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	keys, resourceVersion, err := h.client.GetSignatureKeys(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, SignatureKeysResponse{SignatureKeys: keys})
+}
+
+// AddSignatureKey handles POST /projects/{project}/signature-keys. Adding a
+// key the project already has is a no-op.
+func (h *DestinationHandler) AddSignatureKey(w http.ResponseWriter, r *http.Request) {
+	h.changeSignatureKey(w, r, "add_signature_key")
+}
+
+// RemoveSignatureKey handles DELETE /projects/{project}/signature-keys.
+// Removing a key the project doesn't have is a no-op.
+func (h *DestinationHandler) RemoveSignatureKey(w http.ResponseWriter, r *http.Request) {
+	h.changeSignatureKey(w, r, "remove_signature_key")
+}
+
+func (h *DestinationHandler) changeSignatureKey(w http.ResponseWriter, r *http.Request, action string) {
+	change := specChange{action: action, project: chi.URLParam(r, "project")}
+
+	var body SignatureKeyRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	// Key IDs are stored upper case, as gpg prints them
+	keyID := strings.ToUpper(body.KeyID)
+	change.item, change.description, change.ticketID = keyID, body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	switch {
+	case keyID == "":
+		fields["keyId"] = "keyId is required"
+	case !keyIDRegex.MatchString(keyID):
+		fields["keyId"] = "keyId must be a long GPG key ID of 16 hexadecimal digits"
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	if action == "add_signature_key" {
+		result, err := h.client.AddSignatureKey(r.Context(), change.project, keyID)
+		h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "project already has this signature key")
+		return
+	}
+	result, err := h.client.RemoveSignatureKey(r.Context(), change.project, keyID)
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "project doesn't have this signature key, nothing removed")
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SourceRepoRequest represents a request to permit or stop permitting a
+// source repository in a project
+type SourceRepoRequest struct {
+	Repo        string `json:"repo"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// SourceReposResponse lists the source repositories a project permits
+type SourceReposResponse struct {
+	SourceRepos []string `json:"sourceRepos"`
+}
+
+// ListSourceRepos handles GET /projects/{project}/source-repos
+func (h *DestinationHandler) ListSourceRepos(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	repos, resourceVersion, err := h.client.GetSourceRepos(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, SourceReposResponse{SourceRepos: repos})
+}
+
+// AddSourceRepo handles POST /projects/{project}/source-repos. Adding a repo
+// the project already permits is a no-op.
+func (h *DestinationHandler) AddSourceRepo(w http.ResponseWriter, r *http.Request) {
+	h.changeSourceRepo(w, r, "add_source_repo")
+}
+
+// RemoveSourceRepo handles DELETE /projects/{project}/source-repos. Removing
+// a repo the project doesn't permit is a no-op.
+func (h *DestinationHandler) RemoveSourceRepo(w http.ResponseWriter, r *http.Request) {
+	h.changeSourceRepo(w, r, "remove_source_repo")
+}
+
+func (h *DestinationHandler) changeSourceRepo(w http.ResponseWriter, r *http.Request, action string) {
+	change := specChange{action: action, project: chi.URLParam(r, "project")}
+
+	var body SourceRepoRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.item, change.description, change.ticketID = body.Repo, body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	switch {
+	case body.Repo == "":
+		fields["repo"] = "repo is required"
+	case strings.ContainsAny(body.Repo, " \t\n"):
+		fields["repo"] = "repo must not contain whitespace"
+	case body.Repo == "*" && action == "add_source_repo" && !h.options.Load().WildcardProjects[change.project]:
+		fields["repo"] = "wildcard repo (*) is not allowed"
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	if action == "add_source_repo" {
+		result, err := h.client.AddSourceRepo(r.Context(), change.project, body.Repo)
+		h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "project already permits this repo")
+		return
+	}
+	result, err := h.client.RemoveSourceRepo(r.Context(), change.project, body.Repo)
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "project doesn't permit this repo, nothing removed")
+}
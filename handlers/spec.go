@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// specChange describes a change to an AppProject spec list other than its
+// destinations, such as its source repos. Such changes are validated,
+// authorized and audited like destination changes.
+type specChange struct {
+	action      string
+	project     string
+	item        string
+	description string
+	ticketID    string
+}
+
+// decodeSpecChange decodes the JSON body of a spec change into body, writing
+// an error and auditing the attempt if it is invalid
+func (h *DestinationHandler) decodeSpecChange(w http.ResponseWriter, r *http.Request, change specChange, body any) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		h.logSpecChange(r, change, audit.OutcomeDenied, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateSpecChange applies the checks every change goes through, together
+// with the list-specific field errors in fields, and checks the caller may
+// access the project. It writes an error and audits the attempt if the change
+// is refused, and returns whether it may proceed.
+func (h *DestinationHandler) validateSpecChange(w http.ResponseWriter, r *http.Request, change specChange, fields map[string]string) bool {
+	if msg := h.projectNameError(change.project); msg != "" {
+		fields["project"] = msg
+	}
+	if change.description == "" {
+		fields["description"] = "description is required (explain why this change is being made)"
+	}
+
+	status := 0
+	switch {
+	case len(fields) > 0:
+		writeValidationError(w, r, fields)
+		status = http.StatusUnprocessableEntity
+	case h.ticketError(change.ticketID) != "":
+		msg := h.ticketError(change.ticketID)
+		writeError(w, r, http.StatusBadRequest, ErrorResponse{Message: msg, Fields: map[string]string{"ticketId": msg}})
+		status = http.StatusBadRequest
+	case h.protectedError(change.project) != "":
+		writeJSONError(w, r, http.StatusForbidden, h.protectedError(change.project))
+		status = http.StatusForbidden
+	default:
+		var ok bool
+		if status, ok = h.authorizeProject(w, r, change.project); ok {
+			return true
+		}
+	}
+
+	h.logSpecChange(r, change, audit.OutcomeForStatus(status), status)
+	return false
+}
+
+// finishSpecChange audits a spec change the client applied and writes the
+// response: status for a change, or a no-op response if there was nothing to
+// change. Errors are handled like destination errors.
+func (h *DestinationHandler) finishSpecChange(w http.ResponseWriter, r *http.Request, change specChange, result argocd.Result, err error, status int, noopMessage string) {
+	if err != nil {
+		status := h.handleK8sError(w, r, err, change.project)
+		h.logSpecChange(r, change, audit.OutcomeForStatus(status), status)
+		return
+	}
+
+	setETag(w, result.ResourceVersion)
+
+	if !result.Changed {
+		h.logSpecChange(r, change, audit.OutcomeNoop, http.StatusOK)
+		writeJSON(w, http.StatusOK, NoopResponse{Noop: true, Message: noopMessage, ResourceVersion: result.ResourceVersion})
+		return
+	}
+
+	h.logSpecChange(r, change, audit.OutcomeSuccess, status)
+	log.Printf("Applied %s to project %s: item=%s reason=%q resourceVersion=%s",
+		change.action, change.project, change.item, change.description, result.ResourceVersion)
+
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, SpecChangeResponse{Item: change.item, ResourceVersion: result.ResourceVersion})
+}
+
+// SpecChangeResponse is returned when an entry was added to a project spec list
+type SpecChangeResponse struct {
+	Item            string `json:"item"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// logSpecChange writes the audit entry of a spec change attempt
+func (h *DestinationHandler) logSpecChange(r *http.Request, change specChange, outcome string, status int) {
+	req := DestinationRequest{Project: change.project, Description: change.description, TicketID: change.ticketID}
+	entry := h.auditEntry(r, change.action, req, outcome, status)
+	entry.Item = change.item
+	h.writeAudit(r.Context(), entry)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// DefaultStatsTop is the number of projects GET /stats ranks by destination
+// count unless a request passes top
+const DefaultStatsTop = 10
+
+// maxStatsTop caps the top query parameter of GET /stats
+const maxStatsTop = 100
+
+// StatsResponse aggregates the projects visible to the caller
+type StatsResponse struct {
+	TotalProjects     int `json:"totalProjects"`
+	TotalDestinations int `json:"totalDestinations"`
+	// EmptyProjects counts the projects without destinations
+	EmptyProjects int `json:"emptyProjects"`
+	// TopProjects are the projects with the most destinations, ties broken
+	// by name
+	TopProjects []ProjectMatch `json:"topProjects"`
+}
+
+// Stats handles GET /stats. It computes the totals from the same project list
+// as GET /projects, so it is served from the project cache when enabled and
+// only covers the projects a scoped key may see. ?top=N sets how many
+// projects are ranked, up to 100.
+func (h *DestinationHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	top := DefaultStatsTop
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxStatsTop {
+			writeJSONError(w, r, http.StatusBadRequest, "top must be an integer between 0 and "+strconv.Itoa(maxStatsTop))
+			return
+		}
+		top = n
+	}
+
+	projects, err := h.client.ListProjects(r.Context(), projectSelector(r.Context()), "")
+	if err != nil {
+		log.Printf("Failed to list projects: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list projects")
+		return
+	}
+
+	resp := StatsResponse{TotalProjects: len(projects)}
+	ranked := make([]ProjectMatch, 0, len(projects))
+	for _, project := range projects {
+		resp.TotalDestinations += project.DestinationCount
+		if project.DestinationCount == 0 {
+			resp.EmptyProjects++
+		}
+		ranked = append(ranked, ProjectMatch{Name: project.Name, DestinationCount: project.DestinationCount})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].DestinationCount != ranked[j].DestinationCount {
+			return ranked[i].DestinationCount > ranked[j].DestinationCount
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	resp.TopProjects = ranked
+
+	writeJSON(w, http.StatusOK, resp)
+}
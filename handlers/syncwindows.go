@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// SyncWindowRequest represents a request to create or delete a sync window.
+// A deletion removes the windows identical to the one described.
+type SyncWindowRequest struct {
+	argocd.SyncWindow
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// SyncWindowsResponse lists the sync windows of a project
+type SyncWindowsResponse struct {
+	SyncWindows []argocd.SyncWindow `json:"syncWindows"`
+}
+
+// ListSyncWindows handles GET /projects/{project}/sync-windows
+func (h *DestinationHandler) ListSyncWindows(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	windows, resourceVersion, err := h.client.GetSyncWindows(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	setETag(w, resourceVersion)
+	if etagMatches(r.Header.Get("If-None-Match"), resourceVersion) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, SyncWindowsResponse{SyncWindows: windows})
+}
+
+// CreateSyncWindow handles POST /projects/{project}/sync-windows. Creating a
+// window the project already has is a no-op.
+func (h *DestinationHandler) CreateSyncWindow(w http.ResponseWriter, r *http.Request) {
+	h.changeSyncWindow(w, r, "create_sync_window")
+}
+
+// DeleteSyncWindow handles DELETE /projects/{project}/sync-windows. Deleting
+// a window the project doesn't have is a no-op.
+func (h *DestinationHandler) DeleteSyncWindow(w http.ResponseWriter, r *http.Request) {
+	h.changeSyncWindow(w, r, "delete_sync_window")
+}
+
+func (h *DestinationHandler) changeSyncWindow(w http.ResponseWriter, r *http.Request, action string) {
+	change := specChange{action: action, project: chi.URLParam(r, "project")}
+
+	var body SyncWindowRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	sw := body.SyncWindow
+	change.item, change.description, change.ticketID = sw.String(), body.Description, body.TicketID
+
+	if !h.validateSpecChange(w, r, change, syncWindowErrors(sw)) {
+		return
+	}
+
+	if action == "create_sync_window" {
+		result, err := h.client.AddSyncWindow(r.Context(), change.project, sw)
+		h.finishSpecChange(w, r, change, result, err, http.StatusCreated, "project already has this sync window")
+		return
+	}
+	result, err := h.client.RemoveSyncWindow(r.Context(), change.project, sw)
+	h.finishSpecChange(w, r, change, result, err, http.StatusNoContent, "project doesn't have this sync window, nothing removed")
+}
+
+// syncWindowErrors validates a sync window the way ArgoCD does, returning
+// the errors by field
+func syncWindowErrors(sw argocd.SyncWindow) map[string]string {
+	fields := make(map[string]string)
+
+	if sw.Kind != "allow" && sw.Kind != "deny" {
+		fields["kind"] = "kind must be 'allow' or 'deny'"
+	}
+
+	// ArgoCD accepts standard five-field cron expressions and descriptors
+	// such as @daily
+	switch {
+	case sw.Schedule == "":
+		fields["schedule"] = "schedule is required"
+	case !strings.HasPrefix(sw.Schedule, "@") && len(strings.Fields(sw.Schedule)) != 5:
+		fields["schedule"] = "schedule must be a cron expression with 5 fields, e.g. '0 22 * * *'"
+	}
+
+	if sw.Duration == "" {
+		fields["duration"] = "duration is required"
+	} else if d, err := time.ParseDuration(sw.Duration); err != nil || d <= 0 {
+		fields["duration"] = "duration must be a positive duration, e.g. '1h'"
+	}
+
+	if len(sw.Applications) == 0 && len(sw.Namespaces) == 0 && len(sw.Clusters) == 0 {
+		fields["applications"] = "at least one of applications, namespaces or clusters is required"
+	}
+
+	if sw.TimeZone != "" {
+		if _, err := time.LoadLocation(sw.TimeZone); err != nil {
+			fields["timeZone"] = "unknown time zone: " + sw.TimeZone
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// RoleTokenRequest represents a request to issue a token for a project role.
+// ExpiresIn is a duration such as "24h"; without it the token doesn't expire.
+type RoleTokenRequest struct {
+	ExpiresIn   string `json:"expiresIn,omitempty"`
+	Description string `json:"description"`
+	TicketID    string `json:"ticketId,omitempty"`
+}
+
+// RoleTokenResponse is returned when a role token was issued
+type RoleTokenResponse struct {
+	argocd.RoleToken
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// CreateRoleToken handles POST /projects/{project}/roles/{role}/tokens. The
+// token is only returned in this response. Only admin keys may use it, since
+// the token is signed with ArgoCD's own key and grants whatever the role's
+// policies allow.
+func (h *DestinationHandler) CreateRoleToken(w http.ResponseWriter, r *http.Request) {
+	role := chi.URLParam(r, "role")
+	change := specChange{action: "create_role_token", project: chi.URLParam(r, "project"), item: role}
+
+	if !h.options.Load().IssueRoleTokens {
+		writeJSONError(w, r, http.StatusForbidden, "issuing role tokens is disabled")
+		h.logSpecChange(r, change, audit.OutcomeDenied, http.StatusForbidden)
+		return
+	}
+	if identity, ok := middleware.IdentityFromContext(r.Context()); !ok || !identity.Admin {
+		writeJSONError(w, r, http.StatusForbidden, "issuing role tokens requires an admin API key")
+		h.logSpecChange(r, change, audit.OutcomeDenied, http.StatusForbidden)
+		return
+	}
+
+	var body RoleTokenRequest
+	if !h.decodeSpecChange(w, r, change, &body) {
+		return
+	}
+	h.defaultDescription(r, &body.Description)
+	change.description, change.ticketID = body.Description, body.TicketID
+
+	fields := make(map[string]string)
+	if msg := roleNameError(role); msg != "" {
+		fields["role"] = msg
+	}
+	var expiresIn time.Duration
+	if body.ExpiresIn != "" {
+		var err error
+		if expiresIn, err = time.ParseDuration(body.ExpiresIn); err != nil || expiresIn < time.Second {
+			fields["expiresIn"] = "expiresIn must be a duration of at least 1s, e.g. '24h'"
+		}
+	}
+	if !h.validateSpecChange(w, r, change, fields) {
+		return
+	}
+
+	token, result, err := h.client.CreateRoleToken(r.Context(), change.project, role, expiresIn)
+	if err != nil {
+		status := h.handleK8sError(w, r, err, change.project)
+		h.logSpecChange(r, change, audit.OutcomeForStatus(status), status)
+		return
+	}
+
+	// The audit entry and log identify the token by its ID, never the token
+	change.item = role + ": " + token.ID
+	h.logSpecChange(r, change, audit.OutcomeSuccess, http.StatusCreated)
+	log.Printf("Issued token %s for role %s of project %s: reason=%q resourceVersion=%s",
+		token.ID, role, change.project, change.description, result.ResourceVersion)
+
+	setETag(w, result.ResourceVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, RoleTokenResponse{RoleToken: token, ResourceVersion: result.ResourceVersion})
+}
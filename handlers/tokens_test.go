@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCreateRoleTokenRequiresAdmin(t *testing.T) {
+	project := testProject("team-a")
+	project.SetLabels(map[string]string{"owner": "team-a"})
+	h := newTestHandler(t, Options{IssueRoleTokens: true}, argocd.Options{}, project)
+
+	keys := middleware.NewKeySet([]middleware.APIKey{{Name: "team-a-pipeline", Key: "scoped-key", Owner: "team-a"}})
+	router := chi.NewRouter()
+	router.Use(middleware.APIKeyAuth(keys))
+	router.Post("/projects/{project}/roles/{role}/tokens", h.CreateRoleToken)
+
+	req := httptest.NewRequest(http.MethodPost, "/projects/team-a/roles/deploy/tokens", strings.NewReader(`{"description":"pipeline"}`))
+	req.Header.Set("X-API-Key", "scoped-key")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 for a key scoped to the project: %s", rec.Code, rec.Body)
+	}
+	for _, action := range h.dyn.Actions() {
+		if action.GetResource().Resource == "secrets" || action.GetVerb() == "patch" {
+			t.Errorf("unexpected %s of %s for a refused token", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+	entries := h.audit.WaitEntries(t, 1)
+	if len(entries) != 1 || entries[0].Action != "create_role_token" || entries[0].Outcome != audit.OutcomeDenied || entries[0].Actor != "team-a-pipeline" {
+		t.Errorf("audit entries = %+v, want the denied request", entries)
+	}
+}
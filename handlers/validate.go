@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/example/argocd-destination-api/argocd"
+	"github.com/go-chi/chi/v5"
+)
+
+// ValidateDestinationsRequest represents a proposed full destination set for a project
+type ValidateDestinationsRequest struct {
+	Destinations []argocd.Destination `json:"destinations"`
+}
+
+// DestinationValidationResult reports whether one proposed destination passes validation
+type DestinationValidationResult struct {
+	Destination argocd.Destination `json:"destination"`
+	Valid       bool               `json:"valid"`
+	Reasons     []string           `json:"reasons,omitempty"`
+}
+
+// ValidationReport reports the validation result of a proposed destination set.
+// Errors lists problems with the set as a whole.
+type ValidationReport struct {
+	Valid   bool                          `json:"valid"`
+	Errors  []string                      `json:"errors,omitempty"`
+	Results []DestinationValidationResult `json:"results"`
+}
+
+// ValidateDestinations handles POST /projects/{project}/destinations/validate.
+// It runs every validation over the proposed set without applying or auditing anything.
+func (h *DestinationHandler) ValidateDestinations(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+	if !h.validateProjectName(w, r, project) {
+		return
+	}
+
+	var req ValidateDestinationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if _, ok := h.authorizeProject(w, r, project); !ok {
+		return
+	}
+
+	required, err := h.requiredFields(r.Context(), project)
+	if err != nil {
+		h.handleK8sError(w, r, err, project)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.validateDestinationSet(project, required, req.Destinations))
+}
+
+// validateDestinationSet validates each destination of a proposed set for a
+// project and the set as a whole. required lists the fields the project's
+// field policy requires.
+func (h *DestinationHandler) validateDestinationSet(project string, required []string, destinations []argocd.Destination) ValidationReport {
+	report := ValidationReport{
+		Valid:   true,
+		Results: make([]DestinationValidationResult, 0, len(destinations)),
+	}
+
+	if limit := h.client.MaxDestinations(); limit > 0 && len(destinations) > limit {
+		report.Valid = false
+		report.Errors = append(report.Errors, fmt.Sprintf("%d destinations exceed the limit of %d per project", len(destinations), limit))
+	}
+
+	seen := make(map[argocd.Destination]bool, len(destinations))
+	for _, dest := range destinations {
+		result := DestinationValidationResult{Destination: dest, Valid: true}
+
+		fields := h.destinationErrors(project, dest)
+		for field, msg := range missingFieldErrors(project, required, dest) {
+			fields[field] = msg
+		}
+		if len(fields) == 0 {
+			if msg := h.policyError(DestinationRequest{Project: project, Server: dest.Server, Namespace: dest.Namespace, Name: dest.Name}); msg != "" {
+				fields["policy"] = msg
+			}
+		}
+		if seen[dest] {
+			fields["destination"] = "duplicate destination"
+		}
+		seen[dest] = true
+
+		for _, msg := range fields {
+			result.Reasons = append(result.Reasons, msg)
+		}
+		sort.Strings(result.Reasons)
+
+		if len(result.Reasons) > 0 {
+			result.Valid = false
+			report.Valid = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
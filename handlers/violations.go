@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// Rules a persisted destination can violate
+const (
+	RuleWildcard            = "wildcard"
+	RuleRequiredField       = "required_field"
+	RuleNamespacePolicy     = "namespace_policy"
+	RuleNamespaceConvention = "namespace_convention"
+)
+
+// Violation is a policy rule a destination breaks
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// DestinationViolations lists the rules one destination breaks
+type DestinationViolations struct {
+	Destination argocd.Destination `json:"destination"`
+	Violations  []Violation        `json:"violations"`
+}
+
+// ProjectViolations lists the destinations of a project that break a rule
+type ProjectViolations struct {
+	Project      string                  `json:"project"`
+	Destinations []DestinationViolations `json:"destinations"`
+}
+
+// ListViolations handles GET /projects/violations. It checks the stored
+// destinations of every project the caller may access against the current
+// validation rules and policies, and streams the projects that have violating
+// destinations. Projects are listed a page at a time like the export, so
+// large clusters are never held in memory. Nothing is changed or audited.
+func (h *DestinationHandler) ListViolations(w http.ResponseWriter, r *http.Request) {
+	// The scan may take longer than the server's write timeout allows for
+	// ordinary responses
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to lift write deadline for violation report: %v", err)
+	}
+
+	// Headers are written with the first project so that a failure to list
+	// the first page can still be reported with a proper status code.
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"projects":[`))
+	}
+
+	scanned, count := 0, 0
+	err := h.client.ExportProjects(r.Context(), projectSelector(r.Context()), exportPageSize, func(project argocd.Project) error {
+		if !started {
+			start()
+		}
+		scanned++
+
+		violations, err := h.projectViolations(r.Context(), project)
+		if err != nil {
+			return err
+		}
+		if len(violations.Destinations) == 0 {
+			return nil
+		}
+
+		data, err := json.Marshal(violations)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			data = append([]byte{','}, data...)
+		}
+		count++
+
+		_, err = w.Write(data)
+		return err
+	})
+
+	if err != nil {
+		if !started {
+			log.Printf("Failed to check projects for violations: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "failed to check projects for violations")
+			return
+		}
+		// The status has already been sent, so abort the response to keep
+		// clients from mistaking a truncated report for a complete one.
+		log.Printf("Violation report aborted after %d projects: %v", scanned, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		start()
+	}
+	w.Write([]byte("]}\n"))
+}
+
+// projectViolations checks every destination of a project against the rules
+// applied to new destinations
+func (h *DestinationHandler) projectViolations(ctx context.Context, project argocd.Project) (ProjectViolations, error) {
+	result := ProjectViolations{Project: project.Name, Destinations: []DestinationViolations{}}
+
+	required, err := h.requiredFields(ctx, project.Name)
+	if err != nil {
+		return result, err
+	}
+
+	for _, dest := range project.Destinations {
+		var violations []Violation
+
+		fields := h.destinationErrors(project.Name, dest)
+		for field, msg := range missingFieldErrors(project.Name, required, dest) {
+			fields[field] = msg
+		}
+		for field, msg := range fields {
+			rule := RuleRequiredField
+			if (field == "server" && dest.Server == "*") || (field == "namespace" && dest.Namespace == "*") {
+				rule = RuleWildcard
+			}
+			violations = append(violations, Violation{Rule: rule, Message: msg})
+		}
+		if dest.Namespace != "" {
+			if rule, msg := h.policyViolation(project.Name, dest.Namespace); msg != "" {
+				violations = append(violations, Violation{Rule: rule, Message: msg})
+			}
+		}
+
+		if len(violations) == 0 {
+			continue
+		}
+		sort.Slice(violations, func(i, j int) bool {
+			if violations[i].Rule != violations[j].Rule {
+				return violations[i].Rule < violations[j].Rule
+			}
+			return violations[i].Message < violations[j].Message
+		})
+		result.Destinations = append(result.Destinations, DestinationViolations{Destination: dest, Violations: violations})
+	}
+
+	return result, nil
+}
@@ -1,86 +1,281 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/example/argocd-destination-api/argocd"
 	"github.com/example/argocd-destination-api/audit"
+	"github.com/example/argocd-destination-api/config"
 	"github.com/example/argocd-destination-api/handlers"
+	"github.com/example/argocd-destination-api/metrics"
 	"github.com/example/argocd-destination-api/middleware"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// gzipMinSize is the smallest read response that is gzip-compressed
+const gzipMinSize = 1024
+
+// Build information, set at build time via -ldflags "-X main.version=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
 )
 
 func main() {
-	// Get configuration from environment
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" {
-		log.Fatal("API_KEY environment variable is required")
+	// A subcommand runs a single operation instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
 	}
 
-	namespace := os.Getenv("ARGOCD_NAMESPACE")
-	if namespace == "" {
-		namespace = "argocd"
-	}
+	log.Printf("argocd-destination-api version=%s commit=%s buildDate=%s", version, commit, buildDate)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
+	log.Printf("Configuration:\n%s", cfg)
 
-	auditLogPath := os.Getenv("AUDIT_LOG_PATH")
-	if auditLogPath == "" {
-		auditLogPath = "/var/log/audit/audit.log"
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
 	}
+}
 
+// run serves the API with the given configuration until the server fails or
+// is shut down
+func run(cfg *config.Config) error {
 	// Initialize audit logger
-	auditLogger, err := audit.NewLogger(auditLogPath)
+	auditLogger, err := newAuditLogger(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create audit logger: %v", err)
+		return err
 	}
 	defer auditLogger.Close()
+	go reopenAuditLogOnSIGHUP(auditLogger)
 
 	// Initialize ArgoCD client
-	client, err := argocd.NewClient(namespace)
+	client, err := argocd.NewClient(cfg.Namespaces[0], cfg.Client)
+	if err != nil {
+		return fmt.Errorf("failed to create ArgoCD client: %w", err)
+	}
+
+	destHandler := handlers.NewDestinationHandler(client, auditLogger, cfg.Handler)
+	apiKeys := middleware.NewKeySet(cfg.APIKeys)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if cfg.ExpirySweep {
+		go destHandler.RunExpirySweeper(ctx, cfg.ExpirySweepInterval, cfg.Namespaces)
+	}
+	if cfg.Client.ArchiveRemovals {
+		go destHandler.RunArchivePurger(ctx, cfg.ArchivePurgeInterval, cfg.ArchiveRetention, cfg.Namespaces)
+	}
+	if cfg.DestinationMetrics {
+		prometheus.MustRegister(metrics.NewDestinationCountCollector(func(ctx context.Context) (map[string][]int, error) {
+			return client.DestinationCounts(ctx, cfg.Namespaces)
+		}, cfg.DestinationMetricsInterval))
+	}
+
+	server, drain, err := newServer(cfg, newRouter(cfg, auditLogger, destHandler, apiKeys))
 	if err != nil {
-		log.Fatalf("Failed to create ArgoCD client: %v", err)
+		return err
 	}
+	return serve(cfg, server, drain)
+}
 
-	// Initialize handlers
-	destHandler := handlers.NewDestinationHandler(client, auditLogger)
+// newAuditLogger creates the audit logger with every sink the configuration
+// enables, for both the server and the add and remove commands
+func newAuditLogger(cfg *config.Config) (*audit.Logger, error) {
+	auditLogger, err := audit.NewLogger(cfg.AuditLogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit logger: %w", err)
+	}
+	auditLogger.SetLabels(cfg.AuditLabels)
+
+	if cfg.AuditStdout {
+		auditLogger.AddSink(audit.NewStdoutSink())
+	}
+	if cfg.Syslog != nil {
+		sink, err := audit.NewSyslogSink(*cfg.Syslog)
+		if err != nil {
+			auditLogger.Close()
+			return nil, fmt.Errorf("failed to create audit syslog sink: %w", err)
+		}
+		auditLogger.AddSink(sink)
+	}
+	if cfg.Webhook != nil {
+		sink, err := audit.NewWebhookSink(*cfg.Webhook)
+		if err != nil {
+			auditLogger.Close()
+			return nil, fmt.Errorf("failed to create audit webhook sink: %w", err)
+		}
+		auditLogger.AddSink(sink)
+	}
+	return auditLogger, nil
+}
+
+// reopenAuditLogOnSIGHUP reopens the audit log file whenever the process
+// receives SIGHUP, as external log rotation tools such as logrotate expect
+func reopenAuditLogOnSIGHUP(auditLogger *audit.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := auditLogger.Reopen(); err != nil {
+			log.Printf("Failed to reopen audit log: %v", err)
+			continue
+		}
+		log.Printf("Reopened audit log")
+	}
+}
+
+// newRouter sets up the routes of the API
+func newRouter(cfg *config.Config, auditLogger *audit.Logger, destHandler *handlers.DestinationHandler, apiKeys *middleware.KeySet) http.Handler {
+	idempotencyStore := middleware.NewIdempotencyStore(cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys)
+	limitMutations := middleware.MaxInFlight(cfg.MaxInFlightMutations)
+
+	// mutation returns the middleware shared by all mutating routes
+	mutation := func(action string) chi.Middlewares {
+		var mws chi.Middlewares
+		if cfg.DebugHTTP {
+			mws = append(mws, middleware.DebugLogger(cfg.DebugHTTPMaxBody))
+		}
+		mws = append(mws, middleware.AuditRecoverer(auditLogger, action))
+		if cfg.FailClosedOnAudit {
+			mws = append(mws, middleware.RequireAuditLog(auditLogger))
+		}
+		return append(mws, limitMutations, middleware.Idempotency(idempotencyStore))
+	}
 
 	// Setup router
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(chimiddleware.RequestID)
+	r.Use(middleware.InstanceHeaders(cfg.Namespaces[0], cfg.InstanceID))
 	r.Use(chimiddleware.RealIP)
 	r.Use(middleware.RequestLogger)
 	r.Use(chimiddleware.Recoverer)
 
+	// Unknown routes and methods get the same JSON errors as the handlers
+	r.NotFound(handlers.NotFound)
+	r.MethodNotAllowed(handlers.MethodNotAllowed(r))
+
+	// All routes are mounted under the base path
+	api := chi.NewRouter()
+	r.Mount(cfg.BasePath, api)
+
 	// Health check endpoint (no auth required)
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+	api.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"healthy"}`))
 	})
 
-	// Protected routes
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.APIKeyAuth(apiKey))
-
-		r.Get("/projects", destHandler.ListProjects)
-		r.Post("/destinations", destHandler.AddDestination)
-		r.Delete("/destinations", destHandler.RemoveDestination)
-		r.Post("/destinations/list", destHandler.ListDestinations)
+	// Readiness endpoint (no auth required), not ready while audit logging fails
+	api.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := auditLogger.Check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "not ready", "reason": err.Error()})
+			return
+		}
+		w.Write([]byte(`{"status":"ready"}`))
 	})
 
-	log.Printf("Starting server on :%s", port)
-	log.Printf("ArgoCD namespace: %s", namespace)
-	log.Printf("Audit log path: %s", auditLogPath)
+	// Prometheus metrics endpoint (no auth required)
+	api.Handle("/metrics", promhttp.Handler())
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	// Build info endpoint (no auth required)
+	api.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"version":   version,
+			"commit":    commit,
+			"buildDate": buildDate,
+		})
+	})
+
+	// Admin routes, only served when an admin key is configured. The reload
+	// endpoint has its own key so that the keys it reloads can't trigger it.
+	if cfg.AdminAPIKey != "" {
+		adminKeys := middleware.NewKeySet([]middleware.APIKey{{Name: "admin-reload", Key: cfg.AdminAPIKey, Admin: true}})
+		api.With(middleware.APIKeyAuth(adminKeys)).Method(http.MethodPost, "/admin/reload", newReloader(apiKeys, destHandler))
 	}
+
+	// Protected routes
+	api.Group(func(r chi.Router) {
+		r.Use(middleware.APIKeyAuth(apiKeys))
+		if cfg.TrustActorHeader {
+			r.Use(middleware.TrustedActor(cfg.ActorHeader))
+		}
+		r.Use(middleware.ArgoCDNamespace(cfg.Namespaces))
+
+		r.With(middleware.Gzip(gzipMinSize)).Get("/projects", destHandler.ListProjects)
+		r.With(mutation("create_project")...).Post("/projects", destHandler.CreateProject)
+		r.With(middleware.Gzip(gzipMinSize)).Get("/projects/export", destHandler.ExportProjects)
+		r.Get("/projects/search", destHandler.SearchProjects)
+		r.Get("/stats", destHandler.Stats)
+		r.With(middleware.Gzip(gzipMinSize)).Get("/projects/violations", destHandler.ListViolations)
+		r.With(mutation("import")...).Post("/projects/import", destHandler.ImportProjects)
+		r.Get("/projects/{project}", destHandler.GetProject)
+		r.With(mutation("delete_project")...).Delete("/projects/{project}", destHandler.DeleteProject)
+		r.Get("/projects/{project}/raw", destHandler.GetProjectSpec)
+		r.With(middleware.Gzip(gzipMinSize)).Get("/projects/{project}/history", destHandler.ProjectHistory)
+		r.Post("/projects/{project}/destinations/validate", destHandler.ValidateDestinations)
+		r.Post("/projects/{project}/destinations/diff", destHandler.DiffDestinations)
+		r.With(mutation("add")...).Post("/projects/{project}/destinations/expand", destHandler.ExpandDestinations)
+		r.With(mutation("remove")...).Delete("/projects/{project}/destinations/by-namespace", destHandler.RemoveDestinationsByNamespace)
+		r.Get("/projects/{project}/source-repos", destHandler.ListSourceRepos)
+		r.With(mutation("add_source_repo")...).Post("/projects/{project}/source-repos", destHandler.AddSourceRepo)
+		r.With(mutation("remove_source_repo")...).Delete("/projects/{project}/source-repos", destHandler.RemoveSourceRepo)
+		r.Get("/projects/{project}/cluster-resource-whitelist", destHandler.ListClusterResourceWhitelist)
+		r.With(mutation("add_cluster_resource_whitelist")...).Post("/projects/{project}/cluster-resource-whitelist", destHandler.AddClusterResourceWhitelist)
+		r.With(mutation("remove_cluster_resource_whitelist")...).Delete("/projects/{project}/cluster-resource-whitelist", destHandler.RemoveClusterResourceWhitelist)
+		r.Get("/projects/{project}/namespace-resource-whitelist", destHandler.ListNamespaceResourceWhitelist)
+		r.With(mutation("add_namespace_resource_whitelist")...).Post("/projects/{project}/namespace-resource-whitelist", destHandler.AddNamespaceResourceWhitelist)
+		r.With(mutation("remove_namespace_resource_whitelist")...).Delete("/projects/{project}/namespace-resource-whitelist", destHandler.RemoveNamespaceResourceWhitelist)
+		r.Get("/projects/{project}/namespace-resource-blacklist", destHandler.ListNamespaceResourceBlacklist)
+		r.With(mutation("add_namespace_resource_blacklist")...).Post("/projects/{project}/namespace-resource-blacklist", destHandler.AddNamespaceResourceBlacklist)
+		r.With(mutation("remove_namespace_resource_blacklist")...).Delete("/projects/{project}/namespace-resource-blacklist", destHandler.RemoveNamespaceResourceBlacklist)
+		r.Get("/projects/{project}/roles", destHandler.ListRoles)
+		r.With(mutation("create_role")...).Post("/projects/{project}/roles", destHandler.CreateRole)
+		r.With(mutation("delete_role")...).Delete("/projects/{project}/roles/{role}", destHandler.DeleteRole)
+		r.With(mutation("create_role_token")...).Post("/projects/{project}/roles/{role}/tokens", destHandler.CreateRoleToken)
+		r.With(mutation("add_role_policy")...).Post("/projects/{project}/roles/{role}/policies", destHandler.AddRolePolicy)
+		r.With(mutation("remove_role_policy")...).Delete("/projects/{project}/roles/{role}/policies", destHandler.RemoveRolePolicy)
+		r.With(mutation("add_role_group")...).Post("/projects/{project}/roles/{role}/groups", destHandler.AddRoleGroup)
+		r.With(mutation("remove_role_group")...).Delete("/projects/{project}/roles/{role}/groups", destHandler.RemoveRoleGroup)
+		r.Get("/projects/{project}/sync-windows", destHandler.ListSyncWindows)
+		r.With(mutation("create_sync_window")...).Post("/projects/{project}/sync-windows", destHandler.CreateSyncWindow)
+		r.With(mutation("delete_sync_window")...).Delete("/projects/{project}/sync-windows", destHandler.DeleteSyncWindow)
+		r.Get("/projects/{project}/signature-keys", destHandler.ListSignatureKeys)
+		r.With(mutation("add_signature_key")...).Post("/projects/{project}/signature-keys", destHandler.AddSignatureKey)
+		r.With(mutation("remove_signature_key")...).Delete("/projects/{project}/signature-keys", destHandler.RemoveSignatureKey)
+		r.Get("/projects/{project}/settings", destHandler.GetProjectSettings)
+		r.With(mutation("update_project_settings")...).Patch("/projects/{project}/settings", destHandler.UpdateProjectSettings)
+		r.With(mutation("update_project_metadata")...).Patch("/projects/{project}/metadata", destHandler.UpdateProjectMetadata)
+		r.Get("/projects/{project}/destinations/archived", destHandler.ListArchivedDestinations)
+		r.With(mutation("restore")...).Post("/projects/{project}/destinations/restore", destHandler.RestoreDestination)
+		r.With(mutation("add")...).Post("/destinations", destHandler.AddDestination)
+		r.With(mutation("add")...).Post("/destinations/batch", destHandler.AddDestinations)
+		r.With(mutation("remove")...).Delete("/destinations", destHandler.RemoveDestination)
+		r.With(mutation("metadata")...).Put("/destinations/metadata", destHandler.SetDestinationMetadata)
+		r.With(middleware.Gzip(gzipMinSize)).Post("/destinations/list", destHandler.ListDestinations)
+		r.Get("/clusters", destHandler.ListClusters)
+		r.With(middleware.Gzip(gzipMinSize)).Get("/audit", destHandler.QueryAuditLog)
+		r.With(middleware.Gzip(gzipMinSize)).Get("/clusters/{server}/destinations", destHandler.ClusterDestinations)
+		if cfg.DebugPatchPreview {
+			r.Post("/debug/patch-preview", destHandler.PreviewPatch)
+		}
+	})
+
+	return r
 }
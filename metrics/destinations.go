@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// destinationCountTimeout bounds a single lookup of the destination counts
+const destinationCountTimeout = 10 * time.Second
+
+// destinationCountBuckets are the histogram buckets for destinations per project
+var destinationCountBuckets = []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// DestinationCountSource returns the destination count of every project,
+// keyed by ArgoCD namespace. It may return the counts of some namespaces
+// together with an error for the others.
+type DestinationCountSource func(ctx context.Context) (map[string][]int, error)
+
+// DestinationCountCollector reports how many destinations projects have when
+// scraped. The counts are looked up at most once per interval; scrapes in
+// between, and scrapes while lookups fail, report the last counts. A
+// namespace missing from a partial lookup keeps its last counts.
+type DestinationCountCollector struct {
+	source   DestinationCountSource
+	interval time.Duration
+
+	perProject *prometheus.Desc
+	total      *prometheus.Desc
+
+	mu      sync.Mutex
+	counts  map[string][]int
+	fetched time.Time
+}
+
+// NewDestinationCountCollector creates a collector that looks up counts from
+// source at most once per interval. Register it with prometheus.MustRegister.
+func NewDestinationCountCollector(source DestinationCountSource, interval time.Duration) *DestinationCountCollector {
+	return &DestinationCountCollector{
+		source:   source,
+		interval: interval,
+		perProject: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "project_destinations"),
+			"Distribution of the number of destinations per AppProject.",
+			[]string{"argocd_namespace"}, nil,
+		),
+		total: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "destinations"),
+			"Total number of destinations across all AppProjects.",
+			[]string{"argocd_namespace"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *DestinationCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.perProject
+	ch <- c.total
+}
+
+// Collect implements prometheus.Collector
+func (c *DestinationCountCollector) Collect(ch chan<- prometheus.Metric) {
+	for namespace, counts := range c.currentCounts() {
+		buckets := make(map[float64]uint64, len(destinationCountBuckets))
+		sum := 0
+		for _, count := range counts {
+			sum += count
+			for _, bound := range destinationCountBuckets {
+				if float64(count) <= bound {
+					buckets[bound]++
+				}
+			}
+		}
+
+		ch <- prometheus.MustNewConstHistogram(c.perProject, uint64(len(counts)), float64(sum), buckets, namespace)
+		ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(sum), namespace)
+	}
+}
+
+// currentCounts returns the cached counts, looking them up again once the
+// interval has passed. A failed lookup also waits for the next interval, so
+// an unavailable API server isn't queried on every scrape.
+func (c *DestinationCountCollector) currentCounts() map[string][]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fetched.IsZero() && time.Since(c.fetched) < c.interval {
+		return c.counts
+	}
+	c.fetched = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), destinationCountTimeout)
+	defer cancel()
+	counts, err := c.source(ctx)
+	if err != nil {
+		log.Printf("Failed to count project destinations for metrics: %v", err)
+		if counts == nil {
+			return c.counts
+		}
+		for namespace, previous := range c.counts {
+			if _, ok := counts[namespace]; !ok {
+				counts[namespace] = previous
+			}
+		}
+	}
+	c.counts = counts
+	return counts
+}
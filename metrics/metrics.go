@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes every metric name exposed by the service
+const namespace = "argocd_destination_api"
+
+var (
+	// InFlightMutations is the number of add/remove requests currently being processed
+	InFlightMutations = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_mutations",
+		Help:      "Number of destination mutations currently being processed.",
+	})
+
+	// RejectedMutations counts mutations rejected because the in-flight limit was reached
+	RejectedMutations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_mutations_total",
+		Help:      "Number of destination mutations rejected because too many were in flight.",
+	})
+
+	// ProjectLockTimeouts counts mutations that gave up waiting for other
+	// mutations of the same project
+	ProjectLockTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "project_lock_timeouts_total",
+		Help:      "Number of destination mutations that timed out waiting for other mutations of the same project.",
+	})
+
+	// ConflictRetries counts mutations re-read and retried after a conflict
+	ConflictRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conflict_retries_total",
+		Help:      "Number of times a destination mutation was retried after a conflicting concurrent modification.",
+	})
+
+	// ConflictRetriesExhausted counts conflicts returned to the caller, by
+	// whether the mutation used up its attempts or the global retry budget
+	ConflictRetriesExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conflict_retries_exhausted_total",
+		Help:      "Number of destination mutations that failed with a conflict without retrying, by reason (attempts or budget).",
+	}, []string{"reason"})
+
+	// MirroredChanges counts changes replayed in the mirror namespace
+	MirroredChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mirrored_changes_total",
+		Help:      "Number of destination changes replayed in the mirror namespace, by action and outcome (success, noop or error).",
+	}, []string{"action", "outcome"})
+
+	// AuditLogSize is the current size of the audit log file
+	AuditLogSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "audit_log_size_bytes",
+		Help:      "Current size of the audit log file in bytes.",
+	})
+
+	// AuditEntriesWritten counts audit entries written since the process started
+	AuditEntriesWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_entries_written_total",
+		Help:      "Number of audit entries written since the process started.",
+	})
+
+	// AuditLastWrite is when the last audit entry was written successfully
+	AuditLastWrite = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "audit_last_write_timestamp_seconds",
+		Help:      "Unix time of the last successful audit log write.",
+	})
+
+	// AuditWebhookDropped counts audit entries not delivered to the webhook
+	// sink, by reason: "queue_full", "circuit_open" or "failed"
+	AuditWebhookDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_webhook_dropped_total",
+		Help:      "Number of audit entries not delivered to the webhook, by reason.",
+	}, []string{"reason"})
+
+	// AuditSyslogDropped counts audit entries not written to the syslog
+	// sink, by reason: "queue_full" or "failed"
+	AuditSyslogDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_syslog_dropped_total",
+		Help:      "Number of audit entries not written to syslog, by reason.",
+	}, []string{"reason"})
+
+	// ProjectCacheLookups counts project list cache lookups, by result:
+	// "hit" or "miss"
+	ProjectCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "project_cache_lookups_total",
+		Help:      "Number of project list cache lookups, by result.",
+	}, []string{"result"})
+)
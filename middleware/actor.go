@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultActorHeader is the header a trusted upstream gateway puts the
+// authenticated user in
+const DefaultActorHeader = "X-Authenticated-User"
+
+type actorKey struct{}
+
+// ActorFromContext returns the user a trusted upstream authenticated the
+// request as, if TrustedActor is in use and the upstream set one
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// TrustedActor returns middleware that records the user named in the given
+// header as the request's actor. Only install it behind a gateway that sets
+// the header itself and strips it from client requests, since anyone else
+// could send it.
+func TrustedActor(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if actor := strings.TrimSpace(r.Header.Get(header)); actor != "" {
+				r = r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Actor returns the audit actor of a request and the name of the API key it
+// used. The key name is only returned separately when a trusted upstream
+// named the user; otherwise the key name is the actor.
+func Actor(ctx context.Context) (actor, apiKey string) {
+	identity, _ := IdentityFromContext(ctx)
+	if user, ok := ActorFromContext(ctx); ok {
+		return user, identity.Name
+	}
+	return identity.Name, ""
+}
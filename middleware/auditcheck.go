@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/example/argocd-destination-api/audit"
+)
+
+// RequireAuditLog returns middleware for mutating routes that refuses requests
+// with 503 while audit entries can't be written, so no change goes unaudited
+func RequireAuditLog(auditLogger *audit.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := auditLogger.Check(); err != nil {
+				log.Printf("Refusing %s %s: %v", r.Method, r.URL.Path, err)
+				writeJSONError(w, r, http.StatusServiceUnavailable, "audit log is unavailable, changes are refused until it recovers")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,10 +1,20 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // ErrorResponse represents a JSON error response
@@ -12,27 +22,195 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
-// APIKeyAuth returns middleware that validates the X-API-Key header
-func APIKeyAuth(apiKey string) func(http.Handler) http.Handler {
+// APIKey is an API key together with the identity and scope it grants
+type APIKey struct {
+	// Name identifies the key holder and is recorded as the audit actor
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"`
+	// Hash is a bcrypt hash of the key, used instead of Key when set so the
+	// key isn't stored in plaintext
+	Hash string `json:"hash,omitempty"`
+	// ID is required with Hash. A hashed key is presented as <id>.<secret>,
+	// and only checked against the hash of the key with that ID, so a request
+	// costs at most one bcrypt comparison. IDs are not secret.
+	ID string `json:"id,omitempty"`
+	// Owner restricts the key to projects whose owner label has this value
+	Owner string `json:"owner,omitempty"`
+	// Admin keys may access every project
+	Admin bool `json:"admin,omitempty"`
+}
+
+// KeySet holds the configured API keys. The keys can be replaced while
+// requests are being authenticated.
+type KeySet struct {
+	keys atomic.Pointer[keyIndex]
+}
+
+// keyIndex is a snapshot of the keys with the hashed ones indexed by ID
+type keyIndex struct {
+	keys   []APIKey
+	hashed map[string]APIKey
+}
+
+// NewKeySet creates a key set holding keys
+func NewKeySet(keys []APIKey) *KeySet {
+	s := &KeySet{}
+	s.Store(keys)
+	return s
+}
+
+// Keys returns the current keys
+func (s *KeySet) Keys() []APIKey {
+	return s.keys.Load().keys
+}
+
+// Store replaces the keys. Hashed keys without an ID can't be matched; see
+// CheckKeys.
+func (s *KeySet) Store(keys []APIKey) {
+	index := &keyIndex{keys: keys, hashed: make(map[string]APIKey)}
+	for _, key := range keys {
+		if key.Hash != "" && key.ID != "" {
+			index.hashed[key.ID] = key
+		}
+	}
+	s.keys.Store(index)
+}
+
+// CheckKeys returns an error if a hashed key has no ID, an invalid one, or
+// one another key uses
+func CheckKeys(keys []APIKey) error {
+	ids := make(map[string]string)
+	for _, key := range keys {
+		if key.Hash == "" {
+			continue
+		}
+		if err := CheckKeyID(key.ID); err != nil {
+			return fmt.Errorf("API key %s: %w", key.Name, err)
+		}
+		if other, ok := ids[key.ID]; ok {
+			return fmt.Errorf("API keys %s and %s have the same id %q", other, key.Name, key.ID)
+		}
+		ids[key.ID] = key.Name
+	}
+	return nil
+}
+
+// CheckKeyID returns an error if id can't identify a hashed key
+func CheckKeyID(id string) error {
+	if id == "" {
+		return errors.New("id is required for hashed keys")
+	}
+	if strings.Contains(id, ".") {
+		return fmt.Errorf("id %q must not contain '.'", id)
+	}
+	return nil
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the API key that authenticated the request
+func IdentityFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(identityKey{}).(APIKey)
+	return key, ok
+}
+
+// LoadAPIKeys reads a JSON array of API keys from a file. Every key needs a
+// name, a key or a bcrypt hash of it with an ID, and either an owner or admin
+// access.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	for i, key := range keys {
+		if key.Name == "" || (key.Key == "" && key.Hash == "") {
+			return nil, fmt.Errorf("API key %d: name and key or hash are required", i)
+		}
+		if key.Hash != "" {
+			if err := CheckKeyHash(key.Hash); err != nil {
+				return nil, fmt.Errorf("API key %s: %w", key.Name, err)
+			}
+		}
+		if key.Owner == "" && !key.Admin {
+			return nil, fmt.Errorf("API key %s: owner is required for non-admin keys", key.Name)
+		}
+	}
+	if err := CheckKeys(keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// APIKeyAuth returns middleware that validates the X-API-Key header against
+// the keys in the set and stores the matching key's identity in the context
+func APIKeyAuth(keys *KeySet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			providedKey := r.Header.Get("X-API-Key")
 
 			if providedKey == "" {
-				writeJSONError(w, http.StatusUnauthorized, "missing X-API-Key header")
+				writeJSONError(w, r, http.StatusUnauthorized, "missing X-API-Key header")
 				return
 			}
 
-			if providedKey != apiKey {
-				writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+			identity, ok := matchAPIKey(keys.keys.Load(), providedKey)
+			if !ok {
+				writeJSONError(w, r, http.StatusUnauthorized, "invalid API key")
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
 		})
 	}
 }
 
+// compareHash checks a key against its bcrypt hash; tests count the calls
+var compareHash = bcrypt.CompareHashAndPassword
+
+// matchAPIKey finds the key matching provided. Plaintext keys are all
+// compared in constant time so the response time doesn't reveal which keys
+// exist. A hashed key is only looked up by the ID prefix of provided, so that
+// requests, including unauthenticated ones, run bcrypt at most once and its
+// cost doesn't grow with the number of keys.
+func matchAPIKey(index *keyIndex, provided string) (APIKey, bool) {
+	var match APIKey
+	found := false
+	for _, key := range index.keys {
+		if key.Hash == "" && subtle.ConstantTimeCompare([]byte(key.Key), []byte(provided)) == 1 && !found {
+			match = key
+			found = true
+		}
+	}
+	if found {
+		return match, true
+	}
+
+	id, _, ok := strings.Cut(provided, ".")
+	if !ok {
+		return APIKey{}, false
+	}
+	key, ok := index.hashed[id]
+	if !ok || compareHash([]byte(key.Hash), []byte(provided)) != nil {
+		return APIKey{}, false
+	}
+	return key, true
+}
+
+// CheckKeyHash returns an error if hash is not a bcrypt hash
+func CheckKeyHash(hash string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("invalid bcrypt hash: %w", err)
+	}
+	return nil
+}
+
 // RequestLogger logs all HTTP requests with method, path, and response status
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -57,13 +235,42 @@ type responseWriter struct {
 	statusCode int
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) {
+// writeJSONError writes an error response. Clients that prefer text/plain
+// over JSON in their Accept header get just the message as plain text.
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if prefersPlainText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, message+"\n")
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
 }
+
+// prefersPlainText reports whether the Accept header lists text/plain before
+// any JSON media type. JSON stays the default.
+func prefersPlainText(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.TrimSpace(mediaType) {
+		case "text/plain":
+			return true
+		case "application/json", "application/*":
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashKey returns a bcrypt hash of key at the lowest cost
+func hashKey(t *testing.T, key string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestMatchAPIKey(t *testing.T) {
+	keys := NewKeySet([]APIKey{
+		{Name: "plain", Key: "secret-p", Admin: true},
+		{Name: "ci", ID: "ci", Hash: hashKey(t, "ci.secret-c"), Owner: "team-a"},
+		{Name: "deploy", ID: "deploy", Hash: hashKey(t, "deploy.secret-d"), Owner: "team-b"},
+	})
+
+	tests := []struct {
+		name     string
+		provided string
+		want     string
+	}{
+		{name: "plaintext key", provided: "secret-p", want: "plain"},
+		{name: "hashed key", provided: "ci.secret-c", want: "ci"},
+		{name: "another hashed key", provided: "deploy.secret-d", want: "deploy"},
+		{name: "wrong secret", provided: "ci.secret-d"},
+		{name: "another key's secret under its id", provided: "ci.deploy.secret-d"},
+		{name: "unknown id", provided: "other.secret-c"},
+		{name: "no id", provided: "secret-c"},
+		{name: "empty", provided: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := matchAPIKey(keys.keys.Load(), tt.provided)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("matchAPIKey(%q) = %s, want no match", tt.provided, key.Name)
+				}
+				return
+			}
+			if !ok || key.Name != tt.want {
+				t.Errorf("matchAPIKey(%q) = %s, %t, want %s", tt.provided, key.Name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAPIKeyComparesOneHash(t *testing.T) {
+	var keys []APIKey
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		keys = append(keys, APIKey{Name: id, ID: id, Hash: hashKey(t, id+".secret"), Admin: true})
+	}
+	index := NewKeySet(keys).keys.Load()
+
+	compared := 0
+	compare := compareHash
+	compareHash = func(hash, key []byte) error {
+		compared++
+		return compare(hash, key)
+	}
+	t.Cleanup(func() { compareHash = compare })
+
+	for provided, want := range map[string]int{
+		"e.secret": 1,
+		"e.wrong":  1,
+		"x.secret": 0,
+		"secret":   0,
+	} {
+		compared = 0
+		matchAPIKey(index, provided)
+		if compared != want {
+			t.Errorf("matchAPIKey(%q) ran bcrypt %d times, want %d", provided, compared, want)
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	hash := hashKey(t, "x.secret")
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr bool
+	}{
+		{name: "plaintext keys need no id", keys: []APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "l"}}},
+		{name: "distinct ids", keys: []APIKey{{Name: "a", ID: "a", Hash: hash}, {Name: "b", ID: "b", Hash: hash}}},
+		{name: "missing id", keys: []APIKey{{Name: "a", Hash: hash}}, wantErr: true},
+		{name: "id with a dot", keys: []APIKey{{Name: "a", ID: "a.b", Hash: hash}}, wantErr: true},
+		{name: "duplicate id", keys: []APIKey{{Name: "a", ID: "x", Hash: hash}, {Name: "b", ID: "x", Hash: hash}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckKeys(tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("CheckKeys() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
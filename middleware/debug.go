@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedHeaders are the request headers whose values DebugLogger never logs
+var redactedHeaders = map[string]bool{
+	"X-Api-Key":           true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// DebugLogger returns middleware that logs the method, path, headers, request
+// body, status and response body of every request, with credentials redacted
+// and bodies truncated to maxBody bytes. Response bodies marked
+// Cache-Control: no-store are not logged. The handler still reads the complete
+// request body. Bodies may contain sensitive data, so it is meant for
+// debugging client integrations only.
+func DebugLogger(maxBody int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Read only as much of the body as is logged and put it back in
+			// front of the rest
+			var requestBody []byte
+			if r.Body != nil {
+				requestBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(maxBody)+1))
+				r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(requestBody), r.Body), Closer: r.Body}
+			}
+
+			recorder := &bodyRecorder{ResponseWriter: w, statusCode: http.StatusOK, max: maxBody}
+			next.ServeHTTP(recorder, r)
+
+			// Handlers mark responses carrying credentials, such as issued
+			// tokens, as not to be stored
+			responseBody := truncateBody(recorder.body.Bytes(), maxBody)
+			if strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+				responseBody = "[REDACTED]"
+			}
+
+			log.Printf("DEBUG %s %s headers=%s request=%s status=%d response=%s",
+				r.Method, r.URL.RequestURI(), redactHeaders(r.Header),
+				truncateBody(requestBody, maxBody), recorder.statusCode, responseBody)
+		})
+	}
+}
+
+// readCloser combines a reader with the closer of the body it was built from
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyRecorder captures the status and the first max bytes of a response
+type bodyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	max        int
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (br *bodyRecorder) Unwrap() http.ResponseWriter {
+	return br.ResponseWriter
+}
+
+func (br *bodyRecorder) WriteHeader(code int) {
+	br.statusCode = code
+	br.ResponseWriter.WriteHeader(code)
+}
+
+func (br *bodyRecorder) Write(p []byte) (int, error) {
+	if room := br.max + 1 - br.body.Len(); room > 0 {
+		br.body.Write(p[:min(room, len(p))])
+	}
+	return br.ResponseWriter.Write(p)
+}
+
+// redactHeaders formats headers for logging, hiding credentials
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ",")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "[REDACTED]"
+		}
+		parts = append(parts, name+"="+value)
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// truncateBody quotes a body for logging, cut to max bytes
+func truncateBody(body []byte, max int) string {
+	if len(body) > max {
+		return strconv.Quote(string(body[:max])) + "...(truncated)"
+	}
+	return strconv.Quote(string(body))
+}
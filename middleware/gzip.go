@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Gzip returns middleware that gzip-compresses responses for clients that
+// accept it. Responses shorter than minSize bytes are sent uncompressed since
+// compressing them costs more than it saves.
+func Gzip(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+			defer gw.finish()
+
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the response reaches the minimum size for compression
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	// passthrough is set once the response is being written uncompressed
+	passthrough bool
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	gw.status = code
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	switch {
+	case gw.gz != nil:
+		return gw.gz.Write(b)
+	case gw.passthrough:
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf.Write(b)
+	if gw.buf.Len() < gw.minSize {
+		return len(b), nil
+	}
+
+	if err := gw.start(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// start sends the headers and the buffered body, compressing unless the
+// handler already encoded the body or the status carries no body
+func (gw *gzipResponseWriter) start() error {
+	header := gw.Header()
+	if header.Get("Content-Encoding") != "" || gw.status == http.StatusNoContent || gw.status == http.StatusNotModified {
+		gw.passthrough = true
+		gw.ResponseWriter.WriteHeader(gw.status)
+		_, err := gw.ResponseWriter.Write(gw.buf.Bytes())
+		return err
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	_, err := gw.gz.Write(gw.buf.Bytes())
+	return err
+}
+
+// finish flushes a response that stayed below the minimum size uncompressed,
+// or closes the gzip stream
+func (gw *gzipResponseWriter) finish() {
+	switch {
+	case gw.gz != nil:
+		gw.gz.Close()
+	case !gw.passthrough:
+		gw.ResponseWriter.WriteHeader(gw.status)
+		gw.ResponseWriter.Write(gw.buf.Bytes())
+	}
+}
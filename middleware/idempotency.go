@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client's idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// replayedHeaders are the response headers stored and replayed with the body
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyStore caches mutation responses by idempotency key so retried
+// requests are answered with the original response instead of being reapplied
+type IdempotencyStore struct {
+	ttl        time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	// recent orders the entries from most to least recently used
+	recent *list.List
+}
+
+type idempotencyEntry struct {
+	key         string
+	payloadHash [sha256.Size]byte
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// NewIdempotencyStore creates an in-memory store that keeps responses for ttl.
+// Once it holds maxEntries keys, the least recently used stored response is
+// dropped to make room for a new key.
+func NewIdempotencyStore(ttl time.Duration, maxEntries int) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// Idempotency returns middleware that replays the stored response when a
+// request repeats an Idempotency-Key on the same route. Keys are scoped to
+// the caller and the ArgoCD namespace. Reusing a key with a different payload
+// is rejected with 409. Only successful responses are stored, so failed
+// requests can be retried with the same key.
+func Idempotency(store *IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				writeJSONError(w, r, http.StatusBadRequest, "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := idempotencyStoreKey(r, key)
+			payloadHash := sha256.Sum256(body)
+
+			entry, existing := store.begin(storeKey, payloadHash)
+			if existing {
+				switch {
+				case entry.payloadHash != payloadHash:
+					writeJSONError(w, r, http.StatusConflict, "Idempotency-Key was already used with a different payload")
+				case !entry.done:
+					writeJSONError(w, r, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+				default:
+					for name, values := range entry.header {
+						w.Header()[name] = values
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(entry.status)
+					w.Write(entry.body)
+				}
+				return
+			}
+
+			// The reservation is released unless a response is stored, also
+			// when the handler panics and the panic is recovered further out
+			completed := false
+			defer func() {
+				if !completed {
+					store.release(storeKey)
+				}
+			}()
+
+			recorder := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= 200 && recorder.status < 300 {
+				header := make(http.Header)
+				for _, name := range replayedHeaders {
+					for _, value := range w.Header().Values(name) {
+						header.Add(name, value)
+					}
+				}
+				store.complete(storeKey, recorder.status, header, recorder.body.Bytes())
+				completed = true
+			}
+		})
+	}
+}
+
+// idempotencyStoreKey scopes an idempotency key to the caller, the selected
+// ArgoCD namespace and the exact route including its query, so that a key
+// only replays the response to the same request from the same caller
+func idempotencyStoreKey(r *http.Request, key string) string {
+	actor, apiKey := Actor(r.Context())
+	return strings.Join([]string{
+		actor, apiKey, argocd.NamespaceFromContext(r.Context()),
+		r.Method, r.URL.Path, r.URL.RawQuery, key,
+	}, "\x00")
+}
+
+// begin returns the entry stored for key, or reserves the key for a new
+// in-progress request and reports that no entry existed
+func (s *IdempotencyStore) begin(key string, payloadHash [sha256.Size]byte) (idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.removeExpired(now)
+
+	if element, ok := s.entries[key]; ok {
+		s.recent.MoveToFront(element)
+		return *element.Value.(*idempotencyEntry), true
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[key] = s.recent.PushFront(&idempotencyEntry{
+		key:         key,
+		payloadHash: payloadHash,
+		expires:     now.Add(s.ttl),
+	})
+	return idempotencyEntry{}, false
+}
+
+// complete stores the response for a reserved key
+func (s *IdempotencyStore) complete(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*idempotencyEntry)
+		entry.done = true
+		entry.status = status
+		entry.header = header
+		entry.body = body
+		entry.expires = time.Now().Add(s.ttl)
+	}
+}
+
+// release drops a reserved key so the request can be retried
+func (s *IdempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+}
+
+// evict drops the least recently used stored response. Keys of requests
+// still in progress are kept, so they can't be reapplied concurrently. The
+// caller must hold s.mu.
+func (s *IdempotencyStore) evict() {
+	for element := s.recent.Back(); element != nil; element = element.Prev() {
+		if element.Value.(*idempotencyEntry).done {
+			s.remove(element)
+			return
+		}
+	}
+}
+
+// removeExpired drops expired entries. The caller must hold s.mu.
+func (s *IdempotencyStore) removeExpired(now time.Time) {
+	for _, element := range s.entries {
+		if now.After(element.Value.(*idempotencyEntry).expires) {
+			s.remove(element)
+		}
+	}
+}
+
+// remove drops an entry. The caller must hold s.mu.
+func (s *IdempotencyStore) remove(element *list.Element) {
+	delete(s.entries, element.Value.(*idempotencyEntry).key)
+	s.recent.Remove(element)
+}
+
+// recordingWriter passes the response through while keeping a copy of the
+// status code and body
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// idempotentHandler counts the requests it applies and answers like an add
+type idempotentHandler struct {
+	applied int
+}
+
+func (h *idempotentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.applied++
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"42"`)
+	w.Header().Set("Location", "/projects/team-a")
+	w.Header().Set("X-Other", "not replayed")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"project":"team-a"}`))
+}
+
+// sendIdempotent sends a request with an idempotency key
+func sendIdempotent(handler http.Handler, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/destinations", strings.NewReader(`{"project":"team-a"}`))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysHeaders(t *testing.T) {
+	next := &idempotentHandler{}
+	handler := Idempotency(NewIdempotencyStore(time.Minute, 10))(next)
+
+	sendIdempotent(handler, "key-1")
+	rec := sendIdempotent(handler, "key-1")
+
+	if next.applied != 1 {
+		t.Errorf("applied %d times, want once", next.applied)
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"project":"team-a"}` {
+		t.Errorf("replay = %d %s, want the stored response", rec.Code, rec.Body)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":        "application/json",
+		"ETag":                `"42"`,
+		"Location":            "/projects/team-a",
+		"Idempotent-Replayed": "true",
+		"X-Other":             "",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestIdempotencyStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	next := &idempotentHandler{}
+	store := NewIdempotencyStore(time.Minute, 2)
+	handler := Idempotency(store)(next)
+
+	sendIdempotent(handler, "key-1")
+	sendIdempotent(handler, "key-2")
+	// Using key-1 again makes key-2 the least recently used
+	sendIdempotent(handler, "key-1")
+	sendIdempotent(handler, "key-3")
+
+	if got := len(store.entries); got != 2 {
+		t.Errorf("store holds %d keys, want 2", got)
+	}
+	applied := next.applied
+	if rec := sendIdempotent(handler, "key-1"); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("key-1 was evicted, want it kept as recently used")
+	}
+	if sendIdempotent(handler, "key-2"); next.applied != applied+1 {
+		t.Error("key-2 was replayed, want it evicted and applied again")
+	}
+}
+
+func TestIdempotencyStoreKeepsInProgressKeys(t *testing.T) {
+	store := NewIdempotencyStore(time.Minute, 1)
+	if _, existing := store.begin("in-progress", [32]byte{}); existing {
+		t.Fatal("begin() found an entry in an empty store")
+	}
+	store.begin("other", [32]byte{})
+
+	if entry, existing := store.begin("in-progress", [32]byte{}); !existing || entry.done {
+		t.Error("in-progress key was evicted, want it kept until its request completes")
+	}
+}
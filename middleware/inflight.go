@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/example/argocd-destination-api/metrics"
+)
+
+// MaxInFlight returns middleware that allows at most limit requests to be
+// processed at once. Requests beyond the limit are rejected immediately with
+// 503 instead of queuing, so a burst can't pile up against the API server.
+// All routes wrapped by the returned middleware share the same limit.
+func MaxInFlight(limit int) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				metrics.RejectedMutations.Inc()
+				w.Header().Set("Retry-After", "1")
+				writeJSONError(w, r, http.StatusServiceUnavailable, "too many concurrent mutations, please retry")
+				return
+			}
+
+			metrics.InFlightMutations.Inc()
+			defer func() {
+				metrics.InFlightMutations.Dec()
+				<-slots
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import "net/http"
+
+// InstanceIDHeader is the response header naming the instance that served a
+// request
+const InstanceIDHeader = "X-Instance-ID"
+
+// InstanceHeaders returns middleware that tells clients which instance served
+// a request, for setups with several instances behind one hostname. Every
+// response carries the instance's default ArgoCD namespace in
+// X-ArgoCD-Namespace, which ArgoCDNamespace replaces with the namespace a
+// request selected, and X-Instance-ID if instanceID is set.
+func InstanceHeaders(namespace, instanceID string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(NamespaceHeader, namespace)
+			if instanceID != "" {
+				w.Header().Set(InstanceIDHeader, instanceID)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
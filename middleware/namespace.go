@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/example/argocd-destination-api/argocd"
+)
+
+// NamespaceHeader is the request header used to select the ArgoCD namespace
+const NamespaceHeader = "X-ArgoCD-Namespace"
+
+// ArgoCDNamespace returns middleware that resolves the target ArgoCD namespace
+// from the X-ArgoCD-Namespace header and validates it against the allowed
+// namespaces. Requests without the header use the first allowed namespace.
+// The response header of the same name reports the namespace used.
+func ArgoCDNamespace(namespaces []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		allowed[ns] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			namespace := r.Header.Get(NamespaceHeader)
+			if namespace == "" {
+				namespace = namespaces[0]
+			}
+
+			if !allowed[namespace] {
+				writeJSONError(w, r, http.StatusBadRequest, "namespace not allowed: "+namespace)
+				return
+			}
+
+			w.Header().Set(NamespaceHeader, namespace)
+			next.ServeHTTP(w, r.WithContext(argocd.WithNamespace(r.Context(), namespace)))
+		})
+	}
+}
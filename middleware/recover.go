@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// AuditRecoverer returns middleware for mutating routes that recovers from
+// panics, writes an audit entry with outcome "error" for the given action and
+// responds with 500. A panic during a mutation may mean the change was
+// partially applied, so it must leave a trace in the audit log.
+func AuditRecoverer(auditLogger *audit.Logger, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			project := peekProject(r)
+
+			defer func() {
+				rvr := recover()
+				if rvr == nil {
+					return
+				}
+				if rvr == http.ErrAbortHandler {
+					// Let the server abort the response as usual
+					panic(rvr)
+				}
+
+				log.Printf("panic: %v\n%s", rvr, debug.Stack())
+				actor, apiKey := Actor(r.Context())
+				logPanicAudit(auditLogger, audit.Entry{
+					Action:     action,
+					Actor:      actor,
+					APIKey:     apiKey,
+					Project:    project,
+					Outcome:    audit.OutcomeError,
+					Status:     http.StatusInternalServerError,
+					Route:      r.Method + " " + r.URL.Path,
+					RequestID:  chimiddleware.GetReqID(r.Context()),
+					UserAgent:  r.UserAgent(),
+					RemoteAddr: r.RemoteAddr,
+				})
+
+				writeJSONError(w, r, http.StatusInternalServerError, "internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maxPeekBody bounds how much of a request body is read to find its project
+const maxPeekBody = 64 << 10
+
+// peekProject returns the project a mutation targets: the {project} URL
+// parameter of routes such as /projects/{project}/..., which routing has
+// checked, or else the project field of a JSON body
+func peekProject(r *http.Request) string {
+	if project := chi.URLParam(r, "project"); project != "" {
+		return project
+	}
+	return peekBodyProject(r)
+}
+
+// peekBodyProject reads up to maxPeekBody bytes of the request body to
+// extract the project name and puts them back in front of the rest. A body
+// larger than that yields no project.
+func peekBodyProject(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Project string `json:"project"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Project
+}
+
+// logPanicAudit writes an audit entry without letting a failing audit logger
+// escalate into a second panic
+func logPanicAudit(auditLogger *audit.Logger, entry audit.Entry) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			log.Printf("Audit logger panicked while recording panic: %v", rvr)
+		}
+	}()
+
+	if err := auditLogger.Log(entry); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/example/argocd-destination-api/audit"
+	"github.com/go-chi/chi/v5"
+)
+
+// recordingSink keeps the audit entries it is sent
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (s *recordingSink) Send(entry audit.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestAuditRecovererProject(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   string
+	}{
+		{name: "from the body", target: "/destinations", body: `{"project":"team-a"}`, want: "team-a"},
+		{name: "from the URL", target: "/projects/team-b/source-repos", body: `{"repo":"https://git.example.com/app.git"}`, want: "team-b"},
+		{name: "from the URL without a body", target: "/projects/team-c", want: "team-c"},
+		{name: "URL takes precedence", target: "/projects/team-c/source-repos", body: `{"project":"team-a"}`, want: "team-c"},
+		{name: "body too large to peek", target: "/destinations", body: `{"project":"team-a","padding":"` + strings.Repeat("x", maxPeekBody) + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditLogger, err := audit.NewLogger("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sink := &recordingSink{}
+			auditLogger.AddSink(sink)
+
+			var handlerBody string
+			panicking := func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				handlerBody = string(body)
+				panic("boom")
+			}
+
+			r := chi.NewRouter()
+			r.With(AuditRecoverer(auditLogger, "test")).Post("/destinations", panicking)
+			r.With(AuditRecoverer(auditLogger, "test")).Post("/projects/{project}", panicking)
+			r.With(AuditRecoverer(auditLogger, "test")).Post("/projects/{project}/source-repos", panicking)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500", rec.Code)
+			}
+			if handlerBody != tt.body {
+				t.Errorf("handler read body %q, want %q", handlerBody, tt.body)
+			}
+			if len(sink.entries) != 1 || sink.entries[0].Project != tt.want || sink.entries[0].Outcome != audit.OutcomeError {
+				t.Errorf("audit entries = %+v, want an error entry for project %q", sink.entries, tt.want)
+			}
+		})
+	}
+}
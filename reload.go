@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/example/argocd-destination-api/config"
+	"github.com/example/argocd-destination-api/handlers"
+	"github.com/example/argocd-destination-api/middleware"
+)
+
+// ReloadResponse lists the settings a reload changed
+type ReloadResponse struct {
+	Changed []string `json:"changed"`
+}
+
+// reloadSources are the files a reload re-reads, named by environment
+// variables, by the setting they configure
+var reloadSources = []struct {
+	setting string
+	envs    []string
+}{
+	{"apiKeys", []string{"API_KEY_FILE", "API_KEYS_FILE"}},
+	{"namespacePolicy", []string{"NAMESPACE_POLICY_FILE"}},
+	{"fieldPolicy", []string{"DESTINATION_FIELD_POLICY_FILE"}},
+}
+
+// reloader re-reads the configuration files and swaps the settings they
+// configure into the running server. Settings read only from environment
+// variables keep their values, since a process's environment can't change.
+type reloader struct {
+	mu      sync.Mutex
+	keys    *middleware.KeySet
+	handler *handlers.DestinationHandler
+	// sources holds the raw contents of reloadSources last applied
+	sources map[string]string
+}
+
+// newReloader creates a reloader for the configuration the server started with
+func newReloader(keys *middleware.KeySet, handler *handlers.DestinationHandler) *reloader {
+	return &reloader{keys: keys, handler: handler, sources: readReloadSources()}
+}
+
+// readReloadSources returns the raw contents of the reload sources by
+// setting. A file that can't be read counts as empty; loading the
+// configuration reports the error.
+func readReloadSources() map[string]string {
+	sources := make(map[string]string, len(reloadSources))
+	for _, source := range reloadSources {
+		var raw strings.Builder
+		for _, env := range source.envs {
+			path := os.Getenv(env)
+			if path == "" {
+				continue
+			}
+			data, _ := os.ReadFile(path)
+			fmt.Fprintf(&raw, "%s=%s\x00%s\x00", env, path, data)
+		}
+		sources[source.setting] = raw.String()
+	}
+	return sources
+}
+
+// reload loads the API keys and handler policies again and applies them if
+// all of them are valid. It returns the names of the settings whose files
+// changed.
+func (rl *reloader) reload() ([]string, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// The files are read before loading, so a change made in between is
+	// reported again by the next reload rather than missed
+	sources := readReloadSources()
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for _, source := range reloadSources {
+		if sources[source.setting] != rl.sources[source.setting] {
+			changed = append(changed, source.setting)
+		}
+	}
+
+	// Only the reloadable policies are swapped in; the other options come
+	// from environment variables or need a restart to take effect
+	options := rl.handler.Options()
+	options.NamespacePolicy = cfg.Handler.NamespacePolicy
+	options.FieldPolicy = cfg.Handler.FieldPolicy
+
+	rl.keys.Store(cfg.APIKeys)
+	rl.handler.SetOptions(options)
+	rl.sources = sources
+	return changed, nil
+}
+
+// ServeHTTP handles POST /admin/reload
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	changed, err := rl.reload()
+	if err != nil {
+		log.Printf("Configuration reload rejected: %v", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(handlers.ErrorResponse{Message: "configuration rejected: " + err.Error()})
+		return
+	}
+
+	log.Printf("Configuration reloaded, changed: %v", changed)
+	json.NewEncoder(w).Encode(ReloadResponse{Changed: changed})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/example/argocd-destination-api/config"
+	"github.com/example/argocd-destination-api/handlers"
+	"github.com/example/argocd-destination-api/middleware"
+)
+
+// writeFile writes a configuration file, failing the test on error
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.json")
+	policyFile := filepath.Join(dir, "policy.json")
+	writeFile(t, keysFile, `[{"name":"platform","key":"secret-p","admin":true}]`)
+	writeFile(t, policyFile, `{"denied":["kube-*"]}`)
+	t.Setenv("AUDIT_LOG_PATH", filepath.Join(dir, "audit.log"))
+	t.Setenv("API_KEYS_FILE", keysFile)
+	t.Setenv("NAMESPACE_POLICY_FILE", policyFile)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set after startup, e.g. by a default the environment doesn't carry:
+	// a reload must leave it alone
+	options := cfg.Handler
+	options.RequireTicket = true
+	keys := middleware.NewKeySet(cfg.APIKeys)
+	handler := handlers.NewDestinationHandler(nil, nil, options)
+	rl := newReloader(keys, handler)
+
+	changed, err := rl.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("changed = %v without file changes, want none", changed)
+	}
+
+	writeFile(t, policyFile, `{"denied":["kube-*","default"]}`)
+	changed, err = rl.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"namespacePolicy"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	got := handler.Options()
+	if want := []string{"kube-*", "default"}; !reflect.DeepEqual(got.NamespacePolicy.Denied, want) {
+		t.Errorf("denied namespaces = %v, want %v", got.NamespacePolicy.Denied, want)
+	}
+	if !got.RequireTicket {
+		t.Error("reload replaced RequireTicket, want only the reloadable settings swapped")
+	}
+
+	writeFile(t, policyFile, `{"denied":["["]}`)
+	if _, err := rl.reload(); err == nil {
+		t.Fatal("reload() accepted an invalid policy")
+	}
+	if got := handler.Options().NamespacePolicy.Denied; len(got) != 2 {
+		t.Errorf("denied namespaces = %v after a rejected reload, want the running policy kept", got)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/example/argocd-destination-api/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newServer creates the HTTP server for the API. HTTP/2 is negotiated over TLS
+// automatically; with cfg.EnableH2C plaintext connections may use HTTP/2 too,
+// for clients behind a service mesh that terminates TLS.
+func newServer(cfg *config.Config, handler http.Handler) (*http.Server, *drainer, error) {
+	drain := &drainer{}
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           drain.wrap(handler),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	// Configuring HTTP/2 explicitly, rather than leaving it to net/http,
+	// lets shutdown send GOAWAY on h2c connections as well as TLS ones
+	h2s := &http2.Server{IdleTimeout: cfg.IdleTimeout}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	if cfg.EnableH2C {
+		server.Handler = h2c.NewHandler(server.Handler, h2s)
+	}
+
+	return server, drain, nil
+}
+
+// serve runs the server until it fails or the process receives SIGTERM or
+// SIGINT. On a signal the server stops accepting connections, tells HTTP/2
+// clients to open no new streams, and waits up to cfg.ShutdownTimeout for
+// requests in progress to finish.
+func serve(cfg *config.Config, server *http.Server, drain *drainer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		if cfg.TLSCertFile != "" {
+			log.Printf("Starting server on %s with TLS", server.Addr)
+			errs <- server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+			return
+		}
+		log.Printf("Starting server on %s (h2c=%t)", server.Addr, cfg.EnableH2C)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, draining requests for up to %s", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Shutdown doesn't wait for HTTP/2 streams, since their connections are
+	// taken over from net/http, so the drainer waits for those requests
+	err := server.Shutdown(shutdownCtx)
+	if err == nil {
+		err = drain.wait(shutdownCtx)
+	}
+	if err != nil {
+		return fmt.Errorf("shutdown did not complete within %s: %w", cfg.ShutdownTimeout, err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Printf("Server stopped")
+	return nil
+}
+
+// drainer counts the requests in progress so shutdown can wait for them
+type drainer struct {
+	active atomic.Int64
+}
+
+// wrap counts the requests handled by next
+func (d *drainer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.active.Add(1)
+		defer d.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wait polls until no request is in progress or the context ends
+func (d *drainer) wait(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for d.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in progress: %w", d.active.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}